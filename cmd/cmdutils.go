@@ -15,15 +15,20 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	b64 "encoding/base64"
 	"fmt"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/codefresh-io/status-reporter/pkg/codefresh"
 	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
@@ -33,6 +38,14 @@ const (
 	defaultCodefreshHost = "https://g.codefresh.io"
 )
 
+type retryCmdOptions struct {
+	maxAttempts       int
+	baseDelay         time.Duration
+	maxDelay          time.Duration
+	jitter            float64
+	retryableStatuses []string
+}
+
 var (
 	exit = os.Exit
 )
@@ -44,7 +57,40 @@ func dieOnError(err error) {
 	}
 }
 
-func buildCodefreshClient(eventReportingURL string, token string, httpClient *http.Client, lgr logger.Logger) *codefresh.Codefresh {
+func addRetryFlags(flags *pflag.FlagSet, options *retryCmdOptions) {
+	dieOnError(viper.BindEnv("retry-max-attempts", "RETRY_MAX_ATTEMPTS"))
+	dieOnError(viper.BindEnv("retry-base-delay", "RETRY_BASE_DELAY"))
+	dieOnError(viper.BindEnv("retry-max-delay", "RETRY_MAX_DELAY"))
+	dieOnError(viper.BindEnv("retry-jitter", "RETRY_JITTER"))
+	dieOnError(viper.BindEnv("retry-statuses", "RETRY_STATUSES"))
+
+	defaults := codefresh.DefaultRetryPolicy()
+	viper.SetDefault("retry-max-attempts", defaults.MaxAttempts)
+	viper.SetDefault("retry-base-delay", defaults.BaseDelay)
+	viper.SetDefault("retry-max-delay", defaults.MaxDelay)
+	viper.SetDefault("retry-jitter", defaults.Jitter)
+	viper.SetDefault("retry-statuses", defaults.RetryableStatuses)
+
+	flags.IntVar(&options.maxAttempts, "retry-max-attempts", viper.GetInt("retry-max-attempts"), "Max attempts to deliver each event to Codefresh, 1 disables retries [$RETRY_MAX_ATTEMPTS]")
+	flags.DurationVar(&options.baseDelay, "retry-base-delay", viper.GetDuration("retry-base-delay"), "Delay before the first retry, doubled on each attempt [$RETRY_BASE_DELAY]")
+	flags.DurationVar(&options.maxDelay, "retry-max-delay", viper.GetDuration("retry-max-delay"), "Max delay between attempts, also caps Retry-After [$RETRY_MAX_DELAY]")
+	flags.Float64Var(&options.jitter, "retry-jitter", viper.GetFloat64("retry-jitter"), "Fraction (0-1) of each delay to randomize [$RETRY_JITTER]")
+	flags.StringSliceVar(&options.retryableStatuses, "retry-statuses", viper.GetStringSlice("retry-statuses"), "Response status codes or classes to retry, e.g. 429,5xx [$RETRY_STATUSES]")
+}
+
+func (o retryCmdOptions) policy() codefresh.RetryPolicy {
+	policy := codefresh.RetryPolicy{
+		MaxAttempts:       o.maxAttempts,
+		BaseDelay:         o.baseDelay,
+		MaxDelay:          o.maxDelay,
+		Jitter:            o.jitter,
+		RetryableStatuses: o.retryableStatuses,
+	}
+	dieOnError(policy.Validate())
+	return policy
+}
+
+func buildCodefreshClient(eventReportingURL string, token string, httpClient *http.Client, retry codefresh.RetryPolicy, lgr logger.Logger) *codefresh.Codefresh {
 	httpHeaders := http.Header{}
 	httpHeaders.Add("User-Agent", fmt.Sprintf("codefresh-engine-v%s", version))
 	httpHeaders.Add("Codefresh-User-Agent-Type", "engine")
@@ -56,9 +102,29 @@ func buildCodefreshClient(eventReportingURL string, token string, httpClient *ht
 		Logger:            lgr,
 		HTTPClient:        httpClient,
 		Headers:           httpHeaders,
+		Retry:             retry,
 	}
 }
 
+// withGracePeriod returns a context that is cancelled only after ctx has been done for the
+// grace period, so work that has to outlive ctx (like reporting the final state) is still bounded
+func withGracePeriod(ctx context.Context, grace time.Duration) (context.Context, context.CancelFunc) {
+	graceCtx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-graceCtx.Done():
+			return
+		}
+		select {
+		case <-time.After(grace):
+			cancel()
+		case <-graceCtx.Done():
+		}
+	}()
+	return graceCtx, cancel
+}
+
 func buildHTTPClient(rejectTLSUnauthorized bool) *http.Client {
 	var httpClient http.Client
 	if !rejectTLSUnauthorized {
@@ -88,25 +154,35 @@ func BuildKubeClient(host string, token string, b64crt string) (*kubernetes.Clie
 }
 
 func BuildTektonClient(configPath, contextName string, inCluster bool) (*versioned.Clientset, error) {
-	var config *rest.Config
-	var err error
-	if inCluster {
-		config, err = rest.InClusterConfig()
-	} else {
-		config, err = clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-			&clientcmd.ClientConfigLoadingRules{ExplicitPath: configPath},
-			&clientcmd.ConfigOverrides{
-				CurrentContext: contextName,
-			},
-		).ClientConfig()
-		if err != nil {
-			return BuildTektonClient(configPath, contextName, true) // try in-cluster
-		}
+	config, err := buildRestConfig(configPath, contextName, inCluster)
+	if err != nil {
+		return nil, err
 	}
 
+	return versioned.NewForConfig(config)
+}
+
+func BuildDynamicClient(configPath, contextName string, inCluster bool) (dynamic.Interface, error) {
+	config, err := buildRestConfig(configPath, contextName, inCluster)
 	if err != nil {
 		return nil, err
 	}
 
-	return versioned.NewForConfig(config)
+	return dynamic.NewForConfig(config)
+}
+
+func buildRestConfig(configPath, contextName string, inCluster bool) (*rest.Config, error) {
+	if inCluster {
+		return rest.InClusterConfig()
+	}
+	config, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
+		&clientcmd.ClientConfigLoadingRules{ExplicitPath: configPath},
+		&clientcmd.ConfigOverrides{
+			CurrentContext: contextName,
+		},
+	).ClientConfig()
+	if err != nil {
+		return buildRestConfig(configPath, contextName, true) // try in-cluster
+	}
+	return config, nil
 }
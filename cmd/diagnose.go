@@ -0,0 +1,132 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/codefresh-io/status-reporter/pkg/diagnostics"
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type (
+	// diagnoser collects the diagnostics of failed steps in the background, so the watch loop
+	// is not held up by the calls to the cluster. The events of a run being diagnosed are held
+	// back until it is done, so its failed steps are reported along with their diagnostics
+	diagnoser struct {
+		src       engine.LogSource
+		collector *diagnostics.Collector
+		// held maps the runs being diagnosed to the last event that came in meanwhile, if any
+		held    map[types.UID]*engine.Event
+		results chan diagnosis
+	}
+
+	// diagnosis is the state of a run whose failed steps were diagnosed
+	diagnosis struct {
+		ev      engine.Event
+		desired *reporter.Workflow
+	}
+)
+
+// newDiagnoser builds a diagnoser, or nil when diagnostics are disabled
+func newDiagnoser(eng engine.Engine, collector *diagnostics.Collector) *diagnoser {
+	src, ok := eng.(engine.LogSource)
+	if !ok || collector == nil {
+		return nil
+	}
+	return &diagnoser{
+		src:       src,
+		collector: collector,
+		held:      map[types.UID]*engine.Event{},
+		results:   make(chan diagnosis),
+	}
+}
+
+// Results returns the runs that were diagnosed, to be handled by the watch loop
+func (d *diagnoser) Results() <-chan diagnosis {
+	if d == nil {
+		return nil
+	}
+	return d.results
+}
+
+// Hold keeps the last event of a run being diagnosed, and tells if it did
+func (d *diagnoser) Hold(ev engine.Event) bool {
+	if d == nil {
+		return false
+	}
+	if _, ok := d.held[ev.Run.UID]; !ok {
+		return false
+	}
+	d.held[ev.Run.UID] = &ev
+	return true
+}
+
+// Done ends the diagnosis of a run, returning the event that was held back meanwhile if there was one
+func (d *diagnoser) Done(uid types.UID) (engine.Event, bool) {
+	ev := d.held[uid]
+	delete(d.held, uid)
+	if ev == nil {
+		return engine.Event{}, false
+	}
+	return *ev, true
+}
+
+// Start diagnoses the steps of desired that failed since they were last reported, and tells if there were any.
+// Their diagnostics are attached to desired, which is sent to Results once they are collected
+func (d *diagnoser) Start(ctx context.Context, ev engine.Event, workflow, desired *reporter.Workflow, log logger.Logger) bool {
+	if d == nil {
+		return false
+	}
+	var failed []string
+	for key, step := range desired.Steps {
+		if step.Status != reporter.WorkflowStepFailed && step.Status != reporter.WorkflowStepTimeout {
+			continue
+		}
+		if reported, ok := workflow.Steps[key]; ok && reported.Status.IsFinal() {
+			continue
+		}
+		failed = append(failed, key)
+	}
+	if len(failed) == 0 {
+		return false
+	}
+	d.held[ev.Run.UID] = nil
+	targets := d.src.LogTargets(ev.Run)
+	go func() {
+		for _, key := range failed {
+			step := desired.Steps[key]
+			for _, t := range targets {
+				if t.Key != key {
+					continue
+				}
+				diag, err := d.collector.Collect(ctx, t)
+				if err != nil {
+					log.Err(err, "failed to collect step diagnostics", "step", step.Name)
+				}
+				step.Diagnostics = diag
+			}
+		}
+		select {
+		case d.results <- diagnosis{ev: ev, desired: desired}:
+		case <-ctx.Done():
+		}
+	}()
+	return true
+}
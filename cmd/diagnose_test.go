@@ -0,0 +1,151 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/diagnostics"
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// logEngine is an engine whose runs have a single step, "build", that ran in pod ns/pod
+type logEngine struct {
+	engine.Engine
+}
+
+func (logEngine) LogTargets(*engine.Run) []logs.Target {
+	return []logs.Target{{Step: "build", Key: "build", Namespace: "ns", Pod: "pod", Containers: []string{"step"}}}
+}
+
+func newTestDiagnoser() *diagnoser {
+	client := fake.NewSimpleClientset(&corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+		Status: corev1.PodStatus{ContainerStatuses: []corev1.ContainerStatus{{
+			Name:  "step",
+			State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}},
+		}}},
+	})
+	return newDiagnoser(logEngine{}, diagnostics.NewCollector(client, diagnostics.Options{}))
+}
+
+func runEvent(uid string) engine.Event {
+	return engine.Event{Run: &engine.Run{UID: types.UID("uid-" + uid), Name: uid}}
+}
+
+func workflowWithStep(status reporter.WorkflowStepStatus) *reporter.Workflow {
+	w := reporter.NewWorkflow()
+	w.Status = reporter.WorkflowRunning
+	w.AddStep("build", &reporter.WorkflowStep{Name: "build", Status: status})
+	return w
+}
+
+func TestDiagnoserHoldsTheEventsOfARunUntilItIsDiagnosed(t *testing.T) {
+	d := newTestDiagnoser()
+	ctx := context.Background()
+	log := logger.New(logger.Options{})
+	first, second, third := runEvent("run"), runEvent("run"), runEvent("run")
+	other := runEvent("other")
+
+	if d.Hold(first) {
+		t.Fatal("held an event of a run that is not diagnosed")
+	}
+	desired := workflowWithStep(reporter.WorkflowStepFailed)
+	if !d.Start(ctx, first, reporter.NewWorkflow(), desired, log) {
+		t.Fatal("did not diagnose a failed step")
+	}
+	if !d.Hold(second) || !d.Hold(third) {
+		t.Error("did not hold the events of a run being diagnosed")
+	}
+	if d.Hold(other) {
+		t.Error("held an event of another run")
+	}
+
+	select {
+	case res := <-d.Results():
+		if res.ev.Run != first.Run || res.desired != desired {
+			t.Errorf("diagnosed %+v", res)
+		}
+		diag := res.desired.Steps["build"].Diagnostics
+		if diag == nil || len(diag.Containers) != 1 || diag.Containers[0].Reason != "OOMKilled" {
+			t.Errorf("diagnostics are %+v", diag)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the run was not diagnosed")
+	}
+
+	// only the last event that came in meanwhile is handled once the diagnosis is done
+	ev, ok := d.Done(first.Run.UID)
+	if !ok || ev.Run != third.Run {
+		t.Errorf("released %+v, %v", ev.Run, ok)
+	}
+	if d.Hold(runEvent("run")) {
+		t.Error("held an event once the diagnosis was done")
+	}
+}
+
+func TestDiagnoserReleasesNothingWhenNoEventCameIn(t *testing.T) {
+	d := newTestDiagnoser()
+	ev := runEvent("run")
+	if !d.Start(context.Background(), ev, reporter.NewWorkflow(), workflowWithStep(reporter.WorkflowStepTimeout), logger.New(logger.Options{})) {
+		t.Fatal("did not diagnose a timed out step")
+	}
+	<-d.Results()
+	if _, ok := d.Done(ev.Run.UID); ok {
+		t.Error("released an event")
+	}
+}
+
+func TestDiagnoserSkipsStepsThatDidNotNewlyFail(t *testing.T) {
+	d := newTestDiagnoser()
+	ctx := context.Background()
+	log := logger.New(logger.Options{})
+	ev := runEvent("run")
+
+	if d.Start(ctx, ev, reporter.NewWorkflow(), workflowWithStep(reporter.WorkflowStepSucceded), log) {
+		t.Error("diagnosed a successful step")
+	}
+	reported := workflowWithStep(reporter.WorkflowStepFailed)
+	if d.Start(ctx, ev, reported, workflowWithStep(reporter.WorkflowStepFailed), log) {
+		t.Error("diagnosed a step whose failure was reported")
+	}
+	if d.Hold(ev) {
+		t.Error("held an event of a run that is not diagnosed")
+	}
+}
+
+func TestDisabledDiagnoserDoesNothing(t *testing.T) {
+	var d *diagnoser
+	ev := runEvent("run")
+	if d.Start(context.Background(), ev, reporter.NewWorkflow(), workflowWithStep(reporter.WorkflowStepFailed), logger.New(logger.Options{})) || d.Hold(ev) {
+		t.Error("a disabled diagnoser diagnosed")
+	}
+	if d.Results() != nil {
+		t.Error("a disabled diagnoser has results")
+	}
+	if newDiagnoser(logEngine{}, nil) != nil {
+		t.Error("built a diagnoser without a collector")
+	}
+}
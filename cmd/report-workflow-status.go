@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"context"
 	"crypto/tls"
 	"fmt"
 	"net/http"
@@ -35,6 +36,7 @@ type reportWorkflowCmdOptions struct {
 	verbose               bool
 	rejectTLSUnauthorized bool
 	serverPort            string
+	retry                 retryCmdOptions
 }
 
 var (
@@ -45,7 +47,7 @@ var reportWorkflowCmd = &cobra.Command{
 	Use: "workflow",
 
 	Run: func(cmd *cobra.Command, args []string) {
-		reportWorkflowStatus(reportWorkflowOptions)
+		reportWorkflowStatus(cmd.Context(), reportWorkflowOptions)
 	},
 	Long: "Report workflow status",
 }
@@ -64,6 +66,7 @@ func init() {
 	reportWorkflowCmd.Flags().StringVar(&reportWorkflowOptions.codefreshToken, "codefresh-token", viper.GetString("codefresh-token"), "Codefresh API token [$CODEFRESH_TOKEN]")
 	reportWorkflowCmd.Flags().StringVar(&reportWorkflowOptions.eventReportingURL, "event-reporting-url", viper.GetString("event-reporting-url"), "The endpoint to report statuses to")
 	reportWorkflowCmd.Flags().StringVar(&reportWorkflowOptions.workflowID, "workflow", viper.GetString("workflow"), "Workflow ID to report the status [$WORKFLOW_ID]")
+	addRetryFlags(reportWorkflowCmd.Flags(), &reportWorkflowOptions.retry)
 
 	reportWorkflowCmd.Flags().VisitAll(func(f *pflag.Flag) {
 		if viper.IsSet(f.Name) && viper.GetString(f.Name) != "" {
@@ -77,7 +80,7 @@ func init() {
 	rootCmd.AddCommand(reportWorkflowCmd)
 }
 
-func reportWorkflowStatus(options reportWorkflowCmdOptions) {
+func reportWorkflowStatus(ctx context.Context, options reportWorkflowCmdOptions) {
 	log := logger.New(logger.Options{})
 
 	log.Info("Starting", "pid", os.Getpid(), "version", version)
@@ -108,6 +111,7 @@ func reportWorkflowStatus(options reportWorkflowCmdOptions) {
 			Logger:            log.Fork("module", "service", "service", "codefresh"),
 			HTTPClient:        &httpClient,
 			Headers:           httpHeaders,
+			Retry:             options.retry.policy(),
 		}
 	}
 
@@ -116,5 +120,5 @@ func reportWorkflowStatus(options reportWorkflowCmdOptions) {
 		Logger:       log,
 		WorkflowID:   options.workflowID,
 	}
-	dieOnError(wsr.Report(reporter.WorkflowFailed, nil))
+	dieOnError(wsr.Report(ctx, reporter.WorkflowFailed, nil))
 }
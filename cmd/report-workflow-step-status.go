@@ -16,8 +16,12 @@ package cmd
 
 import (
 	"context"
+	"fmt"
 	"os"
+	"sort"
+	"time"
 
+	"github.com/codefresh-io/status-reporter/pkg/argo"
 	"github.com/codefresh-io/status-reporter/pkg/logger"
 	"github.com/codefresh-io/status-reporter/pkg/reporter"
 	"github.com/spf13/cobra"
@@ -25,6 +29,9 @@ import (
 	"github.com/spf13/viper"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/tools/cache"
+	watchtools "k8s.io/client-go/tools/watch"
 )
 
 type reportWorkflowStepCmdOptions struct {
@@ -35,10 +42,12 @@ type reportWorkflowStepCmdOptions struct {
 	clusterToken          string
 	clusterNamespace      string
 	workflowID            string
-	step                  string
+	workflowName          string
 	verbose               bool
 	rejectTLSUnauthorized bool
 	serverPort            string
+	gracePeriod           time.Duration
+	retry                 retryCmdOptions
 }
 
 var (
@@ -49,24 +58,27 @@ var reportWorkflowStepCmd = &cobra.Command{
 	Use: "step",
 
 	Run: func(cmd *cobra.Command, args []string) {
-		reportWorkflowStepStatus(reportWorkflowStepOptions)
+		reportWorkflowStepStatus(cmd.Context(), reportWorkflowStepOptions)
 	},
-	Long: "Watches and reports workflow steps statusses",
+	Long: "Watches and reports the statuses of an Argo workflow and its steps",
 }
 
 func init() {
 	dieOnError(viper.BindEnv("codefresh-token", "CODEFRESH_TOKEN"))
 	dieOnError(viper.BindEnv("codefresh-host", "CODEFRESH_HOST"))
 	dieOnError(viper.BindEnv("workflow", "WORKFLOW_ID"))
+	dieOnError(viper.BindEnv("workflow-name", "WORKFLOW_NAME"))
 	dieOnError(viper.BindEnv("cluster-url", "CLUSTER_URL"))
 	dieOnError(viper.BindEnv("cluster-token", "CLUSTER_TOKEN"))
 	dieOnError(viper.BindEnv("cluster-namespace", "CLUSTER_NAMESPACE"))
 	dieOnError(viper.BindEnv("cluster-cert", "CLUSTER_CERT"))
 	dieOnError(viper.BindEnv("tls-reject-unauthorized", "NODE_TLS_REJECT_UNAUTHORIZED"))
+	dieOnError(viper.BindEnv("grace-period", "GRACE_PERIOD"))
 
 	viper.SetDefault("codefresh-host", defaultCodefreshHost)
 	viper.SetDefault("port", "8080")
 	viper.SetDefault("NODE_TLS_REJECT_UNAUTHORIZED", "1")
+	viper.SetDefault("grace-period", 20*time.Second)
 
 	reportWorkflowStepCmd.Flags().BoolVar(&reportWorkflowStepOptions.verbose, "verbose", viper.GetBool("verbose"), "Show more logs")
 	reportWorkflowStepCmd.Flags().BoolVar(&reportWorkflowStepOptions.rejectTLSUnauthorized, "tls-reject-unauthorized", viper.GetBool("NODE_TLS_REJECT_UNAUTHORIZED"), "Disable certificate validation for TLS connections")
@@ -77,6 +89,9 @@ func init() {
 	reportWorkflowStepCmd.Flags().StringVar(&reportWorkflowStepOptions.clusterNamespace, "cluster-namespace", viper.GetString("cluster-namespace"), "Kubernetes namespace where the workflow is running [$CLUSTER_NAMESPACE]")
 	reportWorkflowStepCmd.Flags().StringVar(&reportWorkflowStepOptions.clusterCert, "cluster-cert", viper.GetString("cluster-cert"), "Signed certificated authority (base64 encoded) [$CLUSTER_CERT]")
 	reportWorkflowStepCmd.Flags().StringVar(&reportWorkflowStepOptions.workflowID, "workflow", viper.GetString("workflow"), "Workflow ID to report the status [$WORKFLOW_ID]")
+	reportWorkflowStepCmd.Flags().StringVar(&reportWorkflowStepOptions.workflowName, "workflow-name", viper.GetString("workflow-name"), "Name of the Argo workflow to watch [$WORKFLOW_NAME]")
+	reportWorkflowStepCmd.Flags().DurationVar(&reportWorkflowStepOptions.gracePeriod, "grace-period", viper.GetDuration("grace-period"), "Time to report the workflow as terminated after receiving SIGTERM, should be shorter than the pod's termination grace period [$GRACE_PERIOD]")
+	addRetryFlags(reportWorkflowStepCmd.Flags(), &reportWorkflowStepOptions.retry)
 
 	reportWorkflowStepCmd.Flags().VisitAll(func(f *pflag.Flag) {
 		if viper.IsSet(f.Name) && viper.GetString(f.Name) != "" {
@@ -86,12 +101,12 @@ func init() {
 
 	dieOnError(reportWorkflowStepCmd.MarkFlagRequired("codefresh-token"))
 	dieOnError(reportWorkflowStepCmd.MarkFlagRequired("workflow"))
-	// dieOnError(reportWorkflowStepCmd.MarkFlagRequired("step"))
+	dieOnError(reportWorkflowStepCmd.MarkFlagRequired("workflow-name"))
 
 	rootCmd.AddCommand(reportWorkflowStepCmd)
 }
 
-func reportWorkflowStepStatus(options reportWorkflowStepCmdOptions) {
+func reportWorkflowStepStatus(ctx context.Context, options reportWorkflowStepCmdOptions) {
 	log := logger.New(logger.Options{})
 
 	log.Info("Starting watcher", "pid", os.Getpid(), "version", version)
@@ -99,50 +114,116 @@ func reportWorkflowStepStatus(options reportWorkflowStepCmdOptions) {
 		log.Info("Running in insecure mode", "NODE_TLS_REJECT_UNAUTHORIZED", options.rejectTLSUnauthorized)
 	}
 
+	// reports are made with reportCtx, so they keep going for the grace period after ctx is cancelled
+	reportCtx, cancelReports := withGracePeriod(ctx, options.gracePeriod)
+	defer cancelReports()
+
 	httpCleint := buildHTTPClient(options.rejectTLSUnauthorized)
-	cf := buildCodefreshClient(options.codefreshHost, options.codefreshToken, httpCleint, log)
+	cf := buildCodefreshClient(options.codefreshHost, options.codefreshToken, httpCleint, options.retry.policy(), log)
 	kclient, err := BuildKubeClient(options.clusterURL, options.clusterToken, options.clusterCert)
 	dieOnError(err)
-	res, err := kclient.CoreV1().Pods(options.clusterNamespace).List(context.Background(), metav1.ListOptions{})
+
+	workflow := reporter.NewWorkflow()
+	wsr := &reporter.WorkflowStatusReporter{
+		CodefreshAPI: cf,
+		Logger:       log,
+		WorkflowID:   options.workflowID,
+	}
+
+	// Request the API server only events for specific workflow
+	selector := argo.WorkflowEventsFieldSelector(options.workflowName)
+	events := kclient.CoreV1().Events(options.clusterNamespace)
+	list, err := events.List(ctx, metav1.ListOptions{FieldSelector: selector})
 	dieOnError(err)
-	log.Info("Found pods", "number", len(res.Items))
-	stream, err := kclient.CoreV1().Events(options.clusterNamespace).Watch(context.Background(), metav1.ListOptions{
-		// Request the API server only events for specific workflow
-		// LabelSelector: "",
+	sort.Slice(list.Items, func(i, j int) bool {
+		return eventTime(&list.Items[i]).Before(eventTime(&list.Items[j]))
+	})
+	for i := range list.Items {
+		if handleArgoEvent(reportCtx, workflow, &list.Items[i], wsr) {
+			log.Info("Workflow finished, exiting")
+			return
+		}
+	}
+
+	stream, err := watchtools.NewRetryWatcher(list.ResourceVersion, &cache.ListWatch{
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			opts.FieldSelector = selector
+			return events.Watch(ctx, opts)
+		},
 	})
 	dieOnError(err)
-	evChannel := stream.ResultChan()
+	defer stream.Stop()
+	log.Info("Watching workflow events", "workflow-name", options.workflowName, "namespace", options.clusterNamespace)
+
 	for {
-		if evChannel == nil {
-			break
-		}
 		select {
-		case obj, ok := <-evChannel:
-			if !ok {
-				log.Info("Event channel is closed")
-				continue
+		case <-ctx.Done():
+			log.Info("Reporting workflow as terminated", "grace-period", options.gracePeriod.String())
+			if err := workflow.Terminate(reportCtx, shutdownReason(), wsr); err != nil {
+				log.Err(err, "failed to report workflow termination")
 			}
-			ev := obj.Object.(*corev1.Event)
-			log.Info("Got event", "source", ev.Source.Component)
-			if ev.Source.Component != "workflow-controller" {
-				continue
-			}
-
-			if ev.InvolvedObject.Kind != "workflow" {
+			return
+		case <-stream.Done():
+			dieOnError(fmt.Errorf("workflow events watch has stopped"))
+		case obj := <-stream.ResultChan():
+			ev, ok := obj.Object.(*corev1.Event)
+			if !ok {
+				log.Err(fmt.Errorf("Invalid object type"), "unexpected object type from event", "type", obj.Type)
 				continue
 			}
-
-			// step finished
-			if ev.Reason == "WorkflowNodeSucceeded" {
-				wssr := reporter.WorkflowStepStatusReporter{
-					CodefreshAPI: cf,
-					Logger:       log,
-					WorkflowID:   options.workflowID,
-					Step:         options.step,
-				}
-				wssr.Report(reporter.WorkflowStepSucceded)
+			if handleArgoEvent(reportCtx, workflow, ev, wsr) {
+				log.Info("Workflow finished, exiting")
+				return
 			}
+		}
+	}
+}
 
+// handleArgoEvent reports the change an event of the workflow controller stands for,
+// and tells if the workflow has finished
+func handleArgoEvent(ctx context.Context, workflow *reporter.Workflow, ev *corev1.Event, wsr *reporter.WorkflowStatusReporter) bool {
+	if !argo.IsWorkflowEvent(ev) {
+		return false
+	}
+	desired := reporter.NewWorkflow()
+	desired.Status = reporter.WorkflowRunning
+	if status, ok := argo.GetWorkflowEventStatus(ev); ok {
+		desired.Status = status
+		if status.IsFailure() {
+			desired.Err = argo.EventError(ev)
+		}
+	} else if status, ok := argo.GetNodeEventStatus(ev); ok {
+		node := argo.GetNodeName(ev)
+		if node == "" {
+			return false
 		}
+		// named like the steps reported from the workflow itself, keyed by the full name that is unique
+		step := &reporter.WorkflowStep{Name: argo.NodeDisplayName(node), Status: status}
+		if status == reporter.WorkflowStepRunning {
+			step.StartedAt = eventTime(ev)
+		} else {
+			step.FinishedAt = eventTime(ev)
+		}
+		if status == reporter.WorkflowStepFailed {
+			step.Err = argo.EventError(ev)
+		}
+		desired.AddStep(node, step)
+	} else {
+		return false
+	}
+	wsr.Logger.Info("Got event", "reason", ev.Reason, "message", ev.Message)
+	if err := workflow.Sync(ctx, desired, wsr); err != nil {
+		wsr.Logger.Err(err, "failed to report workflow status")
+	}
+	return workflow.Status.IsFinal()
+}
+
+func eventTime(ev *corev1.Event) time.Time {
+	if !ev.LastTimestamp.IsZero() {
+		return ev.LastTimestamp.Time
+	}
+	if !ev.EventTime.IsZero() {
+		return ev.EventTime.Time
 	}
+	return ev.CreationTimestamp.Time
 }
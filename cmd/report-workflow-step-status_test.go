@@ -0,0 +1,128 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/argo"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// recordingAPI records the reports it is sent
+type recordingAPI struct {
+	reports []string
+}
+
+func (r *recordingAPI) ReportWorkflowStaus(_ context.Context, _ string, status reporter.WorkflowStatus, err error) error {
+	r.reports = append(r.reports, fmt.Sprintf("workflow:%s:%v", status, err))
+	return nil
+}
+
+func (r *recordingAPI) ReportWorkflowStepStaus(_ context.Context, _ string, step reporter.WorkflowStep) error {
+	r.reports = append(r.reports, fmt.Sprintf("step:%s:%s", step.Name, step.Status))
+	return nil
+}
+
+func (r *recordingAPI) ReportWorkflowVariables(context.Context, string, []reporter.Variable) error {
+	return nil
+}
+
+func argoEvent(reason, message string) *corev1.Event {
+	return &corev1.Event{
+		InvolvedObject: corev1.ObjectReference{Kind: argo.WorkflowKind, Name: "wf"},
+		Source:         corev1.EventSource{Component: argo.ControllerComponent},
+		Reason:         reason,
+		Message:        message,
+	}
+}
+
+func TestHandleArgoEventEndsOnTheFinalWorkflowEvent(t *testing.T) {
+	tests := []struct {
+		name   string
+		events []*corev1.Event
+		want   []string
+	}{
+		{
+			name: "succeeded",
+			events: []*corev1.Event{
+				argoEvent(argo.ReasonWorkflowRunning, "Workflow Running"),
+				argoEvent(argo.ReasonNodeRunning, "Running node wf"),
+				argoEvent(argo.ReasonNodeRunning, "Running node wf.build"),
+				argoEvent(argo.ReasonNodeSucceeded, "Succeeded node wf.build"),
+				argoEvent(argo.ReasonWorkflowSucceeded, "Workflow completed"),
+			},
+			want: []string{
+				"workflow:running:<nil>",
+				"step:build:running",
+				"step:build:success",
+				"workflow:success:<nil>",
+			},
+		},
+		{
+			name: "failed",
+			events: []*corev1.Event{
+				argoEvent(argo.ReasonWorkflowRunning, "Workflow Running"),
+				argoEvent(argo.ReasonNodeRunning, "Running node wf[0].test"),
+				argoEvent(argo.ReasonNodeFailed, "Failed node wf[0].test: exit code 1"),
+				argoEvent(argo.ReasonWorkflowFailed, "child failed"),
+			},
+			want: []string{
+				"workflow:running:<nil>",
+				"step:test:running",
+				"step:test:error",
+				"workflow:error:WorkflowFailed: child failed",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := &recordingAPI{}
+			wsr := &reporter.WorkflowStatusReporter{CodefreshAPI: api, Logger: logger.New(logger.Options{}), WorkflowID: "wf"}
+			workflow := reporter.NewWorkflow()
+			for i, ev := range tt.events {
+				last := i == len(tt.events)-1
+				if finished := handleArgoEvent(context.Background(), workflow, ev, wsr); finished != last {
+					t.Fatalf("event %s tells finished %v", ev.Reason, finished)
+				}
+			}
+			if !reflect.DeepEqual(api.reports, tt.want) {
+				t.Errorf("reported %q, want %q", api.reports, tt.want)
+			}
+		})
+	}
+}
+
+func TestHandleArgoEventIgnoresOtherEvents(t *testing.T) {
+	api := &recordingAPI{}
+	wsr := &reporter.WorkflowStatusReporter{CodefreshAPI: api, Logger: logger.New(logger.Options{}), WorkflowID: "wf"}
+	other := argoEvent(argo.ReasonWorkflowSucceeded, "Workflow completed")
+	other.Source.Component = "kubelet"
+
+	for _, ev := range []*corev1.Event{other, argoEvent("WorkflowUnknown", "")} {
+		if handleArgoEvent(context.Background(), reporter.NewWorkflow(), ev, wsr) {
+			t.Errorf("event %s from %s finished the workflow", ev.Reason, ev.Source.Component)
+		}
+	}
+	if len(api.reports) != 0 {
+		t.Errorf("reported %q", api.reports)
+	}
+}
@@ -15,19 +15,54 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
 	"github.com/spf13/cobra"
 )
 
 var version string
 
+// shutdownSignal is the signal that cancelled the command context, it is set before
+// the context is cancelled so it is safe to read once the context is done
+var shutdownSignal os.Signal
+
 var rootCmd = &cobra.Command{
 	Use:     "status-reporter",
 	Version: version,
 	Long:    "Watches and reports workflow and steps statusses back to Codefresh",
 }
 
-// Execute - execute the root command
+// Execute - execute the root command, its context is cancelled on SIGTERM or SIGINT.
+// A second signal exits immediately
 func Execute() {
-	err := rootCmd.Execute()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	log := logger.New(logger.Options{})
+	sigs := make(chan os.Signal, 2)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		shutdownSignal = <-sigs
+		log.Info("Received signal, shutting down", "signal", shutdownSignal.String())
+		cancel()
+		sig := <-sigs
+		log.Info("Received signal again, exiting", "signal", sig.String())
+		exit(1)
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
 	dieOnError(err)
 }
+
+// shutdownReason describes why the command was stopped, for reporting what it was doing as terminated
+func shutdownReason() error {
+	if shutdownSignal == nil {
+		return fmt.Errorf("status reporter was stopped before the workflow finished")
+	}
+	return fmt.Errorf("status reporter was stopped by %s before the workflow finished", shutdownSignal)
+}
@@ -0,0 +1,567 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/codefresh"
+	"github.com/codefresh-io/status-reporter/pkg/dispatcher"
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/outbox"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+	"github.com/codefresh-io/status-reporter/pkg/sink"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+const (
+	sinkCodefresh = "codefresh"
+	sinkFile      = "file"
+	sinkStdout    = "stdout"
+	sinkWebhook   = "webhook"
+	sinkGitHub    = "github"
+	sinkGitLab    = "gitlab"
+	sinkBitbucket = "bitbucket"
+	sinkSlack     = "slack"
+	sinkTeams     = "teams"
+)
+
+type sinkCmdOptions struct {
+	names   []string
+	file    string
+	filters []string
+
+	webhookURL          string
+	webhookTemplate     string
+	webhookTemplateFile string
+	webhookHeaders      []string
+	webhookSecret       string
+
+	commitRepositoryKey string
+	commitSHAKey        string
+	commitTokenKey      string
+	commitProviderKey   string
+	commitURLKey        string
+
+	statusContext   string
+	statusTargetURL string
+	statusSteps     bool
+
+	githubURL       string
+	githubMode      string
+	githubToken     string
+	gitlabURL       string
+	gitlabToken     string
+	bitbucketURL    string
+	bitbucketToken  string
+	bitbucketServer bool
+
+	slackWebhookURL string
+	slackToken      string
+	slackChannel    string
+	slackURL        string
+	teamsWebhookURL string
+
+	notifyOnlyFailures  bool
+	notifyPipelines     []string
+	notifyTemplate      string
+	notifyTemplateFile  string
+	notifyTargetURL     string
+	notifyPipelineLabel string
+}
+
+// sinkState is what the sinks know about the workflows besides their reports
+type sinkState struct {
+	ttl       time.Duration
+	commits   *sink.Commits
+	runs      *sink.Runs
+	checkRuns *sink.CheckRuns
+	threads   *sink.SlackThreads
+	// codefresh is the codefresh sink, if it is selected
+	codefresh *codefresh.Codefresh
+	// outboxes of the sinks that report the commits and runs of workflows,
+	// whose pending events are replayed once the run of their workflow is recorded
+	outboxes []*outbox.Outbox
+	logger   logger.Logger
+}
+
+func newSinkState(ttl time.Duration, log logger.Logger) *sinkState {
+	return &sinkState{
+		ttl:       ttl,
+		logger:    log,
+		commits:   sink.NewCommits(ttl),
+		runs:      sink.NewRuns(ttl),
+		checkRuns: sink.NewCheckRuns(ttl),
+		threads:   sink.NewSlackThreads(ttl),
+	}
+}
+
+// replay replays the pending events of a workflow whose run was recorded
+func (s *sinkState) replay(ctx context.Context, workflowID string) {
+	for _, ob := range s.outboxes {
+		if err := ob.ReplayWorkflow(ctx, workflowID); err != nil {
+			s.logger.Err(err, "failed to replay outbox events", "workflow", workflowID)
+		}
+	}
+}
+
+// forget lets the sinks forget a workflow once its run is gone
+func (s *sinkState) forget(workflowID string) {
+	s.commits.Forget(workflowID)
+	s.runs.Forget(workflowID)
+	s.checkRuns.Forget(workflowID)
+	s.threads.Forget(workflowID)
+	if s.codefresh != nil {
+		s.codefresh.Forget(workflowID)
+	}
+}
+
+func addSinkFlags(flags *pflag.FlagSet, options *sinkCmdOptions) {
+	dieOnError(viper.BindEnv("sinks", "SINKS"))
+	dieOnError(viper.BindEnv("sink-file", "SINK_FILE"))
+	dieOnError(viper.BindEnv("sink-filter", "SINK_FILTER"))
+	dieOnError(viper.BindEnv("webhook-url", "WEBHOOK_URL"))
+	dieOnError(viper.BindEnv("webhook-template", "WEBHOOK_TEMPLATE"))
+	dieOnError(viper.BindEnv("webhook-template-file", "WEBHOOK_TEMPLATE_FILE"))
+	dieOnError(viper.BindEnv("webhook-headers", "WEBHOOK_HEADERS"))
+	dieOnError(viper.BindEnv("webhook-secret", "WEBHOOK_SECRET"))
+	dieOnError(viper.BindEnv("commit-repository-key", "COMMIT_REPOSITORY_KEY"))
+	dieOnError(viper.BindEnv("commit-sha-key", "COMMIT_SHA_KEY"))
+	dieOnError(viper.BindEnv("commit-token-key", "COMMIT_TOKEN_KEY"))
+	dieOnError(viper.BindEnv("commit-provider-key", "COMMIT_PROVIDER_KEY"))
+	dieOnError(viper.BindEnv("commit-api-url-key", "COMMIT_API_URL_KEY"))
+	dieOnError(viper.BindEnv("commit-status-context", "COMMIT_STATUS_CONTEXT"))
+	dieOnError(viper.BindEnv("commit-status-target-url", "COMMIT_STATUS_TARGET_URL"))
+	dieOnError(viper.BindEnv("commit-status-steps", "COMMIT_STATUS_STEPS"))
+	dieOnError(viper.BindEnv("github-url", "GITHUB_API_URL"))
+	dieOnError(viper.BindEnv("github-mode", "GITHUB_MODE"))
+	dieOnError(viper.BindEnv("github-token", "GITHUB_TOKEN"))
+	dieOnError(viper.BindEnv("gitlab-url", "GITLAB_API_URL"))
+	dieOnError(viper.BindEnv("gitlab-token", "GITLAB_TOKEN"))
+	dieOnError(viper.BindEnv("bitbucket-url", "BITBUCKET_API_URL"))
+	dieOnError(viper.BindEnv("bitbucket-token", "BITBUCKET_TOKEN"))
+	dieOnError(viper.BindEnv("bitbucket-server", "BITBUCKET_SERVER"))
+	dieOnError(viper.BindEnv("slack-webhook-url", "SLACK_WEBHOOK_URL"))
+	dieOnError(viper.BindEnv("slack-token", "SLACK_TOKEN"))
+	dieOnError(viper.BindEnv("slack-channel", "SLACK_CHANNEL"))
+	dieOnError(viper.BindEnv("slack-url", "SLACK_API_URL"))
+	dieOnError(viper.BindEnv("teams-webhook-url", "TEAMS_WEBHOOK_URL"))
+	dieOnError(viper.BindEnv("notify-only-failures", "NOTIFY_ONLY_FAILURES"))
+	dieOnError(viper.BindEnv("notify-pipelines", "NOTIFY_PIPELINES"))
+	dieOnError(viper.BindEnv("notify-template", "NOTIFY_TEMPLATE"))
+	dieOnError(viper.BindEnv("notify-template-file", "NOTIFY_TEMPLATE_FILE"))
+	dieOnError(viper.BindEnv("notify-target-url", "NOTIFY_TARGET_URL"))
+	dieOnError(viper.BindEnv("notify-pipeline-label", "NOTIFY_PIPELINE_LABEL"))
+
+	viper.SetDefault("commit-repository-key", "git-repository")
+	viper.SetDefault("commit-sha-key", "git-sha")
+	viper.SetDefault("commit-token-key", "git-token")
+	viper.SetDefault("commit-provider-key", "git-provider")
+	viper.SetDefault("commit-api-url-key", "git-api-url")
+	viper.SetDefault("commit-status-context", "codefresh")
+	viper.SetDefault("commit-status-steps", true)
+	viper.SetDefault("github-url", sink.DefaultGitHubURL)
+	viper.SetDefault("github-mode", sink.GitHubStatuses)
+	viper.SetDefault("gitlab-url", sink.DefaultGitLabURL)
+	viper.SetDefault("slack-url", sink.DefaultSlackURL)
+	viper.SetDefault("notify-pipeline-label", "tekton.dev/pipeline")
+
+	flags.StringSliceVar(&options.names, "sinks", []string{sinkCodefresh}, fmt.Sprintf("Destinations every report is sent to, any of %v [$SINKS]", sinkNames()))
+	flags.StringVar(&options.file, "sink-file", viper.GetString("sink-file"), "File the file sink appends reports to, as lines of JSON [$SINK_FILE]")
+	flags.StringSliceVar(&options.filters, "sink-filter", nil, "Statuses a sink reports, e.g. stdout=error|timeout. Sinks without a filter report every status [$SINK_FILTER]")
+	flags.StringVar(&options.webhookURL, "webhook-url", viper.GetString("webhook-url"), "URL the webhook sink posts reports to [$WEBHOOK_URL]")
+	flags.StringVar(&options.webhookTemplate, "webhook-template", viper.GetString("webhook-template"), "Go template of the webhook body, rendered from each report. Reports are sent as JSON when empty [$WEBHOOK_TEMPLATE]")
+	flags.StringVar(&options.webhookTemplateFile, "webhook-template-file", viper.GetString("webhook-template-file"), "File holding the Go template of the webhook body, instead of \"webhook-template\" [$WEBHOOK_TEMPLATE_FILE]")
+	flags.StringSliceVar(&options.webhookHeaders, "webhook-headers", nil, "Headers added to webhook requests, e.g. Authorization:Bearer xyz [$WEBHOOK_HEADERS]")
+	flags.StringVar(&options.webhookSecret, "webhook-secret", viper.GetString("webhook-secret"), fmt.Sprintf("Secret to sign webhook requests with, the HMAC-SHA256 of the body is sent in %s [$WEBHOOK_SECRET]", sink.SignatureHeader))
+	flags.StringVar(&options.commitRepositoryKey, "commit-repository-key", viper.GetString("commit-repository-key"), "Annotation, or else param, of a run holding the full name (owner/name) of the repository it built, for source control sinks [$COMMIT_REPOSITORY_KEY]")
+	flags.StringVar(&options.commitSHAKey, "commit-sha-key", viper.GetString("commit-sha-key"), "Annotation, or else param, of a run holding the SHA of the commit it built, for source control sinks [$COMMIT_SHA_KEY]")
+	flags.StringVar(&options.commitTokenKey, "commit-token-key", viper.GetString("commit-token-key"), "Annotation, or else param, of a run holding the token of the source control API, which takes precedence over the sink's token [$COMMIT_TOKEN_KEY]")
+	flags.StringVar(&options.commitProviderKey, "commit-provider-key", viper.GetString("commit-provider-key"), fmt.Sprintf("Annotation, or else param, of a run holding the provider hosting the repository it built (%s, %s or %s), only its sink reports the run. Every source control sink does when it is not set [$COMMIT_PROVIDER_KEY]", sink.ProviderGitHub, sink.ProviderGitLab, sink.ProviderBitbucket))
+	flags.StringVar(&options.commitURLKey, "commit-api-url-key", viper.GetString("commit-api-url-key"), "Annotation, or else param, of a run holding the URL of the source control API, which takes precedence over the sink's URL. The sink's token is not sent to any other URL, the run must hold its own token [$COMMIT_API_URL_KEY]")
+	flags.StringVar(&options.statusContext, "commit-status-context", viper.GetString("commit-status-context"), "Name of the workflow status on commits, its steps are named <context>/<step> [$COMMIT_STATUS_CONTEXT]")
+	flags.StringVar(&options.statusTargetURL, "commit-status-target-url", viper.GetString("commit-status-target-url"), "URL the commit statuses link to, {workflow} is replaced with the workflow ID. Required by bitbucket [$COMMIT_STATUS_TARGET_URL]")
+	flags.BoolVar(&options.statusSteps, "commit-status-steps", viper.GetBool("commit-status-steps"), "Report the status of each step on commits besides the status of the workflow [$COMMIT_STATUS_STEPS]")
+	flags.StringVar(&options.githubURL, "github-url", viper.GetString("github-url"), "URL of the GitHub API [$GITHUB_API_URL]")
+	flags.StringVar(&options.githubMode, "github-mode", viper.GetString("github-mode"), fmt.Sprintf("Report to GitHub as commit %s or %s runs [$GITHUB_MODE]", sink.GitHubStatuses, sink.GitHubChecks))
+	flags.StringVar(&options.githubToken, "github-token", viper.GetString("github-token"), "GitHub API token [$GITHUB_TOKEN]")
+	flags.StringVar(&options.gitlabURL, "gitlab-url", viper.GetString("gitlab-url"), "URL of the GitLab API [$GITLAB_API_URL]")
+	flags.StringVar(&options.gitlabToken, "gitlab-token", viper.GetString("gitlab-token"), "GitLab API token [$GITLAB_TOKEN]")
+	flags.StringVar(&options.bitbucketURL, "bitbucket-url", viper.GetString("bitbucket-url"), fmt.Sprintf("URL of the Bitbucket API, %s when empty, or the root URL of Bitbucket Server [$BITBUCKET_API_URL]", sink.DefaultBitbucketURL))
+	flags.StringVar(&options.bitbucketToken, "bitbucket-token", viper.GetString("bitbucket-token"), "Bitbucket access token, or <user>:<app password> [$BITBUCKET_TOKEN]")
+	flags.BoolVar(&options.bitbucketServer, "bitbucket-server", viper.GetBool("bitbucket-server"), "Report to Bitbucket Server (Data Center) instead of Bitbucket Cloud [$BITBUCKET_SERVER]")
+	flags.StringVar(&options.slackWebhookURL, "slack-webhook-url", viper.GetString("slack-webhook-url"), "URL of the Slack incoming webhook notifications are posted to. Each notification is a message of its own [$SLACK_WEBHOOK_URL]")
+	flags.StringVar(&options.slackToken, "slack-token", viper.GetString("slack-token"), "Slack bot token, used instead of \"slack-webhook-url\" to thread the notifications of a workflow under its first message, which is updated when the workflow ends [$SLACK_TOKEN]")
+	flags.StringVar(&options.slackChannel, "slack-channel", viper.GetString("slack-channel"), "Slack channel the bot posts notifications to [$SLACK_CHANNEL]")
+	flags.StringVar(&options.slackURL, "slack-url", viper.GetString("slack-url"), "URL of the Slack Web API [$SLACK_API_URL]")
+	flags.StringVar(&options.teamsWebhookURL, "teams-webhook-url", viper.GetString("teams-webhook-url"), "URL of the Microsoft Teams incoming webhook notifications are posted to. Each notification is a card of its own, incoming webhooks can neither thread nor update messages [$TEAMS_WEBHOOK_URL]")
+	flags.BoolVar(&options.notifyOnlyFailures, "notify-only-failures", viper.GetBool("notify-only-failures"), "Notify only about the workflows and steps that failed [$NOTIFY_ONLY_FAILURES]")
+	flags.StringSliceVar(&options.notifyPipelines, "notify-pipelines", nil, "Glob patterns of the pipelines to notify about, e.g. deploy-*. Every pipeline when empty [$NOTIFY_PIPELINES]")
+	flags.StringVar(&options.notifyTemplate, "notify-template", viper.GetString("notify-template"), "Go template of the text of notifications, rendered from each notification [$NOTIFY_TEMPLATE]")
+	flags.StringVar(&options.notifyTemplateFile, "notify-template-file", viper.GetString("notify-template-file"), "File holding the Go template of the text of notifications, instead of \"notify-template\" [$NOTIFY_TEMPLATE_FILE]")
+	flags.StringVar(&options.notifyTargetURL, "notify-target-url", viper.GetString("notify-target-url"), "URL notifications link to, {workflow} is replaced with the workflow ID [$NOTIFY_TARGET_URL]")
+	flags.StringVar(&options.notifyPipelineLabel, "notify-pipeline-label", viper.GetString("notify-pipeline-label"), "Label of a run holding the name of its pipeline, the name of the run is used when it is not set [$NOTIFY_PIPELINE_LABEL]")
+}
+
+// selects tells if a sink is one of the selected ones
+func (o sinkCmdOptions) selects(name string) bool {
+	for _, n := range o.names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func sinkNames() []string {
+	return []string{sinkCodefresh, sinkFile, sinkStdout, sinkWebhook, sinkGitHub, sinkGitLab, sinkBitbucket, sinkSlack, sinkTeams}
+}
+
+// validate checks that every sink is known and has what it needs
+func (o sinkCmdOptions) validate() error {
+	if len(o.names) == 0 {
+		return fmt.Errorf("flag \"sinks\" requires at least one sink")
+	}
+	known := map[string]bool{}
+	for _, name := range sinkNames() {
+		known[name] = true
+	}
+	selected := map[string]bool{}
+	for _, name := range o.names {
+		if !known[name] {
+			return fmt.Errorf("unknown sink %q, expected any of %v", name, sinkNames())
+		}
+		selected[name] = true
+	}
+	if selected[sinkFile] && o.file == "" {
+		return fmt.Errorf("sink %q requires \"sink-file\"", sinkFile)
+	}
+	if selected[sinkWebhook] {
+		if o.webhookURL == "" {
+			return fmt.Errorf("sink %q requires \"webhook-url\"", sinkWebhook)
+		}
+		if _, err := o.webhookOptions(nil); err != nil {
+			return err
+		}
+	}
+	if selected[sinkGitHub] {
+		if _, err := sink.NewGitHub(nil, nil, o.githubOptions(nil)); err != nil {
+			return err
+		}
+	}
+	if selected[sinkBitbucket] {
+		if _, err := sink.NewBitbucket(nil, o.bitbucketOptions(nil)); err != nil {
+			return err
+		}
+	}
+	if selected[sinkSlack] {
+		slackOptions, err := o.slackOptions(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := sink.NewSlack(nil, nil, slackOptions); err != nil {
+			return err
+		}
+	}
+	if selected[sinkTeams] {
+		notificationOptions, err := o.notificationOptions(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := sink.NewTeams(nil, sink.TeamsOptions{NotificationOptions: notificationOptions, WebhookURL: o.teamsWebhookURL}); err != nil {
+			return err
+		}
+	}
+	filters, err := o.parseFilters()
+	if err != nil {
+		return err
+	}
+	for name := range filters {
+		if !selected[name] {
+			return fmt.Errorf("flag \"sink-filter\" refers to sink %q, which is not one of \"sinks\"", name)
+		}
+	}
+	return nil
+}
+
+// parseFilters maps each sink to the statuses it reports, from "<sink>=<status>|<status>"
+func (o sinkCmdOptions) parseFilters() (map[string][]string, error) {
+	filters := map[string][]string{}
+	for _, f := range o.filters {
+		parts := strings.SplitN(f, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid sink filter %q, expected <sink>=<status>|<status>", f)
+		}
+		filters[parts[0]] = append(filters[parts[0]], strings.Split(parts[1], "|")...)
+	}
+	return filters, nil
+}
+
+// webhookOptions builds the options of the webhook sink
+func (o sinkCmdOptions) webhookOptions(client *http.Client) (sink.WebhookOptions, error) {
+	options := sink.WebhookOptions{
+		Template:   o.webhookTemplate,
+		Headers:    http.Header{},
+		Secret:     o.webhookSecret,
+		HTTPClient: client,
+	}
+	if o.webhookTemplateFile != "" {
+		data, err := ioutil.ReadFile(o.webhookTemplateFile)
+		if err != nil {
+			return options, fmt.Errorf("failed to read webhook template: %w", err)
+		}
+		options.Template = string(data)
+	}
+	for _, h := range o.webhookHeaders {
+		parts := strings.SplitN(h, ":", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return options, fmt.Errorf("invalid webhook header %q, expected <name>:<value>", h)
+		}
+		options.Headers.Add(strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]))
+	}
+	if _, err := sink.NewWebhook(o.webhookURL, options); err != nil {
+		return options, err
+	}
+	return options, nil
+}
+
+// commitStatusOptions builds the options shared by the source control sinks
+func (o sinkCmdOptions) commitStatusOptions(url, token string, client *http.Client) sink.CommitStatusOptions {
+	return sink.CommitStatusOptions{
+		URL:        url,
+		Token:      token,
+		Context:    o.statusContext,
+		TargetURL:  o.statusTargetURL,
+		Steps:      o.statusSteps,
+		HTTPClient: client,
+	}
+}
+
+// githubOptions builds the options of the GitHub sink
+func (o sinkCmdOptions) githubOptions(client *http.Client) sink.GitHubOptions {
+	return sink.GitHubOptions{
+		CommitStatusOptions: o.commitStatusOptions(o.githubURL, o.githubToken, client),
+		Mode:                o.githubMode,
+	}
+}
+
+// bitbucketOptions builds the options of the Bitbucket sink
+func (o sinkCmdOptions) bitbucketOptions(client *http.Client) sink.BitbucketOptions {
+	return sink.BitbucketOptions{
+		CommitStatusOptions: o.commitStatusOptions(o.bitbucketURL, o.bitbucketToken, client),
+		Server:              o.bitbucketServer,
+	}
+}
+
+// notificationOptions builds the options shared by the notification sinks
+func (o sinkCmdOptions) notificationOptions(client *http.Client) (sink.NotificationOptions, error) {
+	options := sink.NotificationOptions{
+		Template:     o.notifyTemplate,
+		OnlyFailures: o.notifyOnlyFailures,
+		Pipelines:    o.notifyPipelines,
+		TargetURL:    o.notifyTargetURL,
+		HTTPClient:   client,
+	}
+	if o.notifyTemplateFile != "" {
+		data, err := ioutil.ReadFile(o.notifyTemplateFile)
+		if err != nil {
+			return options, fmt.Errorf("failed to read notification template: %w", err)
+		}
+		options.Template = string(data)
+	}
+	return options, nil
+}
+
+// slackOptions builds the options of the Slack sink
+func (o sinkCmdOptions) slackOptions(client *http.Client) (sink.SlackOptions, error) {
+	notificationOptions, err := o.notificationOptions(client)
+	return sink.SlackOptions{
+		NotificationOptions: notificationOptions,
+		WebhookURL:          o.slackWebhookURL,
+		Token:               o.slackToken,
+		Channel:             o.slackChannel,
+		URL:                 o.slackURL,
+	}, err
+}
+
+// sinkOutboxPath is the outbox of a sink, the codefresh sink keeps the outbox path
+// so its pending events are still replayed after other sinks are added
+func sinkOutboxPath(outboxPath, name string) string {
+	if name == sinkCodefresh {
+		return outboxPath
+	}
+	return outboxPath + "." + name
+}
+
+// reportsRuns tells if a sink reports what it knows about the runs of workflows
+// besides their reports, which it can not report until their runs are recorded
+func reportsRuns(name string) bool {
+	switch name {
+	case sinkGitHub, sinkGitLab, sinkBitbucket, sinkSlack, sinkTeams:
+		return true
+	}
+	return false
+}
+
+// recordRun remembers the run of a workflow, and the commit it built if it is known, for the sinks,
+// and then replays the events of the workflow that were left in their outboxes
+func (o sinkCmdOptions) recordRun(ctx context.Context, state *sinkState, eng engine.Engine, run *engine.Run, workflowID string) {
+	pipeline := run.Labels[o.notifyPipelineLabel]
+	if pipeline == "" {
+		pipeline = run.Name
+	}
+	state.runs.Set(workflowID, sink.Run{
+		Name:      run.Name,
+		Namespace: run.Namespace,
+		Pipeline:  pipeline,
+	})
+
+	var params map[string]string
+	if src, ok := eng.(engine.ParamSource); ok {
+		params = src.Params(run)
+	}
+	lookup := func(key string) string {
+		if key == "" {
+			return ""
+		}
+		if v := run.Annotations[key]; v != "" {
+			return v
+		}
+		return params[key]
+	}
+	commit := sink.Commit{
+		Repository: lookup(o.commitRepositoryKey),
+		SHA:        lookup(o.commitSHAKey),
+		Token:      lookup(o.commitTokenKey),
+		Provider:   lookup(o.commitProviderKey),
+		URL:        lookup(o.commitURLKey),
+	}
+	if commit.Repository == "" || commit.SHA == "" {
+		commit = sink.Commit{}
+	}
+	state.commits.Set(workflowID, commit)
+	state.replay(ctx, workflowID)
+}
+
+// buildSinks builds the destination of the reports. Each sink delivers its reports in the background
+// on its own, retrying them until they are delivered, so a sink that is slow or down does not hold
+// the others back. With an outbox, the reports of each sink are recorded in its own outbox before
+// they are queued, so they survive restarts. cf is nil unless the codefresh sink is selected, the other
+// sinks send with httpClient. The returned function waits for the pending reports to be delivered and
+// releases the sinks
+func buildSinks(ctx context.Context, options sinkCmdOptions, cf *codefresh.Codefresh, httpClient *http.Client, state *sinkState, outboxPath string, dispatchOptions dispatcher.Options, log logger.Logger) (reporter.CodefreshAPI, func()) {
+	filters, err := options.parseFilters()
+	dieOnError(err)
+
+	var closers []func() error
+	var queues []*dispatcher.Queue
+	var sinks []reporter.CodefreshAPI
+	mux := sink.NewMultiplexer(log.Fork("service", "sinks"))
+	for _, name := range options.names {
+		var api reporter.CodefreshAPI
+		switch name {
+		case sinkCodefresh:
+			state.codefresh = cf
+			api = cf
+		case sinkFile:
+			w, err := sink.OpenFile(options.file)
+			dieOnError(err)
+			closers = append(closers, w.Close)
+			api = w
+		case sinkStdout:
+			api = sink.NewWriter(os.Stdout)
+		case sinkWebhook:
+			webhookOptions, err := options.webhookOptions(httpClient)
+			dieOnError(err)
+			api, err = sink.NewWebhook(options.webhookURL, webhookOptions)
+			dieOnError(err)
+		case sinkGitHub:
+			api, err = sink.NewGitHub(state.commits, state.checkRuns, options.githubOptions(httpClient))
+			dieOnError(err)
+		case sinkGitLab:
+			api = sink.NewGitLab(state.commits, options.commitStatusOptions(options.gitlabURL, options.gitlabToken, httpClient))
+		case sinkBitbucket:
+			api, err = sink.NewBitbucket(state.commits, options.bitbucketOptions(httpClient))
+			dieOnError(err)
+		case sinkSlack:
+			slackOptions, err := options.slackOptions(httpClient)
+			dieOnError(err)
+			api, err = sink.NewSlack(state.runs, state.threads, slackOptions)
+			dieOnError(err)
+		case sinkTeams:
+			notificationOptions, err := options.notificationOptions(httpClient)
+			dieOnError(err)
+			api, err = sink.NewTeams(state.runs, sink.TeamsOptions{NotificationOptions: notificationOptions, WebhookURL: options.teamsWebhookURL})
+			dieOnError(err)
+		}
+		if outboxPath != "" {
+			queue := dispatcher.NewQueue(ctx, log.Fork("service", "dispatcher", "sink", name), dispatchOptions)
+			queues = append(queues, queue)
+			ob, err := outbox.Open(sinkOutboxPath(outboxPath, name), api, log.Fork("service", "outbox", "sink", name), outbox.Options{Queue: queue})
+			dieOnError(err)
+			closers = append(closers, ob.Close)
+			if reportsRuns(name) {
+				// replayed along with the runs of their workflows, and once every listed run was
+				// recorded, whatever is left, which belongs to runs that are gone
+				state.outboxes = append(state.outboxes, ob)
+				replayAll := time.AfterFunc(state.ttl, func() {
+					if err := ob.Replay(ctx); err != nil {
+						log.Err(err, "failed to replay outbox events", "sink", name)
+					}
+				})
+				closers = append(closers, func() error {
+					replayAll.Stop()
+					return nil
+				})
+			} else if err := ob.Replay(ctx); err != nil {
+				log.Err(err, "failed to replay outbox events", "sink", name)
+			}
+			api = ob
+		} else {
+			dsp := dispatcher.New(ctx, api, log.Fork("service", "dispatcher", "sink", name), dispatchOptions)
+			queues = append(queues, dsp.Queue)
+			api = dsp
+		}
+		// filtered reports are neither recorded nor queued
+		if statuses, ok := filters[name]; ok {
+			api = sink.NewFilter(api, statuses)
+		}
+		sinks = append(sinks, api)
+		mux.Add(name, api)
+	}
+
+	closeSinks := func() {
+		for _, q := range queues {
+			q.Close()
+		}
+		for _, c := range closers {
+			if err := c(); err != nil {
+				log.Err(err, "failed to close sink")
+			}
+		}
+	}
+	if len(sinks) == 1 {
+		return sinks[0], closeSinks
+	}
+	return mux, closeSinks
+}
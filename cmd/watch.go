@@ -18,33 +18,119 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/codefresh-io/status-reporter/pkg/codefresh"
+	"github.com/codefresh-io/status-reporter/pkg/control"
+	"github.com/codefresh-io/status-reporter/pkg/diagnostics"
+	"github.com/codefresh-io/status-reporter/pkg/dispatcher"
+	"github.com/codefresh-io/status-reporter/pkg/engine"
 	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/logs"
 	"github.com/codefresh-io/status-reporter/pkg/reporter"
-	"github.com/codefresh-io/status-reporter/pkg/tekton"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
-	tkn "github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
-	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+
+	// register the engines
+	_ "github.com/codefresh-io/status-reporter/pkg/argo"
+	_ "github.com/codefresh-io/status-reporter/pkg/job"
+	_ "github.com/codefresh-io/status-reporter/pkg/tekton"
+)
+
+const (
+	defaultWorkflowIDKey = "codefresh.io/workflow-id"
+	defaultEngine        = "tekton"
+
+	logSinkCodefresh = "codefresh"
+	logSinkStdout    = "stdout"
 )
 
 var watchWorkflowCmdOptions struct {
+	engine            string
 	codefreshToken    string
 	eventReportingURL string
 	clusterNamespace  string
 	configPath        string
 	contextName       string
 	workflowID        string
+	daemon            bool
+	allNamespaces     bool
+	labelSelector     string
+	workflowIDLabel   string
+	workflowIDAnnot   string
+	finishedTTL       time.Duration
+	gracePeriod       time.Duration
+	outboxPath        string
+	dispatchWorkers   int
+	dispatchQueueSize int
+	dispatchRetry     time.Duration
+	dispatchMaxRetry  time.Duration
 	inCluster         bool
+	informer          bool
+	resyncPeriod      time.Duration
+	stepPerContainer  bool
+	logSink           string
+	logReportingURL   string
+	logChunkSize      int
+	logFlushInterval  time.Duration
+	terminationURL    string
+	terminationPoll   time.Duration
+	approvalURL       string
+	approvalPoll      time.Duration
+	resultsMaxValue   int
+	resultsMaxTotal   int
+	resultsRedact     []string
+	diagnostics       bool
+	diagnosticsLines  int64
 	verbose           bool
+	retry             retryCmdOptions
+	sinks             sinkCmdOptions
 }
 
 var watchWorkflowCmd = &cobra.Command{
 	Use: "watch",
 
+	PreRunE: func(cmd *cobra.Command, args []string) error {
+		if !watchWorkflowCmdOptions.daemon && watchWorkflowCmdOptions.workflowID == "" {
+			return fmt.Errorf("required flag \"workflow\" not set")
+		}
+		if !watchWorkflowCmdOptions.allNamespaces && watchWorkflowCmdOptions.clusterNamespace == "" {
+			return fmt.Errorf("required flag \"cluster-namespace\" not set")
+		}
+		if !engine.IsRegistered(watchWorkflowCmdOptions.engine) {
+			return fmt.Errorf("unknown engine %q, expected one of %v", watchWorkflowCmdOptions.engine, engine.Names())
+		}
+		switch watchWorkflowCmdOptions.logSink {
+		case "", logSinkStdout:
+		case logSinkCodefresh:
+			if watchWorkflowCmdOptions.logReportingURL == "" {
+				return fmt.Errorf("flag \"log-sink\" %q requires \"log-reporting-url\"", logSinkCodefresh)
+			}
+		default:
+			return fmt.Errorf("unknown log sink %q, expected %q or %q", watchWorkflowCmdOptions.logSink, logSinkCodefresh, logSinkStdout)
+		}
+		if watchWorkflowCmdOptions.allNamespaces && !watchWorkflowCmdOptions.daemon {
+			return fmt.Errorf("flag \"all-namespaces\" requires \"daemon\"")
+		}
+		if err := watchWorkflowCmdOptions.sinks.validate(); err != nil {
+			return err
+		}
+		if usesCodefresh() && watchWorkflowCmdOptions.codefreshToken == "" {
+			return fmt.Errorf("required flag \"codefresh-token\" not set")
+		}
+		if err := variablesPolicy().Validate(); err != nil {
+			return fmt.Errorf("invalid \"results-redact\" pattern: %w", err)
+		}
+		return nil
+	},
 	Run: func(cmd *cobra.Command, args []string) {
-		watchWorkflowStatus()
+		watchWorkflowStatus(cmd.Context())
 	},
 	Long: "Watches and reports workflow statuses",
 }
@@ -53,21 +139,101 @@ func init() {
 	dieOnError(viper.BindEnv("codefresh-token", "CODEFRESH_TOKEN"))
 	dieOnError(viper.BindEnv("codefresh-host", "CODEFRESH_HOST"))
 	dieOnError(viper.BindEnv("workflow", "WORKFLOW_ID"))
+	dieOnError(viper.BindEnv("engine", "ENGINE"))
 	dieOnError(viper.BindEnv("cluster-namespace", "CLUSTER_NAMESPACE"))
 	dieOnError(viper.BindEnv("config-path", "CONFIG_PATH"))
 	dieOnError(viper.BindEnv("context-name", "CONTEXT_NAME"))
+	dieOnError(viper.BindEnv("outbox-path", "OUTBOX_PATH"))
+	dieOnError(viper.BindEnv("dispatch-workers", "DISPATCH_WORKERS"))
+	dieOnError(viper.BindEnv("dispatch-queue-size", "DISPATCH_QUEUE_SIZE"))
+	dieOnError(viper.BindEnv("dispatch-retry-delay", "DISPATCH_RETRY_DELAY"))
+	dieOnError(viper.BindEnv("dispatch-max-retry-delay", "DISPATCH_MAX_RETRY_DELAY"))
+	dieOnError(viper.BindEnv("informer", "INFORMER"))
+	dieOnError(viper.BindEnv("resync-period", "RESYNC_PERIOD"))
+	dieOnError(viper.BindEnv("daemon", "DAEMON"))
+	dieOnError(viper.BindEnv("all-namespaces", "ALL_NAMESPACES"))
+	dieOnError(viper.BindEnv("selector", "SELECTOR"))
+	dieOnError(viper.BindEnv("workflow-id-label", "WORKFLOW_ID_LABEL"))
+	dieOnError(viper.BindEnv("workflow-id-annotation", "WORKFLOW_ID_ANNOTATION"))
+	dieOnError(viper.BindEnv("finished-ttl", "FINISHED_TTL"))
+	dieOnError(viper.BindEnv("grace-period", "GRACE_PERIOD"))
+	dieOnError(viper.BindEnv("step-per-container", "STEP_PER_CONTAINER"))
+	dieOnError(viper.BindEnv("log-sink", "LOG_SINK"))
+	dieOnError(viper.BindEnv("log-reporting-url", "CODEFRESH_LOG_URL"))
+	dieOnError(viper.BindEnv("log-chunk-size", "LOG_CHUNK_SIZE"))
+	dieOnError(viper.BindEnv("log-flush-interval", "LOG_FLUSH_INTERVAL"))
+	dieOnError(viper.BindEnv("termination-url", "CODEFRESH_TERMINATION_URL"))
+	dieOnError(viper.BindEnv("termination-poll-interval", "TERMINATION_POLL_INTERVAL"))
+	dieOnError(viper.BindEnv("approval-url", "CODEFRESH_APPROVAL_URL"))
+	dieOnError(viper.BindEnv("approval-poll-interval", "APPROVAL_POLL_INTERVAL"))
+	dieOnError(viper.BindEnv("results-max-value-size", "RESULTS_MAX_VALUE_SIZE"))
+	dieOnError(viper.BindEnv("results-max-total-size", "RESULTS_MAX_TOTAL_SIZE"))
+	dieOnError(viper.BindEnv("results-redact", "RESULTS_REDACT"))
+	dieOnError(viper.BindEnv("diagnostics", "DIAGNOSTICS"))
+	dieOnError(viper.BindEnv("diagnostics-log-lines", "DIAGNOSTICS_LOG_LINES"))
 
 	viper.SetDefault("event-reporting-url", defaultCodefreshHost)
 	viper.SetDefault("port", "8080")
+	viper.SetDefault("dispatch-workers", 4)
+	viper.SetDefault("dispatch-queue-size", 100)
+	viper.SetDefault("dispatch-retry-delay", time.Second)
+	viper.SetDefault("dispatch-max-retry-delay", time.Minute)
+	viper.SetDefault("resync-period", 5*time.Minute)
+	viper.SetDefault("engine", defaultEngine)
+	viper.SetDefault("workflow-id-label", defaultWorkflowIDKey)
+	viper.SetDefault("workflow-id-annotation", defaultWorkflowIDKey)
+	viper.SetDefault("finished-ttl", 10*time.Minute)
+	viper.SetDefault("grace-period", 20*time.Second)
+	viper.SetDefault("log-chunk-size", 16*1024)
+	viper.SetDefault("log-flush-interval", time.Second)
+	viper.SetDefault("termination-poll-interval", 10*time.Second)
+	viper.SetDefault("approval-poll-interval", 10*time.Second)
+	defaultVariables := reporter.DefaultVariablesPolicy()
+	viper.SetDefault("results-max-value-size", defaultVariables.MaxValueSize)
+	viper.SetDefault("results-max-total-size", defaultVariables.MaxTotalSize)
+	viper.SetDefault("results-redact", defaultVariables.Redact)
+	viper.SetDefault("diagnostics", true)
+	viper.SetDefault("diagnostics-log-lines", 50)
 
 	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.verbose, "verbose", viper.GetBool("verbose"), "Show more logs")
-	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.codefreshToken, "codefresh-token", viper.GetString("codefresh-token"), "Codefresh API token [$CODEFRESH_TOKEN]")
-	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.eventReportingURL, "event-reporting-url", viper.GetString("event-reporting-url"), "Codefresh API host default [$CODEFRESH_HOST]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.codefreshToken, "codefresh-token", viper.GetString("codefresh-token"), "Codefresh API token, required by the codefresh sink, the codefresh log sink, termination requests and approvals [$CODEFRESH_TOKEN]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.eventReportingURL, "event-reporting-url", viper.GetString("event-reporting-url"), "Codefresh API host default, in daemon mode {workflow} is replaced with the ID of each workflow [$CODEFRESH_HOST]")
 	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.clusterNamespace, "cluster-namespace", viper.GetString("cluster-namespace"), "Kubernetes namespace where the workflow is running [$CLUSTER_NAMESPACE]")
 	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.configPath, "config-path", viper.GetString("config-path"), "Kubernetes config path to use [$CONFIG_PATH]")
 	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.contextName, "context-name", viper.GetString("context-name"), "Kubernetes context name [$CONTEXT_NAME]")
 	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.workflowID, "workflow", viper.GetString("workflow"), "Workflow ID to report the status [$WORKFLOW_ID]")
 	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.inCluster, "in-cluster", viper.GetBool("in-cluster"), "Should be true if running from inside the cluster")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.engine, "engine", viper.GetString("engine"), fmt.Sprintf("Workflow engine to watch, one of %v [$ENGINE]", engine.Names()))
+	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.daemon, "daemon", viper.GetBool("daemon"), fmt.Sprintf("Keep watching and reporting every matching run instead of exiting after the first one finishes. Runs whose final state was reported are annotated with %s and are not reported again [$DAEMON]", engine.ReportedAnnotation))
+	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.allNamespaces, "all-namespaces", viper.GetBool("all-namespaces"), "Watch runs in all namespaces, daemon mode only [$ALL_NAMESPACES]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.labelSelector, "selector", viper.GetString("selector"), "Label selector of the runs to watch [$SELECTOR]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.workflowIDLabel, "workflow-id-label", viper.GetString("workflow-id-label"), "Run label holding its workflow ID, daemon mode and the job engine only [$WORKFLOW_ID_LABEL]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.workflowIDAnnot, "workflow-id-annotation", viper.GetString("workflow-id-annotation"), "Run annotation holding its workflow ID, takes precedence over the label, daemon mode only [$WORKFLOW_ID_ANNOTATION]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.finishedTTL, "finished-ttl", viper.GetDuration("finished-ttl"), "How long to keep the state of finished runs, daemon mode only [$FINISHED_TTL]")
+	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.informer, "informer", viper.GetBool("informer"), "Watch runs with a shared informer instead of a list and watch loop [$INFORMER]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.resyncPeriod, "resync-period", viper.GetDuration("resync-period"), "How often to re-process every run even if it did not change, 0 disables resyncs [$RESYNC_PERIOD]")
+	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.stepPerContainer, "step-per-container", viper.GetBool("step-per-container"), "Report each step (container) of a Tekton task as a step of its own, named <task>/<step>, instead of a step per task [$STEP_PER_CONTAINER]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.logSink, "log-sink", viper.GetString("log-sink"), "Stream the logs of running steps to codefresh or stdout, empty disables log streaming. Supported by the tekton engine [$LOG_SINK]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.logReportingURL, "log-reporting-url", viper.GetString("log-reporting-url"), "Codefresh endpoint step logs are sent to, {workflow} is replaced with the workflow ID [$CODEFRESH_LOG_URL]")
+	watchWorkflowCmd.Flags().IntVar(&watchWorkflowCmdOptions.logChunkSize, "log-chunk-size", viper.GetInt("log-chunk-size"), "Bytes of log buffered before they are sent [$LOG_CHUNK_SIZE]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.logFlushInterval, "log-flush-interval", viper.GetDuration("log-flush-interval"), "How often buffered log lines are sent [$LOG_FLUSH_INTERVAL]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.terminationURL, "termination-url", viper.GetString("termination-url"), "Codefresh endpoint polled for termination requests, which cancel the run. {workflow} is replaced with the workflow ID, empty disables polling [$CODEFRESH_TERMINATION_URL]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.terminationPoll, "termination-poll-interval", viper.GetDuration("termination-poll-interval"), "How often to poll for termination requests [$TERMINATION_POLL_INTERVAL]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.approvalURL, "approval-url", viper.GetString("approval-url"), "Codefresh endpoint polled for the decisions about steps pending approval. {workflow} and {step} are replaced with the workflow ID and the step name, empty disables approvals [$CODEFRESH_APPROVAL_URL]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.approvalPoll, "approval-poll-interval", viper.GetDuration("approval-poll-interval"), "How often to poll for approval decisions [$APPROVAL_POLL_INTERVAL]")
+	watchWorkflowCmd.Flags().IntVar(&watchWorkflowCmdOptions.resultsMaxValue, "results-max-value-size", viper.GetInt("results-max-value-size"), "Bytes of each task or pipeline result reported, longer values are truncated. 0 disables the limit [$RESULTS_MAX_VALUE_SIZE]")
+	watchWorkflowCmd.Flags().IntVar(&watchWorkflowCmdOptions.resultsMaxTotal, "results-max-total-size", viper.GetInt("results-max-total-size"), "Bytes of the results reported with a single step or workflow, the results over it are dropped. 0 disables the limit [$RESULTS_MAX_TOTAL_SIZE]")
+	watchWorkflowCmd.Flags().StringSliceVar(&watchWorkflowCmdOptions.resultsRedact, "results-redact", viper.GetStringSlice("results-redact"), "Case-insensitive glob patterns of the result names whose values are redacted [$RESULTS_REDACT]")
+	watchWorkflowCmd.Flags().BoolVar(&watchWorkflowCmdOptions.diagnostics, "diagnostics", viper.GetBool("diagnostics"), "Attach the state of the containers, the pod warnings and the end of the log of failed steps to their status. Supported by the tekton engine [$DIAGNOSTICS]")
+	watchWorkflowCmd.Flags().Int64Var(&watchWorkflowCmdOptions.diagnosticsLines, "diagnostics-log-lines", viper.GetInt64("diagnostics-log-lines"), "Lines at the end of the log of each failed container to attach, 0 attaches none [$DIAGNOSTICS_LOG_LINES]")
+	watchWorkflowCmd.Flags().StringVar(&watchWorkflowCmdOptions.outboxPath, "outbox-path", viper.GetString("outbox-path"), "File to persist events in until they are delivered, replayed on restart. Sinks other than codefresh use <path>.<sink>, the events of the source control and chat sinks are replayed once the run of their workflow is seen. Should be on a persistent volume [$OUTBOX_PATH]")
+	watchWorkflowCmd.Flags().IntVar(&watchWorkflowCmdOptions.dispatchWorkers, "dispatch-workers", viper.GetInt("dispatch-workers"), "Number of queues delivering reports in the background, reports of a single workflow are always delivered in order [$DISPATCH_WORKERS]")
+	watchWorkflowCmd.Flags().IntVar(&watchWorkflowCmdOptions.dispatchQueueSize, "dispatch-queue-size", viper.GetInt("dispatch-queue-size"), "Number of reports each queue holds before the watcher waits for them to be delivered [$DISPATCH_QUEUE_SIZE]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.dispatchRetry, "dispatch-retry-delay", viper.GetDuration("dispatch-retry-delay"), "Delay before delivering a report that failed again, doubled on each attempt. Reports are retried until they are delivered [$DISPATCH_RETRY_DELAY]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.dispatchMaxRetry, "dispatch-max-retry-delay", viper.GetDuration("dispatch-max-retry-delay"), "Max delay between attempts to deliver a report [$DISPATCH_MAX_RETRY_DELAY]")
+	watchWorkflowCmd.Flags().DurationVar(&watchWorkflowCmdOptions.gracePeriod, "grace-period", viper.GetDuration("grace-period"), "Time to finish reporting after receiving SIGTERM, should be shorter than the pod's termination grace period [$GRACE_PERIOD]")
+	addRetryFlags(watchWorkflowCmd.Flags(), &watchWorkflowCmdOptions.retry)
+	addSinkFlags(watchWorkflowCmd.Flags(), &watchWorkflowCmdOptions.sinks)
 
 	watchWorkflowCmd.Flags().VisitAll(func(f *pflag.Flag) {
 		if viper.IsSet(f.Name) && viper.GetString(f.Name) != "" {
@@ -75,111 +241,510 @@ func init() {
 		}
 	})
 
-	dieOnError(watchWorkflowCmd.MarkFlagRequired("codefresh-token"))
-	dieOnError(watchWorkflowCmd.MarkFlagRequired("workflow"))
-	dieOnError(watchWorkflowCmd.MarkFlagRequired("cluster-namespace"))
-
 	rootCmd.AddCommand(watchWorkflowCmd)
 }
 
-func watchWorkflowStatus() {
+func watchWorkflowStatus(ctx context.Context) {
 	log := logger.New(logger.Options{})
 
-	log.Info("Starting watcher", "pid", os.Getpid(), "version", version)
+	log.Info("Starting watcher", "pid", os.Getpid(), "version", version, "engine", watchWorkflowCmdOptions.engine)
+
+	// reports are made with reportCtx, so they keep going for the grace period after ctx is cancelled
+	reportCtx, cancelReports := withGracePeriod(ctx, watchWorkflowCmdOptions.gracePeriod)
+	defer cancelReports()
 
 	httpClient := buildHTTPClient(true)
-	cf := buildCodefreshClient(watchWorkflowCmdOptions.eventReportingURL, watchWorkflowCmdOptions.codefreshToken, httpClient, log)
-	tektonClient, err := BuildTektonClient(watchWorkflowCmdOptions.configPath, watchWorkflowCmdOptions.contextName, watchWorkflowCmdOptions.inCluster)
+	var cf *codefresh.Codefresh
+	if usesCodefresh() {
+		cf = buildCodefreshClient(watchWorkflowCmdOptions.eventReportingURL, watchWorkflowCmdOptions.codefreshToken, httpClient, watchWorkflowCmdOptions.retry.policy(), log)
+		cf.LogReportingURL = watchWorkflowCmdOptions.logReportingURL
+		cf.TerminationURL = watchWorkflowCmdOptions.terminationURL
+		cf.ApprovalURL = watchWorkflowCmdOptions.approvalURL
+	}
+	restConfig, err := buildRestConfig(watchWorkflowCmdOptions.configPath, watchWorkflowCmdOptions.contextName, watchWorkflowCmdOptions.inCluster)
 	dieOnError(err)
-
-	watch, err := tektonClient.TektonV1beta1().PipelineRuns(watchWorkflowCmdOptions.clusterNamespace).Watch(context.TODO(), v1.ListOptions{
-		LabelSelector: fmt.Sprintf("tekton.dev/pipeline=%s", watchWorkflowCmdOptions.workflowID),
-		Watch:         true,
-	})
+	eng, err := engine.New(watchWorkflowCmdOptions.engine, restConfig, engine.Options{
+		StepPerContainer: watchWorkflowCmdOptions.stepPerContainer,
+		WorkflowIDLabel:  watchWorkflowCmdOptions.workflowIDLabel,
+	}, log.Fork("service", "watcher"))
+	dieOnError(err)
+	streamer, err := buildLogStreamer(reportCtx, eng, restConfig, cf, log.Fork("service", "logs"))
+	dieOnError(err)
+	poller := buildTerminationPoller(eng, cf, log.Fork("service", "control"))
+	approvals := buildApprovalPoller(eng, cf, log.Fork("service", "approvals"))
+	collector, err := buildDiagnosticsCollector(eng, restConfig)
 	dieOnError(err)
+	diag := newDiagnoser(eng, collector)
 
-	log.Info("Watching tekton pipelines", "namespace", watchWorkflowCmdOptions.clusterNamespace)
+	state := newSinkState(watchWorkflowCmdOptions.finishedTTL, log.Fork("service", "sinks"))
+	api, closeSinks := buildSinks(reportCtx, watchWorkflowCmdOptions.sinks, cf, httpClient, state, watchWorkflowCmdOptions.outboxPath, dispatcher.Options{
+		Workers:       watchWorkflowCmdOptions.dispatchWorkers,
+		QueueSize:     watchWorkflowCmdOptions.dispatchQueueSize,
+		RetryDelay:    watchWorkflowCmdOptions.dispatchRetry,
+		MaxRetryDelay: watchWorkflowCmdOptions.dispatchMaxRetry,
+		// reports that are still failing are given up on, the outbox keeps them for the next start
+		DrainTimeout: watchWorkflowCmdOptions.gracePeriod,
+	}, log)
+	defer closeSinks()
+
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	defer stopWatch()
+	var terminations <-chan string
+	if poller != nil {
+		go poller.Run(watchCtx)
+		terminations = poller.Requests()
+	}
+	var decisions <-chan control.Approval
+	if approvals != nil {
+		go approvals.Run(watchCtx)
+		decisions = approvals.Approvals()
+	}
+	watchOptions := engine.WatchOptions{
+		Namespace:     watchWorkflowCmdOptions.clusterNamespace,
+		LabelSelector: watchWorkflowCmdOptions.labelSelector,
+		ResyncPeriod:  watchWorkflowCmdOptions.resyncPeriod,
+		Informer:      watchWorkflowCmdOptions.informer,
+	}
+	if watchWorkflowCmdOptions.allNamespaces {
+		watchOptions.Namespace = metav1.NamespaceAll
+	}
+
+	if watchWorkflowCmdOptions.daemon {
+		if cf != nil && !strings.Contains(watchWorkflowCmdOptions.eventReportingURL, "{workflow}") {
+			log.Info("Event reporting URL has no {workflow} placeholder, all workflows will be reported to the same URL", "url", watchWorkflowCmdOptions.eventReportingURL)
+		}
+		events, err := eng.Watch(watchCtx, watchOptions)
+		dieOnError(err)
+		log.Info("Watching workflows in daemon mode", "namespace", watchOptions.Namespace, "selector", watchOptions.LabelSelector)
+		// runs keep going without the daemon, and are picked up again when it restarts,
+		// so they are not reported as terminated
+		watchWorkflowsDaemon(reportCtx, eng, events, terminations, decisions, api, state, streamer, diag, poller, approvals, log)
+		if streamer != nil {
+			streamer.Wait()
+		}
+		log.Info("Watcher stopped, waiting for pending reports")
+		return
+	}
+
+	watchOptions.LabelSelector = joinSelectors(eng.WorkflowSelector(watchWorkflowCmdOptions.workflowID), watchOptions.LabelSelector)
+	events, err := eng.Watch(watchCtx, watchOptions)
+	dieOnError(err)
+	log.Info("Watching workflow", "namespace", watchOptions.Namespace, "selector", watchOptions.LabelSelector)
 
 	workflow := reporter.NewWorkflow()
 	wsr := &reporter.WorkflowStatusReporter{
-		CodefreshAPI: cf,
+		CodefreshAPI: api,
 		Logger:       log,
 		WorkflowID:   watchWorkflowCmdOptions.workflowID,
+		Variables:    variablesPolicy(),
 	}
-
-	for ev := range watch.ResultChan() {
-		pr, ok := ev.Object.(*tkn.PipelineRun)
-		if !ok {
-			log.Err(fmt.Errorf("Invalid object type"), "unexpected object type from event")
-		}
-		switch workflow.Status {
-		case reporter.WorkflowPending:
-			if handleWorkflowPending(workflow, pr, wsr) != nil {
-				log.Err(err, "failed to report workflow status")
+	if poller != nil {
+		poller.Add(wsr.WorkflowID)
+	}
+	var lastRun *engine.Run
+watch:
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				break watch
 			}
-		case reporter.WorkflowRunning:
-			if handleWorkflowRunning(workflow, pr, wsr) != nil {
-				log.Err(err, "failed to report workflow status")
+			lastRun = ev.Run
+			watchWorkflowCmdOptions.sinks.recordRun(reportCtx, state, eng, ev.Run, wsr.WorkflowID)
+			if diag.Hold(ev) {
+				continue
 			}
-		}
-		if tekton.PipelineHasFinished(pr) {
-			watch.Stop()
-			if handleWorkflowFinished(workflow, pr, wsr) != nil {
-				log.Err(err, "failed to report workflow status")
+			if handleRunEvent(reportCtx, eng, workflow, ev, wsr, streamer, diag) {
+				break watch
+			}
+			addPendingApprovals(approvals, workflow, wsr.WorkflowID)
+		case res := <-diag.Results():
+			if syncRun(reportCtx, eng, workflow, res.ev.Run, res.desired, wsr, streamer) {
+				break watch
+			}
+			if ev, ok := diag.Done(res.ev.Run.UID); ok && handleRunEvent(reportCtx, eng, workflow, ev, wsr, streamer, diag) {
+				break watch
+			}
+			addPendingApprovals(approvals, workflow, wsr.WorkflowID)
+		case <-terminations:
+			// with nothing to cancel yet, or when cancelling failed, it is requested again on the next poll
+			if lastRun != nil && cancelRun(ctx, eng, lastRun, log) {
+				poller.Remove(wsr.WorkflowID)
+			}
+		case approval := <-decisions:
+			if lastRun != nil {
+				resolveApproval(ctx, eng, lastRun, approval, log)
 			}
-			break
 		}
 	}
 
-	log.Info("Workflow finished, exiting")
+	if poller != nil {
+		poller.Remove(wsr.WorkflowID)
+	}
+	if ctx.Err() != nil && !workflow.Status.IsFinal() {
+		log.Info("Reporting workflow as terminated", "grace-period", watchWorkflowCmdOptions.gracePeriod.String())
+		if err := workflow.Terminate(reportCtx, shutdownReason(), wsr); err != nil {
+			log.Err(err, "failed to report workflow termination")
+		}
+	}
+	if streamer != nil {
+		log.Info("Waiting for step logs to end")
+		streamer.Wait()
+	}
+
+	log.Info("Workflow finished, waiting for pending reports")
 }
 
-func handleWorkflowPending(workflow *reporter.Workflow, pr *tkn.PipelineRun, wsr *reporter.WorkflowStatusReporter) error {
-	if tekton.PipelineHasStarted(pr) {
-		workflow.Status = reporter.WorkflowRunning
-		for _, t := range pr.Status.TaskRuns {
-			workflow.Steps[t.PipelineTaskName] = &reporter.WorkflowStep{Status: reporter.WorkflowStepPending}
+// watchWorkflowsDaemon reports every run it gets, each to its own workflow,
+// until the events channel is closed
+func watchWorkflowsDaemon(ctx context.Context, eng engine.Engine, events <-chan engine.Event, terminations <-chan string, decisions <-chan control.Approval, api reporter.CodefreshAPI, state *sinkState, streamer *logs.Streamer, diag *diagnoser, poller *control.Poller, approvals *control.ApprovalPoller, log logger.Logger) {
+	type trackedRun struct {
+		run        *engine.Run
+		workflow   *reporter.Workflow
+		wsr        *reporter.WorkflowStatusReporter
+		finishedAt time.Time
+	}
+	runs := map[types.UID]*trackedRun{}
+	// several runs may report to the same workflow, which is only let go of along with its last run:
+	// tracked counts the runs of each workflow, and running the ones that have not finished
+	tracked, running := workflowRefs{}, workflowRefs{}
+
+	// stopControl stops polling for the termination requests and approvals of a workflow
+	stopControl := func(workflowID string) {
+		if poller != nil {
+			poller.Remove(workflowID)
+		}
+		if approvals != nil {
+			approvals.RemoveWorkflow(workflowID)
+		}
+	}
+	// finish lets go of a run once it finished
+	finish := func(run *trackedRun) {
+		run.finishedAt = time.Now()
+		if running.release(run.wsr.WorkflowID) {
+			stopControl(run.wsr.WorkflowID)
+		}
+	}
+	// untrack lets go of a run once it is gone
+	untrack := func(uid types.UID, run *trackedRun) {
+		delete(runs, uid)
+		if run.finishedAt.IsZero() {
+			finish(run)
+		}
+		if !tracked.release(run.wsr.WorkflowID) {
+			return
+		}
+		state.forget(run.wsr.WorkflowID)
+		if streamer != nil {
+			streamer.Forget(run.wsr.WorkflowID)
 		}
-		return wsr.Report(reporter.WorkflowRunning, nil)
 	}
-	return nil
-}
 
-func handleWorkflowRunning(workflow *reporter.Workflow, pr *tkn.PipelineRun, wsr *reporter.WorkflowStatusReporter) error {
-	for _, trs := range pr.Status.TaskRuns {
-		if len(trs.Status.Steps) == 0 {
-			wsr.Logger.Info("skipping task status report, steps are not running yet", "task", trs.PipelineTaskName)
-			continue
+	// handled updates the state of a run once one of its events was handled
+	handled := func(run *trackedRun, ev engine.Event, finished bool) {
+		if finished && run.finishedAt.IsZero() {
+			if !ev.Deleted {
+				markReported(ctx, eng, run.run, run.workflow.Status, run.wsr.Logger)
+			}
+			finish(run)
 		}
-		stepName := trs.PipelineTaskName
-		step := workflow.Steps[stepName]
-		if step.Name == "" {
-			step.Name = trs.Status.Steps[0].Name
+		if run.finishedAt.IsZero() {
+			addPendingApprovals(approvals, run.workflow, run.wsr.WorkflowID)
 		}
-		if tekton.HasStepStatusChanged(step, trs) {
-			newStatus, err := tekton.GetTaskStatus(trs)
-			if err != nil {
-				wsr.Logger.Err(err, "failed to get workflow step status")
-				continue
+		if ev.Deleted {
+			untrack(ev.Run.UID, run)
+		}
+	}
+
+	gc := time.NewTicker(time.Minute)
+	defer gc.Stop()
+	for {
+		select {
+		case <-gc.C:
+			for uid, run := range runs {
+				if !run.finishedAt.IsZero() && time.Since(run.finishedAt) > watchWorkflowCmdOptions.finishedTTL {
+					untrack(uid, run)
+				}
+			}
+		case workflowID := <-terminations:
+			// polled for again until every run of the workflow was cancelled
+			cancelled := true
+			for _, run := range runs {
+				if run.wsr.WorkflowID == workflowID && run.finishedAt.IsZero() {
+					cancelled = cancelRun(ctx, eng, run.run, run.wsr.Logger) && cancelled
+				}
+			}
+			if cancelled {
+				poller.Remove(workflowID)
 			}
-			step.Status = newStatus
-			if newStatus == reporter.WorkflowStepFailed {
-				if err = wsr.ReportStep(step.Name, reporter.WorkflowStepFailed, tekton.TaskHasFailed(trs)); err != nil {
-					wsr.Logger.Err(err, "failed to report workflow step status")
+		case approval := <-decisions:
+			for _, run := range runs {
+				if run.wsr.WorkflowID == approval.Workflow && run.finishedAt.IsZero() {
+					resolveApproval(ctx, eng, run.run, approval, run.wsr.Logger)
+				}
+			}
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			uid := ev.Run.UID
+			run, ok := runs[uid]
+			if !ok {
+				workflowID := getWorkflowID(ev.Run)
+				if workflowID == "" {
+					log.Info("Skipping run without workflow ID", "run", ev.Run.String())
+					continue
+				}
+				// runs whose final state was reported are not reported again, the sinks still learn
+				// about them for the reports that are left in the outbox. Runs that finished while no
+				// daemon was running are reported from the start, like any other run
+				if ev.Run.Annotations[engine.ReportedAnnotation] != "" {
+					watchWorkflowCmdOptions.sinks.recordRun(ctx, state, eng, ev.Run, workflowID)
+					if tracked[workflowID] == 0 {
+						state.forget(workflowID)
+					}
+					continue
 				}
+				run = &trackedRun{
+					workflow: reporter.NewWorkflow(),
+					wsr: &reporter.WorkflowStatusReporter{
+						CodefreshAPI: api,
+						Logger:       log.Fork(ev.Run.Kind, ev.Run.Name, "namespace", ev.Run.Namespace),
+						WorkflowID:   workflowID,
+						Variables:    variablesPolicy(),
+					},
+				}
+				runs[uid] = run
+				tracked.add(workflowID)
+				running.add(workflowID)
+				if poller != nil {
+					poller.Add(workflowID)
+				}
+			}
+			run.run = ev.Run
+			watchWorkflowCmdOptions.sinks.recordRun(ctx, state, eng, ev.Run, run.wsr.WorkflowID)
+			if diag.Hold(ev) {
+				continue
+			}
+			handled(run, ev, handleRunEvent(ctx, eng, run.workflow, ev, run.wsr, streamer, diag))
+		case res := <-diag.Results():
+			uid := res.ev.Run.UID
+			run, ok := runs[uid]
+			if !ok {
+				diag.Done(uid)
 				continue
 			}
-			if err = wsr.ReportStep(step.Name, newStatus, nil); err != nil {
-				wsr.Logger.Err(err, "failed to report workflow step status")
+			handled(run, res.ev, syncRun(ctx, eng, run.workflow, res.ev.Run, res.desired, run.wsr, streamer))
+			if ev, ok := diag.Done(uid); ok {
+				handled(run, ev, handleRunEvent(ctx, eng, run.workflow, ev, run.wsr, streamer, diag))
 			}
 		}
 	}
-	return nil
 }
 
-func handleWorkflowFinished(workflow *reporter.Workflow, pr *tkn.PipelineRun, wsr *reporter.WorkflowStatusReporter) error {
-	if err := tekton.PipelineHasFailed(pr); err != nil {
-		return wsr.Report(reporter.WorkflowFailed, err)
+// workflowRefs counts references to workflows
+type workflowRefs map[string]int
+
+func (r workflowRefs) add(workflowID string) {
+	r[workflowID]++
+}
+
+// release drops a reference to a workflow, and tells if it was the last one
+func (r workflowRefs) release(workflowID string) bool {
+	if r[workflowID]--; r[workflowID] > 0 {
+		return false
+	}
+	delete(r, workflowID)
+	return true
+}
+
+// handleRunEvent reports the changes in a run and starts streaming the logs of its new steps,
+// and tells if the workflow has finished. A run with failed steps to diagnose is reported
+// once their diagnostics are collected, with syncRun
+func handleRunEvent(ctx context.Context, eng engine.Engine, workflow *reporter.Workflow, ev engine.Event, wsr *reporter.WorkflowStatusReporter, streamer *logs.Streamer, diag *diagnoser) bool {
+	if workflow.Status.IsFinal() {
+		return true
+	}
+	if ev.Deleted && !eng.HasFinished(ev.Run) {
+		if err := wsr.Report(ctx, reporter.WorkflowFailed, fmt.Errorf("%s was deleted before it finished", ev.Run)); err != nil {
+			wsr.Logger.Err(err, "failed to report workflow status")
+		}
+		workflow.Status = reporter.WorkflowFailed
+		return true
+	}
+	desired, err := eng.Snapshot(ev.Run)
+	if err != nil {
+		wsr.Logger.Err(err, "failed to get workflow state", "run", ev.Run.String())
+		return false
+	}
+	if diag.Start(ctx, ev, workflow, desired, wsr.Logger) {
+		return false
+	}
+	return syncRun(ctx, eng, workflow, ev.Run, desired, wsr, streamer)
+}
+
+// syncRun reports the desired state of a run and starts streaming the logs of its new steps,
+// and tells if the workflow has finished
+func syncRun(ctx context.Context, eng engine.Engine, workflow *reporter.Workflow, run *engine.Run, desired *reporter.Workflow, wsr *reporter.WorkflowStatusReporter, streamer *logs.Streamer) bool {
+	if err := workflow.Sync(ctx, desired, wsr); err != nil {
+		wsr.Logger.Err(err, "failed to report workflow status")
+	}
+	if src, ok := eng.(engine.LogSource); ok && streamer != nil {
+		streamer.Stream(wsr.WorkflowID, src.LogTargets(run))
+	}
+	return workflow.Status.IsFinal()
+}
+
+// cancelRun asks the engine to stop a run, whose new state is reported once the engine stopped it,
+// and tells if it did not fail to
+func cancelRun(ctx context.Context, eng engine.Engine, run *engine.Run, log logger.Logger) bool {
+	canceller, ok := eng.(engine.Canceller)
+	if !ok {
+		return true
+	}
+	log.Info("Cancelling run", "run", run.String())
+	if err := canceller.Cancel(ctx, run); err != nil {
+		log.Err(err, "failed to cancel run", "run", run.String())
+		return false
+	}
+	return true
+}
+
+// markReported records on a run that its final state was reported, so that it is not reported again
+// after a restart. A run that could not be marked is reported again then
+func markReported(ctx context.Context, eng engine.Engine, run *engine.Run, status reporter.WorkflowStatus, log logger.Logger) {
+	marker, ok := eng.(engine.Marker)
+	if !ok {
+		return
+	}
+	if err := marker.MarkReported(ctx, run, string(status)); err != nil {
+		log.Err(err, "failed to mark run as reported", "run", run.String())
+	}
+}
+
+// usesCodefresh tells if anything is sent to or polled from Codefresh
+func usesCodefresh() bool {
+	return watchWorkflowCmdOptions.sinks.selects(sinkCodefresh) ||
+		watchWorkflowCmdOptions.logSink == logSinkCodefresh ||
+		watchWorkflowCmdOptions.terminationURL != "" ||
+		watchWorkflowCmdOptions.approvalURL != ""
+}
+
+// variablesPolicy applies to the results reported as variables
+func variablesPolicy() reporter.VariablesPolicy {
+	return reporter.VariablesPolicy{
+		MaxValueSize: watchWorkflowCmdOptions.resultsMaxValue,
+		MaxTotalSize: watchWorkflowCmdOptions.resultsMaxTotal,
+		Redact:       watchWorkflowCmdOptions.resultsRedact,
+	}
+}
+
+// resolveApproval applies an approval decision to the run
+func resolveApproval(ctx context.Context, eng engine.Engine, run *engine.Run, approval control.Approval, log logger.Logger) {
+	approver, ok := eng.(engine.Approver)
+	if !ok {
+		return
+	}
+	log.Info("Resolving approval", "run", run.String(), "step", approval.Step, "decision", approval.Decision)
+	if err := approver.Resolve(ctx, run, approval.Step, approval.Decision == control.DecisionApproved); err != nil {
+		log.Err(err, "failed to resolve approval", "run", run.String(), "step", approval.Step)
+	}
+}
+
+// addPendingApprovals polls for the decisions about the steps of the workflow that wait for an approval
+func addPendingApprovals(approvals *control.ApprovalPoller, workflow *reporter.Workflow, workflowID string) {
+	if approvals == nil {
+		return
+	}
+	for _, step := range workflow.Steps {
+		if step.Status == reporter.WorkflowStepPendingApproval {
+			approvals.Add(workflowID, step.Name)
+		}
+	}
+}
+
+// buildApprovalPoller builds the poller of approval decisions, or nil when approvals are disabled
+func buildApprovalPoller(eng engine.Engine, source control.ApprovalSource, log logger.Logger) *control.ApprovalPoller {
+	if watchWorkflowCmdOptions.approvalURL == "" {
+		return nil
+	}
+	if _, ok := eng.(engine.Approver); !ok {
+		log.Info("Engine can not resolve approvals, approval decisions will be ignored", "engine", eng.Name())
+		return nil
+	}
+	return control.NewApprovalPoller(source, watchWorkflowCmdOptions.approvalPoll, log)
+}
+
+// buildTerminationPoller builds the poller of termination requests, or nil when polling is disabled
+func buildTerminationPoller(eng engine.Engine, source control.TerminationSource, log logger.Logger) *control.Poller {
+	if watchWorkflowCmdOptions.terminationURL == "" {
+		return nil
+	}
+	if _, ok := eng.(engine.Canceller); !ok {
+		log.Info("Engine can not cancel runs, termination requests will be ignored", "engine", eng.Name())
+		return nil
+	}
+	return control.NewPoller(source, watchWorkflowCmdOptions.terminationPoll, log)
+}
+
+// buildDiagnosticsCollector builds the collector of the diagnostics of failed steps, or nil when diagnostics are disabled
+func buildDiagnosticsCollector(eng engine.Engine, config *rest.Config) (*diagnostics.Collector, error) {
+	if !watchWorkflowCmdOptions.diagnostics {
+		return nil, nil
+	}
+	if _, ok := eng.(engine.LogSource); !ok {
+		return nil, nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics.NewCollector(client, diagnostics.Options{
+		LogLines: watchWorkflowCmdOptions.diagnosticsLines,
+	}), nil
+}
+
+// buildLogStreamer builds the streamer of step logs, or nil when log streaming is disabled
+func buildLogStreamer(ctx context.Context, eng engine.Engine, config *rest.Config, cf logs.Sink, log logger.Logger) (*logs.Streamer, error) {
+	if watchWorkflowCmdOptions.logSink == "" {
+		return nil, nil
+	}
+	if _, ok := eng.(engine.LogSource); !ok {
+		log.Info("Engine does not support log streaming, step logs will not be sent", "engine", eng.Name())
+		return nil, nil
+	}
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	sink := cf
+	if watchWorkflowCmdOptions.logSink == logSinkStdout {
+		sink = &logs.WriterSink{Writer: os.Stdout}
+	}
+	return logs.NewStreamer(ctx, client, sink, log, logs.Options{
+		ChunkSize:     watchWorkflowCmdOptions.logChunkSize,
+		FlushInterval: watchWorkflowCmdOptions.logFlushInterval,
+	}), nil
+}
+
+// joinSelectors joins label selectors, skipping empty ones
+func joinSelectors(selectors ...string) string {
+	var nonEmpty []string
+	for _, s := range selectors {
+		if s != "" {
+			nonEmpty = append(nonEmpty, s)
+		}
+	}
+	return strings.Join(nonEmpty, ",")
+}
+
+// getWorkflowID returns the workflow ID of a run from its annotations or labels
+func getWorkflowID(run *engine.Run) string {
+	if key := watchWorkflowCmdOptions.workflowIDAnnot; key != "" && run.Annotations[key] != "" {
+		return run.Annotations[key]
+	}
+	if key := watchWorkflowCmdOptions.workflowIDLabel; key != "" {
+		return run.Labels[key]
 	}
-	return wsr.Report(reporter.WorkflowSucceded, nil)
+	return ""
 }
@@ -0,0 +1,136 @@
+package argo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// EngineName selects the Argo engine
+const EngineName = "argo"
+
+// Engine implements engine.Engine for Argo workflows
+type Engine struct {
+	client dynamic.Interface
+	logger logger.Logger
+}
+
+func init() {
+	engine.Register(EngineName, NewEngine)
+}
+
+// NewEngine builds the Argo engine
+func NewEngine(config *rest.Config, _ engine.Options, lgr logger.Logger) (engine.Engine, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		client: client,
+		logger: lgr,
+	}, nil
+}
+
+func (e *Engine) Name() string {
+	return EngineName
+}
+
+// Watch always uses an informer, options.Informer is ignored
+func (e *Engine) Watch(ctx context.Context, options engine.WatchOptions) (<-chan engine.Event, error) {
+	w := &Watcher{
+		Client:        e.client,
+		Namespace:     options.Namespace,
+		LabelSelector: options.LabelSelector,
+		ResyncPeriod:  options.ResyncPeriod,
+		Logger:        e.logger,
+	}
+	return engine.Forward(ctx, func(send func(engine.Event) bool) {
+		for ev := range w.Watch(ctx) {
+			if !send(engine.Event{Run: newRun(ev.Workflow), Deleted: ev.Deleted}) {
+				return
+			}
+		}
+	}), nil
+}
+
+func (e *Engine) Snapshot(run *engine.Run) (*reporter.Workflow, error) {
+	wf, err := workflow(run)
+	if err != nil {
+		return nil, err
+	}
+	return GetWorkflowSnapshot(wf)
+}
+
+func (e *Engine) HasFinished(run *engine.Run) bool {
+	wf, err := workflow(run)
+	return err == nil && WorkflowHasFinished(wf)
+}
+
+func (e *Engine) WorkflowSelector(workflowID string) string {
+	return fmt.Sprintf("%s=%s", WorkflowTemplateLabel, workflowID)
+}
+
+// Cancel sets the workflow's spec.shutdown, which makes Argo stop its running nodes
+func (e *Engine) Cancel(ctx context.Context, run *engine.Run) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"shutdown": ShutdownTerminate,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.client.Resource(WorkflowResource).Namespace(run.Namespace).Patch(ctx, run.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// MarkReported annotates the workflow with the final status it was reported with
+func (e *Engine) MarkReported(ctx context.Context, run *engine.Run, status string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{engine.ReportedAnnotation: status},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.client.Resource(WorkflowResource).Namespace(run.Namespace).Patch(ctx, run.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func newRun(wf *unstructured.Unstructured) *engine.Run {
+	run := &engine.Run{
+		UID:         wf.GetUID(),
+		Kind:        "workflow",
+		Name:        wf.GetName(),
+		Namespace:   wf.GetNamespace(),
+		Labels:      wf.GetLabels(),
+		Annotations: wf.GetAnnotations(),
+		Object:      wf,
+	}
+	if finishedAt, _, _ := unstructured.NestedString(wf.Object, "status", "finishedAt"); finishedAt != "" && WorkflowHasFinished(wf) {
+		if t, err := time.Parse(time.RFC3339, finishedAt); err == nil {
+			run.FinishedAt = t
+		}
+	}
+	return run
+}
+
+func workflow(run *engine.Run) (*unstructured.Unstructured, error) {
+	wf, ok := run.Object.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an argo workflow", run)
+	}
+	return wf, nil
+}
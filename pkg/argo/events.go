@@ -0,0 +1,96 @@
+package argo
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Reasons of the Kubernetes events recorded by the Argo workflow controller
+const (
+	ReasonWorkflowRunning   = "WorkflowRunning"
+	ReasonWorkflowSucceeded = "WorkflowSucceeded"
+	ReasonWorkflowFailed    = "WorkflowFailed"
+	ReasonWorkflowTimedOut  = "WorkflowTimedOut"
+
+	ReasonNodeRunning   = "WorkflowNodeRunning"
+	ReasonNodeSucceeded = "WorkflowNodeSucceeded"
+	ReasonNodeFailed    = "WorkflowNodeFailed"
+	ReasonNodeError     = "WorkflowNodeError"
+
+	// ControllerComponent is the source component of events recorded by the workflow controller
+	ControllerComponent = "workflow-controller"
+	// WorkflowKind is the kind of Argo workflow objects
+	WorkflowKind = "Workflow"
+
+	nodeNameAnnotation = "workflows.argoproj.io/node-name"
+)
+
+// WorkflowEventsFieldSelector selects the events of a single workflow
+func WorkflowEventsFieldSelector(workflowName string) string {
+	return fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s", WorkflowKind, workflowName)
+}
+
+// IsWorkflowEvent tells if the event was recorded by the workflow controller for a workflow
+func IsWorkflowEvent(ev *corev1.Event) bool {
+	return ev.Source.Component == ControllerComponent && ev.InvolvedObject.Kind == WorkflowKind
+}
+
+// GetWorkflowEventStatus maps a workflow event to the workflow status it reports
+func GetWorkflowEventStatus(ev *corev1.Event) (reporter.WorkflowStatus, bool) {
+	switch ev.Reason {
+	case ReasonWorkflowRunning:
+		return reporter.WorkflowRunning, true
+	case ReasonWorkflowSucceeded:
+		return reporter.WorkflowSucceded, true
+	case ReasonWorkflowFailed:
+		return reporter.WorkflowFailed, true
+	case ReasonWorkflowTimedOut:
+		return reporter.WorkflowTimeout, true
+	}
+	return "", false
+}
+
+// GetNodeEventStatus maps a workflow node event to the step status it reports
+func GetNodeEventStatus(ev *corev1.Event) (reporter.WorkflowStepStatus, bool) {
+	switch ev.Reason {
+	case ReasonNodeRunning:
+		return reporter.WorkflowStepRunning, true
+	case ReasonNodeSucceeded:
+		return reporter.WorkflowStepSucceded, true
+	case ReasonNodeFailed, ReasonNodeError:
+		return reporter.WorkflowStepFailed, true
+	}
+	return "", false
+}
+
+// EventError describes the failure an event reports
+func EventError(ev *corev1.Event) error {
+	return fmt.Errorf("%s: %s", ev.Reason, ev.Message)
+}
+
+// GetNodeName returns the name of the node a node event was recorded for, relative to the workflow.
+// It is empty for the workflow's root node, which stands for the workflow itself
+func GetNodeName(ev *corev1.Event) string {
+	name := ev.Annotations[nodeNameAnnotation]
+	if name == "" {
+		// "<Phase> node <name>" or "<Phase> node <name>: <message>"
+		parts := strings.SplitN(ev.Message, " node ", 2)
+		if len(parts) != 2 {
+			return ""
+		}
+		name = strings.SplitN(parts[1], ": ", 2)[0]
+	}
+	workflowName := ev.InvolvedObject.Name
+	if name == workflowName {
+		return ""
+	}
+	// "wf.task" for the nodes of a DAG, "wf[0].step" for the ones of steps
+	if strings.HasPrefix(name, workflowName+"[") {
+		return strings.TrimPrefix(name, workflowName)
+	}
+	return strings.TrimPrefix(name, workflowName+".")
+}
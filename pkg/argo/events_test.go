@@ -0,0 +1,101 @@
+package argo
+
+import (
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func workflowEvent(reason, message string, annotations map[string]string) *corev1.Event {
+	return &corev1.Event{
+		ObjectMeta:     metav1.ObjectMeta{Annotations: annotations},
+		InvolvedObject: corev1.ObjectReference{Kind: WorkflowKind, Name: "wf"},
+		Source:         corev1.EventSource{Component: ControllerComponent},
+		Reason:         reason,
+		Message:        message,
+	}
+}
+
+func TestGetNodeName(t *testing.T) {
+	tests := []struct {
+		name        string
+		message     string
+		annotations map[string]string
+		want        string
+	}{
+		{name: "annotation", annotations: map[string]string{nodeNameAnnotation: "wf.build"}, want: "build"},
+		{name: "annotation wins", message: "Running node wf.other", annotations: map[string]string{nodeNameAnnotation: "wf.build"}, want: "build"},
+		{name: "message", message: "Running node wf.build", want: "build"},
+		{name: "message with details", message: "Failed node wf[0].build: exit code 1", want: "[0].build"},
+		{name: "root node", message: "Succeeded node wf", want: ""},
+		{name: "root node annotation", annotations: map[string]string{nodeNameAnnotation: "wf"}, want: ""},
+		{name: "no node", message: "Workflow completed", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := GetNodeName(workflowEvent(ReasonNodeRunning, tt.message, tt.annotations)); got != tt.want {
+				t.Errorf("GetNodeName() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetWorkflowEventStatus(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   reporter.WorkflowStatus
+		ok     bool
+	}{
+		{reason: ReasonWorkflowRunning, want: reporter.WorkflowRunning, ok: true},
+		{reason: ReasonWorkflowSucceeded, want: reporter.WorkflowSucceded, ok: true},
+		{reason: ReasonWorkflowFailed, want: reporter.WorkflowFailed, ok: true},
+		{reason: ReasonWorkflowTimedOut, want: reporter.WorkflowTimeout, ok: true},
+		{reason: ReasonNodeRunning},
+		{reason: "WorkflowUnknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			got, ok := GetWorkflowEventStatus(workflowEvent(tt.reason, "", nil))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("GetWorkflowEventStatus() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestGetNodeEventStatus(t *testing.T) {
+	tests := []struct {
+		reason string
+		want   reporter.WorkflowStepStatus
+		ok     bool
+	}{
+		{reason: ReasonNodeRunning, want: reporter.WorkflowStepRunning, ok: true},
+		{reason: ReasonNodeSucceeded, want: reporter.WorkflowStepSucceded, ok: true},
+		{reason: ReasonNodeFailed, want: reporter.WorkflowStepFailed, ok: true},
+		{reason: ReasonNodeError, want: reporter.WorkflowStepFailed, ok: true},
+		{reason: ReasonWorkflowRunning},
+		{reason: "WorkflowNodeUnknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			got, ok := GetNodeEventStatus(workflowEvent(tt.reason, "", nil))
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("GetNodeEventStatus() = %q, %v, want %q, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestIsWorkflowEvent(t *testing.T) {
+	ev := workflowEvent(ReasonWorkflowRunning, "", nil)
+	if !IsWorkflowEvent(ev) {
+		t.Error("an event of the workflow controller is not a workflow event")
+	}
+	ev.Source.Component = "kubelet"
+	if IsWorkflowEvent(ev) {
+		t.Error("an event of another component is a workflow event")
+	}
+}
@@ -0,0 +1,65 @@
+package argo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/informer"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+)
+
+type (
+	// Watcher streams the state of Argo workflows using a dynamic informer,
+	// which re-lists and re-watches as needed
+	Watcher struct {
+		Client        dynamic.Interface
+		Namespace     string
+		LabelSelector string
+		// ResyncPeriod is how often every workflow is sent again, even if it did not change. 0 disables resyncs
+		ResyncPeriod time.Duration
+		Logger       logger.Logger
+	}
+
+	// Event is the latest known state of a workflow
+	Event struct {
+		Workflow *unstructured.Unstructured
+		Deleted  bool
+	}
+)
+
+// Watch starts watching in the background. The returned channel is closed once ctx is done
+func (w *Watcher) Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	go w.run(ctx, events)
+	return events
+}
+
+func (w *Watcher) run(ctx context.Context, events chan<- Event) {
+	var gate informer.Gate
+	defer gate.Close(func() { close(events) })
+
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(w.Client, w.ResyncPeriod, w.Namespace, func(opts *metav1.ListOptions) {
+		opts.LabelSelector = w.LabelSelector
+	})
+	factory.ForResource(WorkflowResource).Informer().AddEventHandler(informer.Handler(func(obj interface{}, deleted bool) {
+		wf, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			w.Logger.Err(fmt.Errorf("Invalid object type"), "unexpected object type from informer")
+			return
+		}
+		gate.Send(func() {
+			select {
+			case events <- Event{Workflow: wf.DeepCopy(), Deleted: deleted}:
+			case <-ctx.Done():
+			}
+		})
+	}))
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+}
@@ -0,0 +1,199 @@
+package argo
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Workflow phases and node phases
+const (
+	PhasePending   = "Pending"
+	PhaseRunning   = "Running"
+	PhaseSucceeded = "Succeeded"
+	PhaseFailed    = "Failed"
+	PhaseError     = "Error"
+	PhaseSkipped   = "Skipped"
+	PhaseOmitted   = "Omitted"
+
+	// NodeTypePod is the type of nodes that run a container, the ones reported as steps
+	NodeTypePod = "Pod"
+
+	// WorkflowTemplateLabel is set on workflows submitted from a workflow template
+	WorkflowTemplateLabel = "workflows.argoproj.io/workflow-template"
+
+	// ShutdownTerminate stops a workflow immediately, without running its exit handlers
+	ShutdownTerminate = "Terminate"
+)
+
+// WorkflowResource is the resource of Argo workflows, accessed through the dynamic client
+// so this package does not depend on the Argo API
+var WorkflowResource = schema.GroupVersionResource{
+	Group:    "argoproj.io",
+	Version:  "v1alpha1",
+	Resource: "workflows",
+}
+
+type (
+	// workflowStatus holds the parts of the workflow status that are reported
+	workflowStatus struct {
+		Phase   string          `json:"phase,omitempty"`
+		Message string          `json:"message,omitempty"`
+		Nodes   map[string]node `json:"nodes,omitempty"`
+	}
+
+	node struct {
+		ID          string      `json:"id,omitempty"`
+		Name        string      `json:"name,omitempty"`
+		DisplayName string      `json:"displayName,omitempty"`
+		Type        string      `json:"type,omitempty"`
+		Phase       string      `json:"phase,omitempty"`
+		Message     string      `json:"message,omitempty"`
+		StartedAt   metav1.Time `json:"startedAt,omitempty"`
+		FinishedAt  metav1.Time `json:"finishedAt,omitempty"`
+	}
+)
+
+// WorkflowHasFinished tells if the workflow has reached a final phase
+func WorkflowHasFinished(wf *unstructured.Unstructured) bool {
+	phase, _, _ := unstructured.NestedString(wf.Object, "status", "phase")
+	switch phase {
+	case PhaseSucceeded, PhaseFailed, PhaseError:
+		return true
+	}
+	return false
+}
+
+// GetWorkflowSnapshot translates the current state of an Argo workflow into a workflow,
+// with a step for each of its pod nodes
+func GetWorkflowSnapshot(wf *unstructured.Unstructured) (*reporter.Workflow, error) {
+	status, err := getWorkflowStatus(wf)
+	if err != nil {
+		return nil, err
+	}
+	workflow := reporter.NewWorkflow()
+	switch status.Phase {
+	case "", PhasePending:
+		workflow.Status = reporter.WorkflowPending
+	case PhaseRunning:
+		workflow.Status = reporter.WorkflowRunning
+	case PhaseSucceeded:
+		workflow.Status = reporter.WorkflowSucceded
+	case PhaseFailed, PhaseError:
+		workflow.Status = reporter.WorkflowFailed
+		if shutdown, _, _ := unstructured.NestedString(wf.Object, "spec", "shutdown"); shutdown != "" {
+			// stopped on request rather than by a failure
+			workflow.Status = reporter.WorkflowTerminated
+		}
+		workflow.Err = fmt.Errorf("workflow has failed: %s", status.Message)
+	default:
+		return nil, fmt.Errorf("unknown workflow phase %q", status.Phase)
+	}
+
+	for _, n := range sortedNodes(status.Nodes) {
+		if n.Type != NodeTypePod {
+			continue
+		}
+		stepStatus, err := getNodeStatus(n)
+		if err != nil {
+			return nil, err
+		}
+		name := n.DisplayName
+		if name == "" {
+			name = NodeDisplayName(n.Name)
+		}
+		step := &reporter.WorkflowStep{
+			Name:       name,
+			Status:     stepStatus,
+			StartedAt:  n.StartedAt.Time,
+			FinishedAt: n.FinishedAt.Time,
+		}
+		if stepStatus == reporter.WorkflowStepFailed {
+			step.Err = fmt.Errorf("node has failed: %s", n.Message)
+		}
+		workflow.AddStep(n.ID, step)
+	}
+	return workflow, nil
+}
+
+func getNodeStatus(n node) (reporter.WorkflowStepStatus, error) {
+	switch n.Phase {
+	case "", PhasePending:
+		return reporter.WorkflowStepPending, nil
+	case PhaseRunning:
+		return reporter.WorkflowStepRunning, nil
+	case PhaseSucceeded:
+		return reporter.WorkflowStepSucceded, nil
+	case PhaseFailed, PhaseError:
+		return reporter.WorkflowStepFailed, nil
+	case PhaseSkipped, PhaseOmitted:
+		return reporter.WorkflowStepSkipped, nil
+	}
+	return reporter.WorkflowStepStatus(""), fmt.Errorf("unknown node phase %q", n.Phase)
+}
+
+func getWorkflowStatus(wf *unstructured.Unstructured) (*workflowStatus, error) {
+	status := &workflowStatus{}
+	raw, ok := wf.Object["status"]
+	if !ok {
+		return status, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, fmt.Errorf("failed to read workflow status: %w", err)
+	}
+	for id, n := range status.Nodes {
+		if n.ID == "" {
+			n.ID = id
+			status.Nodes[id] = n
+		}
+	}
+	return status, nil
+}
+
+// sortedNodes returns the nodes by the time they started
+func sortedNodes(nodes map[string]node) []node {
+	sorted := make([]node, 0, len(nodes))
+	for _, n := range nodes {
+		sorted = append(sorted, n)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		si, sj := sorted[i].StartedAt, sorted[j].StartedAt
+		if !si.Equal(&sj) {
+			if si.IsZero() || sj.IsZero() {
+				return !si.IsZero()
+			}
+			return si.Before(&sj)
+		}
+		return sorted[i].ID < sorted[j].ID
+	})
+	return sorted
+}
+
+// NodeDisplayName returns the name of a node as shown by Argo, the last part of its full name:
+// "step" for "wf[0].step", and "task(0:a.b)" for "wf.task(0:a.b)"
+func NodeDisplayName(name string) string {
+	depth := 0
+	for i := len(name) - 1; i >= 0; i-- {
+		switch name[i] {
+		case ')':
+			depth++
+		case '(':
+			depth--
+		case '.':
+			if depth == 0 {
+				return name[i+1:]
+			}
+		}
+	}
+	return name
+}
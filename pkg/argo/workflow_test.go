@@ -0,0 +1,24 @@
+package argo
+
+import "testing"
+
+func TestNodeDisplayName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "wf.task", want: "task"},
+		{name: "wf[0].step", want: "step"},
+		{name: "wf[0].outer[1].inner", want: "inner"},
+		{name: "wf.task(0)", want: "task(0)"},
+		{name: "wf[0].step(1:a.b)", want: "step(1:a.b)"},
+		{name: "task", want: "task"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NodeDisplayName(tt.name); got != tt.want {
+				t.Errorf("NodeDisplayName(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
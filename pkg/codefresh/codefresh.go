@@ -16,10 +16,14 @@ package codefresh
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/codefresh-io/status-reporter/pkg/logger"
 	"github.com/codefresh-io/status-reporter/pkg/reporter"
@@ -27,6 +31,9 @@ import (
 
 const (
 	defaultHost = "https://g.codefresh.io"
+
+	// workflowURLPlaceholder is replaced with the workflow ID in EventReportingURL
+	workflowURLPlaceholder = "{workflow}"
 )
 
 type (
@@ -37,27 +44,51 @@ type (
 		Logger            logger.Logger
 		HTTPClient        *http.Client
 		Headers           http.Header
+		Retry             RetryPolicy
+		// LogReportingURL is where step logs are sent, {workflow} is replaced with the workflow ID
+		LogReportingURL string
+		// TerminationURL is polled for termination requests, {workflow} is replaced with the workflow ID
+		TerminationURL string
+		// ApprovalURL is polled for approval decisions, {workflow} and {step} are replaced
+		// with the workflow ID and the step name
+		ApprovalURL string
+
+		mu sync.Mutex
+		// acked holds the events of each workflow that were acknowledged as part of a transition,
+		// so a transition that failed half way is retried without sending them again
+		acked map[string]map[string]bool
 	}
 
 	workflowEvent struct {
-		Action string `json:"action,omitempty"`
-		Err    string `json:"error,omitempty"`
-		Status string `json:"status,omitempty"`
-		Step   string `json:"step,omitempty"`
-		Name   string `json:"name,omitempty"`
+		Action     string     `json:"action,omitempty"`
+		Err        string     `json:"error,omitempty"`
+		Status     string     `json:"status,omitempty"`
+		Step       string     `json:"step,omitempty"`
+		Name       string     `json:"name,omitempty"`
+		ExitCode   *int32     `json:"exitCode,omitempty"`
+		StartedAt  *time.Time `json:"startedAt,omitempty"`
+		FinishedAt *time.Time `json:"finishedAt,omitempty"`
+		// Duration in milliseconds, set once the step finished
+		Duration int64  `json:"duration,omitempty"`
+		Group    string `json:"group,omitempty"`
+		// Results of a step, or the variables exported by the workflow
+		Results   []reporter.Variable `json:"results,omitempty"`
+		Variables []reporter.Variable `json:"variables,omitempty"`
+		// Diagnostics explain why a step failed
+		Diagnostics *reporter.Diagnostics `json:"diagnostics,omitempty"`
 	}
 )
 
-func (c *Codefresh) ReportWorkflowStaus(workflow string, status reporter.WorkflowStatus, workflowErr error) error {
+func (c *Codefresh) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, workflowErr error) error {
 	switch status {
 	case reporter.WorkflowRunning:
-		if err := c.sendStartEvent(); err != nil {
+		if err := c.sendStartEvent(ctx, workflow); err != nil {
 			c.Logger.Err(err, "failed to report start event")
 			return err
 		}
 		c.Logger.Info("reported workflow start")
-	case reporter.WorkflowFailed, reporter.WorkflowSucceded:
-		if err := c.sendFinishEvent(workflowErr); err != nil {
+	case reporter.WorkflowFailed, reporter.WorkflowSucceded, reporter.WorkflowTerminated, reporter.WorkflowTimeout:
+		if err := c.sendFinishEvent(ctx, workflow, status, workflowErr); err != nil {
 			c.Logger.Err(err, "failed to report finish event")
 			return err
 		}
@@ -66,26 +97,38 @@ func (c *Codefresh) ReportWorkflowStaus(workflow string, status reporter.Workflo
 	return nil
 }
 
-func (c *Codefresh) ReportWorkflowStepStaus(workflow string, step string, status reporter.WorkflowStepStatus, stepErr error) error {
-	switch status {
-	case reporter.WorkflowStepRunning:
-		if err := c.startStep(step, string(status), stepErr); err != nil {
+func (c *Codefresh) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	switch step.Status {
+	case reporter.WorkflowStepRunning, reporter.WorkflowStepSkipped:
+		// a skipped step never ran, it is created along with its status
+		if err := c.startStep(ctx, workflow, step); err != nil {
 			c.Logger.Err(err, "failed to report step start event")
 			return err
 		}
-		c.Logger.Info("reported step start", "step", step)
+		c.Logger.Info("reported step start", "step", step.Name)
 	default:
-		if err := c.sendStepStatus(step, string(status), stepErr); err != nil {
+		if err := c.sendStepStatus(ctx, workflow, step); err != nil {
 			c.Logger.Err(err, "failed to report step status")
 			return err
 		}
-		c.Logger.Info("reported step status", "step", step, "status", status, "error", stepErr)
+		c.Logger.Info("reported step status", "step", step.Name, "status", step.Status, "error", step.Err)
+	}
+	return nil
+}
+
+func (c *Codefresh) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	resp, err := c.sendEvent(ctx, workflow, workflowEvent{Action: "export-variables", Variables: variables})
+	if err != nil {
+		c.Logger.Err(err, "failed to report workflow variables")
+		return err
 	}
+	c.Logger.Info(string(resp))
+	c.Logger.Info("reported workflow variables", "workflow", workflow, "count", len(variables))
 	return nil
 }
 
-func (c *Codefresh) sendStartEvent() error {
-	resp, err := c.sendEvent(workflowEvent{Action: "start"})
+func (c *Codefresh) sendStartEvent(ctx context.Context, workflow string) error {
+	resp, err := c.sendEvent(ctx, workflow, workflowEvent{Action: "start"})
 	if err != nil {
 		return err
 	}
@@ -93,43 +136,89 @@ func (c *Codefresh) sendStartEvent() error {
 	return nil
 }
 
-func (c *Codefresh) sendFinishEvent(workflowErr error) error {
+func (c *Codefresh) sendFinishEvent(ctx context.Context, workflow string, status reporter.WorkflowStatus, workflowErr error) error {
 	workflowErrStr := ""
 	if workflowErr != nil {
 		workflowErrStr = workflowErr.Error()
 	}
-	resp, err := c.sendEvent(workflowEvent{Action: "finish", Err: workflowErrStr})
-	if err != nil {
+	ev := workflowEvent{Action: "finish", Err: workflowErrStr}
+	if status != reporter.WorkflowSucceded && status != reporter.WorkflowFailed {
+		// success and error are told apart by the error, other outcomes need an explicit status
+		ev.Status = string(status)
+	}
+	if err := c.sendOnce(ctx, workflow, "finish", ev); err != nil {
 		return err
 	}
-	c.Logger.Info(string(resp))
-	resp, err = c.sendEvent(workflowEvent{Action: "finish-system"})
-	if err != nil {
+	if err := c.sendOnce(ctx, workflow, "finish-system", workflowEvent{Action: "finish-system"}); err != nil {
 		return err
 	}
-	c.Logger.Info(string(resp))
+	c.Forget(workflow)
 	return nil
 }
 
-func (c *Codefresh) startStep(step, status string, stepErr error) error {
-	resp, err := c.sendEvent(workflowEvent{Action: "pre-steps-succeeded"})
-	if err != nil {
+// startStep creates the step, unless it was already created (e.g. before it waited for an approval),
+// and reports its status
+func (c *Codefresh) startStep(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	if err := c.sendOnce(ctx, workflow, "pre-steps-succeeded/"+step.Name, workflowEvent{Action: "pre-steps-succeeded"}); err != nil {
+		return err
+	}
+	ev := workflowEvent{Action: "new-progress-step", Name: step.Name, Group: step.Group, StartedAt: reporter.TimePtr(step.StartedAt)}
+	if err := c.sendOnce(ctx, workflow, "new-progress-step/"+step.Name, ev); err != nil {
 		return err
 	}
-	resp, err = c.sendEvent(workflowEvent{Action: "new-progress-step", Name: step})
+	return c.sendStepStatus(ctx, workflow, step)
+}
+
+// sendOnce sends an event of a transition unless it was already acknowledged
+func (c *Codefresh) sendOnce(ctx context.Context, workflow, key string, ev workflowEvent) error {
+	c.mu.Lock()
+	acked := c.acked[workflow][key]
+	c.mu.Unlock()
+	if acked {
+		return nil
+	}
+	resp, err := c.sendEvent(ctx, workflow, ev)
 	if err != nil {
 		return err
 	}
 	c.Logger.Info(string(resp))
-	return c.sendStepStatus(step, status, stepErr)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.acked == nil {
+		c.acked = map[string]map[string]bool{}
+	}
+	if c.acked[workflow] == nil {
+		c.acked[workflow] = map[string]bool{}
+	}
+	c.acked[workflow][key] = true
+	return nil
+}
+
+// Forget drops the events acknowledged for a workflow, once it finished or its run is gone
+func (c *Codefresh) Forget(workflow string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.acked, workflow)
 }
 
-func (c *Codefresh) sendStepStatus(step, status string, stepErr error) error {
+func (c *Codefresh) sendStepStatus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
 	stepErrStr := ""
-	if stepErr != nil {
-		stepErrStr = stepErr.Error()
+	if step.Err != nil {
+		stepErrStr = step.Err.Error()
 	}
-	resp, err := c.sendEvent(workflowEvent{Action: "report-status", Step: step, Status: status, Err: stepErrStr})
+	resp, err := c.sendEvent(ctx, workflow, workflowEvent{
+		Action:      "report-status",
+		Step:        step.Name,
+		Status:      string(step.Status),
+		Err:         stepErrStr,
+		ExitCode:    step.ExitCode,
+		StartedAt:   reporter.TimePtr(step.StartedAt),
+		FinishedAt:  reporter.TimePtr(step.FinishedAt),
+		Duration:    step.Duration().Milliseconds(),
+		Group:       step.Group,
+		Results:     step.Results,
+		Diagnostics: step.Diagnostics,
+	})
 	if err != nil {
 		return err
 	}
@@ -137,6 +226,12 @@ func (c *Codefresh) sendStepStatus(step, status string, stepErr error) error {
 	return nil
 }
 
+// timePtr omits unknown times from events
+// eventReportingURL returns the URL to report the events of a workflow to
+func (c *Codefresh) eventReportingURL(workflow string) string {
+	return strings.ReplaceAll(c.EventReportingURL, workflowURLPlaceholder, workflow)
+}
+
 func (c *Codefresh) buildErrorFromResponse(status int, body []byte) error {
 	return Error{
 		APIStatusCode: status,
@@ -144,8 +239,8 @@ func (c *Codefresh) buildErrorFromResponse(status int, body []byte) error {
 	}
 }
 
-func (c *Codefresh) prepareRequest(method, url string, data io.Reader) (*http.Request, error) {
-	req, err := http.NewRequest(method, url, data)
+func (c *Codefresh) prepareRequest(ctx context.Context, method, url string, data io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, data)
 	if err != nil {
 		return nil, err
 	}
@@ -154,26 +249,55 @@ func (c *Codefresh) prepareRequest(method, url string, data io.Reader) (*http.Re
 	return req, nil
 }
 
-func (c *Codefresh) sendEvent(ev workflowEvent) ([]byte, error) {
+func (c *Codefresh) sendEvent(ctx context.Context, workflow string, ev workflowEvent) ([]byte, error) {
 	body, err := json.Marshal(&ev)
 	if err != nil {
 		return nil, err
 	}
-	req, err := c.prepareRequest("POST", c.EventReportingURL, bytes.NewReader(body))
+	return c.post(ctx, c.eventReportingURL(workflow), body, ev.Action)
+}
+
+// post delivers body to url, retrying according to the retry policy
+func (c *Codefresh) post(ctx context.Context, url string, body []byte, action string) ([]byte, error) {
+	attempts := c.Retry.attempts()
+	for attempt := 1; ; attempt++ {
+		data, retryAfter, retryable, err := c.doSendEvent(ctx, url, body)
+		if err == nil {
+			return data, nil
+		}
+		if !retryable {
+			return nil, reporter.Permanent(err)
+		}
+		if attempt >= attempts || ctx.Err() != nil {
+			return nil, err
+		}
+		delay := c.Retry.delay(attempt, retryAfter)
+		c.Logger.Info("retrying event delivery", "action", action, "attempt", attempt, "delay", delay.String(), "error", err.Error())
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, err
+		}
+	}
+}
+
+// doSendEvent makes a single delivery attempt, and tells if the failure (if any) is worth retrying
+func (c *Codefresh) doSendEvent(ctx context.Context, url string, body []byte) ([]byte, time.Duration, bool, error) {
+	req, err := c.prepareRequest(ctx, "POST", url, bytes.NewReader(body))
 	if err != nil {
-		return nil, err
+		return nil, 0, false, err
 	}
 	resp, err := c.HTTPClient.Do(req)
 	if err != nil {
-		return nil, err
+		return nil, 0, true, err
 	}
 	defer resp.Body.Close()
 	data, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, true, err
 	}
 	if resp.StatusCode >= 400 {
-		return nil, c.buildErrorFromResponse(resp.StatusCode, data)
+		return nil, parseRetryAfter(resp.Header), c.Retry.isRetryableStatus(resp.StatusCode), c.buildErrorFromResponse(resp.StatusCode, data)
 	}
-	return data, nil
+	return data, 0, false, nil
 }
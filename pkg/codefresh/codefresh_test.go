@@ -0,0 +1,188 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// eventRecorder stands in for the Codefresh API, failing the actions it is told to fail
+type eventRecorder struct {
+	mu      sync.Mutex
+	actions []string
+	events  []workflowEvent
+	fail    map[string]int
+}
+
+func (r *eventRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ev := workflowEvent{}
+	if err := json.NewDecoder(req.Body).Decode(&ev); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail[ev.Action] > 0 {
+		r.fail[ev.Action]--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	r.actions = append(r.actions, ev.Action)
+	r.events = append(r.events, ev)
+	_, _ = w.Write([]byte("{}"))
+}
+
+func (r *eventRecorder) sent() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.actions...)
+}
+
+func newTestClient(t *testing.T, rec *eventRecorder) *Codefresh {
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	return &Codefresh{
+		EventReportingURL: srv.URL + "/workflows/{workflow}/events",
+		Logger:            logger.New(logger.Options{}),
+		HTTPClient:        srv.Client(),
+		Headers:           http.Header{},
+	}
+}
+
+func TestStartStepRetryDoesNotRepeatAcknowledgedEvents(t *testing.T) {
+	rec := &eventRecorder{fail: map[string]int{"new-progress-step": 1}}
+	cf := newTestClient(t, rec)
+	ctx := context.Background()
+	step := reporter.WorkflowStep{Name: "build", Status: reporter.WorkflowStepRunning}
+
+	if err := cf.ReportWorkflowStepStaus(ctx, "wf", step); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if err := cf.ReportWorkflowStepStaus(ctx, "wf", step); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	want := []string{"pre-steps-succeeded", "new-progress-step", "report-status"}
+	if got := rec.sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+}
+
+func TestStepRunningAgainOnlyReportsStatus(t *testing.T) {
+	rec := &eventRecorder{}
+	cf := newTestClient(t, rec)
+	ctx := context.Background()
+
+	for _, status := range []reporter.WorkflowStepStatus{reporter.WorkflowStepRunning, reporter.WorkflowStepPendingApproval, reporter.WorkflowStepRunning} {
+		if err := cf.ReportWorkflowStepStaus(ctx, "wf", reporter.WorkflowStep{Name: "approve", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"pre-steps-succeeded", "new-progress-step", "report-status", "report-status", "report-status"}
+	if got := rec.sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+}
+
+func TestFinishRetryDoesNotRepeatFinish(t *testing.T) {
+	rec := &eventRecorder{fail: map[string]int{"finish-system": 1}}
+	cf := newTestClient(t, rec)
+	ctx := context.Background()
+
+	if err := cf.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err == nil {
+		t.Fatal("expected the first attempt to fail")
+	}
+	if err := cf.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatalf("retry failed: %v", err)
+	}
+	want := []string{"finish", "finish-system"}
+	if got := rec.sent(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("sent %v, want %v", got, want)
+	}
+	if len(cf.acked) != 0 {
+		t.Fatalf("finished workflow is still tracked: %v", cf.acked)
+	}
+}
+
+func TestPostRetriesRetryableStatuses(t *testing.T) {
+	rec := &eventRecorder{fail: map[string]int{"start": 2}}
+	cf := newTestClient(t, rec)
+	cf.Retry = RetryPolicy{MaxAttempts: 3, RetryableStatuses: []string{"5xx"}}
+
+	if err := cf.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := rec.sent(); !reflect.DeepEqual(got, []string{"start"}) {
+		t.Fatalf("sent %v", got)
+	}
+}
+
+func TestSkippedStepIsCreatedBeforeItsStatus(t *testing.T) {
+	rec := &eventRecorder{}
+	cf := newTestClient(t, rec)
+	wsr := &reporter.WorkflowStatusReporter{CodefreshAPI: cf, Logger: cf.Logger, WorkflowID: "wf"}
+	desired := reporter.NewWorkflow()
+	desired.Status = reporter.WorkflowSucceded
+	desired.AddStep("build", &reporter.WorkflowStep{Name: "build", Status: reporter.WorkflowStepSucceded})
+	desired.AddStep("deploy", &reporter.WorkflowStep{Name: "deploy", Status: reporter.WorkflowStepSkipped})
+
+	if err := reporter.NewWorkflow().Sync(context.Background(), desired, wsr); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ev := range rec.events {
+		got = append(got, strings.Trim(strings.Join([]string{ev.Action, ev.Name + ev.Step, ev.Status}, " "), " "))
+	}
+	want := []string{
+		"start",
+		"pre-steps-succeeded",
+		"new-progress-step build",
+		"report-status build running",
+		"report-status build success",
+		"pre-steps-succeeded",
+		"new-progress-step deploy",
+		"report-status deploy skipped",
+		"finish",
+		"finish-system",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected events\n%v\ngot\n%v", want, got)
+	}
+}
+
+func TestForgetDropsTheAcknowledgedEvents(t *testing.T) {
+	rec := &eventRecorder{fail: map[string]int{"report-status": 1}}
+	cf := newTestClient(t, rec)
+	step := reporter.WorkflowStep{Name: "build", Status: reporter.WorkflowStepRunning}
+	if err := cf.ReportWorkflowStepStaus(context.Background(), "wf", step); err == nil {
+		t.Fatal("expected the status to fail")
+	}
+	if len(cf.acked["wf"]) == 0 {
+		t.Fatal("expected the created step to be acknowledged")
+	}
+	cf.Forget("wf")
+	if _, ok := cf.acked["wf"]; ok {
+		t.Errorf("expected the workflow to be forgotten, got %v", cf.acked)
+	}
+}
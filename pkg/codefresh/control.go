@@ -0,0 +1,87 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	"github.com/codefresh-io/status-reporter/pkg/control"
+)
+
+const stepURLPlaceholder = "{step}"
+
+type (
+	terminationResponse struct {
+		Terminate bool `json:"terminate"`
+	}
+
+	approvalResponse struct {
+		Decision string `json:"decision"`
+	}
+)
+
+// IsTerminationRequested implements control.TerminationSource by asking TerminationURL
+// whether the user asked to terminate the workflow
+func (c *Codefresh) IsTerminationRequested(ctx context.Context, workflow string) (bool, error) {
+	terminationURL := strings.ReplaceAll(c.TerminationURL, workflowURLPlaceholder, workflow)
+	tr := terminationResponse{}
+	if err := c.get(ctx, terminationURL, &tr); err != nil {
+		return false, err
+	}
+	return tr.Terminate, nil
+}
+
+// GetApprovalDecision implements control.ApprovalSource by asking ApprovalURL
+// what the user decided about an approval step
+func (c *Codefresh) GetApprovalDecision(ctx context.Context, workflow string, step string) (control.Decision, error) {
+	// step names come from the run, so they may hold characters that are not allowed in a path
+	approvalURL := strings.ReplaceAll(c.ApprovalURL, workflowURLPlaceholder, workflow)
+	approvalURL = strings.ReplaceAll(approvalURL, stepURLPlaceholder, url.PathEscape(step))
+	ar := approvalResponse{}
+	if err := c.get(ctx, approvalURL, &ar); err != nil {
+		return control.DecisionNone, err
+	}
+	switch d := control.Decision(ar.Decision); d {
+	case control.DecisionNone, control.DecisionApproved, control.DecisionDenied:
+		return d, nil
+	}
+	return control.DecisionNone, fmt.Errorf("unknown approval decision %q", ar.Decision)
+}
+
+// get reads the JSON response of a GET request to url into v
+func (c *Codefresh) get(ctx context.Context, getURL string, v interface{}) error {
+	req, err := c.prepareRequest(ctx, "GET", getURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		return c.buildErrorFromResponse(resp.StatusCode, data)
+	}
+	return json.Unmarshal(data, v)
+}
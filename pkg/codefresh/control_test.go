@@ -0,0 +1,51 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/control"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+func TestGetApprovalDecisionEscapesTheStep(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		path = req.URL.EscapedPath()
+		_, _ = w.Write([]byte(`{"decision":"approved"}`))
+	}))
+	defer srv.Close()
+	cf := &Codefresh{
+		ApprovalURL: srv.URL + "/workflows/{workflow}/steps/{step}/approval",
+		Logger:      logger.New(logger.Options{}),
+		HTTPClient:  srv.Client(),
+		Headers:     http.Header{},
+	}
+
+	decision, err := cf.GetApprovalDecision(context.Background(), "wf", "deploy/prod?now")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decision != control.DecisionApproved {
+		t.Errorf("expected the step to be approved, got %q", decision)
+	}
+	if want := "/workflows/wf/steps/deploy%2Fprod%3Fnow/approval"; path != want {
+		t.Errorf("expected the step to be escaped as %s, got %s", want, path)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+)
+
+type logEvent struct {
+	Step      string `json:"step"`
+	Container string `json:"container,omitempty"`
+	Offset    int64  `json:"offset"`
+	Data      string `json:"data,omitempty"`
+	End       bool   `json:"end,omitempty"`
+}
+
+// WriteLog implements logs.Sink by sending the chunk to LogReportingURL
+func (c *Codefresh) WriteLog(ctx context.Context, workflow string, chunk logs.Chunk) error {
+	return c.sendLogEvent(ctx, workflow, logEvent{
+		Step:      chunk.Step,
+		Container: chunk.Container,
+		Offset:    chunk.Offset,
+		Data:      string(chunk.Data),
+	})
+}
+
+// EndLog implements logs.Sink
+func (c *Codefresh) EndLog(ctx context.Context, workflow string, step string) error {
+	return c.sendLogEvent(ctx, workflow, logEvent{Step: step, End: true})
+}
+
+func (c *Codefresh) sendLogEvent(ctx context.Context, workflow string, ev logEvent) error {
+	body, err := json.Marshal(&ev)
+	if err != nil {
+		return err
+	}
+	url := strings.ReplaceAll(c.LogReportingURL, workflowURLPlaceholder, workflow)
+	_, err = c.post(ctx, url, body, "log")
+	return err
+}
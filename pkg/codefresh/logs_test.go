@@ -0,0 +1,72 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+)
+
+func TestLogChunksAndEndAreSentToTheWorkflowLog(t *testing.T) {
+	var mu sync.Mutex
+	var paths []string
+	var events []logEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ev := logEvent{}
+		if err := json.NewDecoder(req.Body).Decode(&ev); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, req.URL.Path)
+		events = append(events, ev)
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer srv.Close()
+	cf := &Codefresh{
+		LogReportingURL: srv.URL + "/workflows/{workflow}/logs",
+		Logger:          logger.New(logger.Options{}),
+		HTTPClient:      srv.Client(),
+		Headers:         http.Header{},
+	}
+	ctx := context.Background()
+
+	if err := cf.WriteLog(ctx, "wf", logs.Chunk{Step: "build", Container: "step", Offset: 6, Data: []byte("a\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := cf.EndLog(ctx, "wf", "build"); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"/workflows/wf/logs", "/workflows/wf/logs"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("sent to %q, want %q", paths, want)
+	}
+	want := []logEvent{
+		{Step: "build", Container: "step", Offset: 6, Data: "a\n"},
+		{Step: "build", End: true},
+	}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("sent %+v, want %+v", events, want)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// RetryPolicy controls how failed event deliveries are retried.
+	// The zero value disables retries.
+	RetryPolicy struct {
+		// MaxAttempts is the total number of attempts, including the first one
+		MaxAttempts int
+		// BaseDelay is the delay before the first retry, doubled on every attempt
+		BaseDelay time.Duration
+		// MaxDelay caps the delay between attempts, including delays requested by Retry-After
+		MaxDelay time.Duration
+		// Jitter is the fraction (0-1) of each delay that is randomized
+		Jitter float64
+		// RetryableStatuses lists the status codes ("429") or classes ("5xx") worth retrying
+		RetryableStatuses []string
+	}
+)
+
+var (
+	jitterMu   sync.Mutex
+	jitterRand = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// DefaultRetryPolicy returns the policy used when none is configured
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:       5,
+		BaseDelay:         500 * time.Millisecond,
+		MaxDelay:          30 * time.Second,
+		Jitter:            0.2,
+		RetryableStatuses: []string{"429", "5xx"},
+	}
+}
+
+// Validate checks that the policy can be used
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("retry max attempts must not be negative")
+	}
+	if p.BaseDelay < 0 || p.MaxDelay < 0 {
+		return fmt.Errorf("retry delays must not be negative")
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("retry jitter must be between 0 and 1")
+	}
+	for _, s := range p.RetryableStatuses {
+		if _, _, err := parseStatusPattern(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p RetryPolicy) attempts() int {
+	if p.MaxAttempts < 1 {
+		return 1
+	}
+	return p.MaxAttempts
+}
+
+// isRetryableStatus reports whether a response with the given status code should be retried
+func (p RetryPolicy) isRetryableStatus(code int) bool {
+	for _, s := range p.RetryableStatuses {
+		min, max, err := parseStatusPattern(s)
+		if err != nil {
+			continue
+		}
+		if code >= min && code <= max {
+			return true
+		}
+	}
+	return false
+}
+
+// delay returns how long to wait before the given retry (1 based),
+// preferring the delay requested by the server if there is one
+func (p RetryPolicy) delay(retry int, retryAfter time.Duration) time.Duration {
+	d := retryAfter
+	if d <= 0 {
+		d = p.BaseDelay
+		for i := 1; i < retry && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+			d *= 2
+		}
+		if p.Jitter > 0 {
+			jitterMu.Lock()
+			d -= time.Duration(p.Jitter * jitterRand.Float64() * float64(d))
+			jitterMu.Unlock()
+		}
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	return d
+}
+
+// parseStatusPattern parses "503" or "5xx" into an inclusive range of status codes
+func parseStatusPattern(s string) (int, int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) == 3 && strings.HasSuffix(s, "xx") {
+		class, err := strconv.Atoi(s[:1])
+		if err == nil && class >= 1 && class <= 5 {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+	code, err := strconv.Atoi(s)
+	if err != nil || code < 100 || code > 599 {
+		return 0, 0, fmt.Errorf("invalid retryable status %q, expected a code (429) or a class (5xx)", s)
+	}
+	return code, code, nil
+}
+
+// parseRetryAfter reads the Retry-After header, which is either seconds or an HTTP date
+func parseRetryAfter(h http.Header) time.Duration {
+	v := strings.TrimSpace(h.Get("Retry-After"))
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+	return 0
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codefresh
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyIsRetryableStatus(t *testing.T) {
+	p := RetryPolicy{RetryableStatuses: []string{"429", "5xx"}}
+	tests := map[int]bool{
+		200: false,
+		400: false,
+		429: true,
+		500: true,
+		503: true,
+		599: true,
+	}
+	for code, want := range tests {
+		if got := p.isRetryableStatus(code); got != want {
+			t.Errorf("isRetryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		retry      int
+		retryAfter time.Duration
+		want       time.Duration
+	}{
+		{retry: 1, want: 100 * time.Millisecond},
+		{retry: 2, want: 200 * time.Millisecond},
+		{retry: 4, want: 800 * time.Millisecond},
+		{retry: 5, want: time.Second},
+		{retry: 1, retryAfter: 500 * time.Millisecond, want: 500 * time.Millisecond},
+		{retry: 1, retryAfter: time.Minute, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.delay(tt.retry, tt.retryAfter); got != tt.want {
+			t.Errorf("delay(%d, %s) = %s, want %s", tt.retry, tt.retryAfter, got, tt.want)
+		}
+	}
+}
+
+func TestRetryPolicyValidate(t *testing.T) {
+	if err := DefaultRetryPolicy().Validate(); err != nil {
+		t.Fatalf("default policy is invalid: %v", err)
+	}
+	for _, p := range []RetryPolicy{
+		{MaxAttempts: -1},
+		{BaseDelay: -time.Second},
+		{Jitter: 2},
+		{RetryableStatuses: []string{"6xx"}},
+		{RetryableStatuses: []string{"abc"}},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%+v should be invalid", p)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	h := http.Header{}
+	if got := parseRetryAfter(h); got != 0 {
+		t.Errorf("no header: got %s", got)
+	}
+	h.Set("Retry-After", "3")
+	if got := parseRetryAfter(h); got != 3*time.Second {
+		t.Errorf("seconds: got %s", got)
+	}
+	h.Set("Retry-After", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	if got := parseRetryAfter(h); got < 59*time.Minute || got > time.Hour {
+		t.Errorf("date: got %s", got)
+	}
+}
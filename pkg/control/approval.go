@@ -0,0 +1,112 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+// Approval decisions
+const (
+	DecisionNone     Decision = ""
+	DecisionApproved Decision = "approved"
+	DecisionDenied   Decision = "denied"
+)
+
+type (
+	// Decision is the outcome of an approval step
+	Decision string
+
+	// ApprovalSource tells what a user decided about an approval step
+	ApprovalSource interface {
+		GetApprovalDecision(ctx context.Context, workflow string, step string) (Decision, error)
+	}
+
+	// Approval is a decision made about a step of a workflow
+	Approval struct {
+		Workflow string
+		Step     string
+		Decision Decision
+	}
+
+	// ApprovalPoller polls an ApprovalSource for the steps it was given, and sends
+	// each decision once
+	ApprovalPoller struct {
+		source    ApprovalSource
+		loop      *loop
+		logger    logger.Logger
+		approvals chan Approval
+	}
+
+	approvalKey struct {
+		workflow string
+		step     string
+	}
+)
+
+// NewApprovalPoller builds an ApprovalPoller that checks every step once per interval
+func NewApprovalPoller(source ApprovalSource, interval time.Duration, lgr logger.Logger) *ApprovalPoller {
+	return &ApprovalPoller{
+		source:    source,
+		loop:      newLoop(interval),
+		logger:    lgr,
+		approvals: make(chan Approval),
+	}
+}
+
+// Add starts polling for a step waiting for approval
+func (p *ApprovalPoller) Add(workflow, step string) {
+	p.loop.add(approvalKey{workflow, step})
+}
+
+// RemoveWorkflow stops polling for the steps of a workflow
+func (p *ApprovalPoller) RemoveWorkflow(workflow string) {
+	p.loop.removeIf(func(key interface{}) bool {
+		return key.(approvalKey).workflow == workflow
+	})
+}
+
+// Approvals returns the decisions. A step is removed from polling before its decision is sent
+func (p *ApprovalPoller) Approvals() <-chan Approval {
+	return p.approvals
+}
+
+// Run polls until ctx is done
+func (p *ApprovalPoller) Run(ctx context.Context) {
+	p.loop.run(ctx, func(key interface{}) bool {
+		k := key.(approvalKey)
+		decision, err := p.source.GetApprovalDecision(ctx, k.workflow, k.step)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Err(err, "failed to check for approval decision", "workflow", k.workflow, "step", k.step)
+			}
+			return true
+		}
+		if decision == DecisionNone {
+			return true
+		}
+		p.logger.Info("Approval decision was made", "workflow", k.workflow, "step", k.step, "decision", decision)
+		p.loop.remove(key)
+		select {
+		case p.approvals <- Approval{Workflow: k.workflow, Step: k.step, Decision: decision}:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+type fakeDecisions struct {
+	mu        sync.Mutex
+	decisions map[string]Decision
+	checked   int
+}
+
+func (f *fakeDecisions) GetApprovalDecision(_ context.Context, workflow, step string) (Decision, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.checked++
+	return f.decisions[workflow+"/"+step], nil
+}
+
+func TestApprovalDecisionIsSentOnce(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	source := &fakeDecisions{decisions: map[string]Decision{"wf-1/approve": DecisionApproved}}
+	p := NewApprovalPoller(source, 5*time.Millisecond, logger.New(logger.Options{}))
+	p.Add("wf-1", "approve")
+	p.Add("wf-2", "approve")
+	go p.Run(ctx)
+
+	select {
+	case approval := <-p.Approvals():
+		want := Approval{Workflow: "wf-1", Step: "approve", Decision: DecisionApproved}
+		if approval != want {
+			t.Fatalf("expected %+v, got %+v", want, approval)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the decision about wf-1")
+	}
+	select {
+	case approval := <-p.Approvals():
+		t.Fatalf("expected the decision to be sent once, got %+v", approval)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	p.RemoveWorkflow("wf-2")
+	time.Sleep(20 * time.Millisecond)
+	source.mu.Lock()
+	checked := source.checked
+	source.mu.Unlock()
+	time.Sleep(50 * time.Millisecond)
+	source.mu.Lock()
+	defer source.mu.Unlock()
+	if source.checked != checked {
+		t.Errorf("expected no more checks once every step was removed, got %d more", source.checked-checked)
+	}
+}
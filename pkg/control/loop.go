@@ -0,0 +1,91 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const defaultPollInterval = 10 * time.Second
+
+// loop holds what the pollers poll for, and checks each of it once per interval
+type loop struct {
+	interval time.Duration
+	mu       sync.Mutex
+	keys     map[interface{}]bool
+}
+
+func newLoop(interval time.Duration) *loop {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	return &loop{
+		interval: interval,
+		keys:     map[interface{}]bool{},
+	}
+}
+
+func (l *loop) add(key interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.keys[key] = true
+}
+
+func (l *loop) remove(key interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.keys, key)
+}
+
+// removeIf stops polling for the keys remove matches
+func (l *loop) removeIf(remove func(key interface{}) bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for key := range l.keys {
+		if remove(key) {
+			delete(l.keys, key)
+		}
+	}
+}
+
+// run calls check with every key once per interval, until ctx is done or check returns false
+func (l *loop) run(ctx context.Context, check func(key interface{}) bool) {
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, key := range l.snapshot() {
+			if !check(key) {
+				return
+			}
+		}
+	}
+}
+
+func (l *loop) snapshot() []interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]interface{}, 0, len(l.keys))
+	for key := range l.keys {
+		keys = append(keys, key)
+	}
+	return keys
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+type (
+	// TerminationSource tells if a user asked to terminate a workflow
+	TerminationSource interface {
+		IsTerminationRequested(ctx context.Context, workflow string) (bool, error)
+	}
+
+	// Poller polls a TerminationSource for the workflows it was given, and sends
+	// the ID of each workflow whose termination was requested on every poll until it is removed
+	Poller struct {
+		source   TerminationSource
+		loop     *loop
+		logger   logger.Logger
+		requests chan string
+	}
+)
+
+// NewPoller builds a Poller that checks every workflow once per interval
+func NewPoller(source TerminationSource, interval time.Duration, lgr logger.Logger) *Poller {
+	return &Poller{
+		source:   source,
+		loop:     newLoop(interval),
+		logger:   lgr,
+		requests: make(chan string),
+	}
+}
+
+// Add starts polling for a workflow
+func (p *Poller) Add(workflow string) {
+	p.loop.add(workflow)
+}
+
+// Remove stops polling for a workflow
+func (p *Poller) Remove(workflow string) {
+	p.loop.remove(workflow)
+}
+
+// Requests returns the IDs of the workflows to terminate. A workflow is kept polled for
+// until it is removed, so a termination that failed is requested again on the next poll
+func (p *Poller) Requests() <-chan string {
+	return p.requests
+}
+
+// Run polls until ctx is done
+func (p *Poller) Run(ctx context.Context) {
+	p.loop.run(ctx, func(key interface{}) bool {
+		workflow := key.(string)
+		requested, err := p.source.IsTerminationRequested(ctx, workflow)
+		if err != nil {
+			if ctx.Err() == nil {
+				p.logger.Err(err, "failed to check for termination request", "workflow", workflow)
+			}
+			return true
+		}
+		if !requested {
+			return true
+		}
+		p.logger.Info("Termination was requested", "workflow", workflow)
+		select {
+		case p.requests <- workflow:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	})
+}
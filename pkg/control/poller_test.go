@@ -0,0 +1,69 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package control
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+type fakeTerminations struct {
+	mu        sync.Mutex
+	requested map[string]bool
+}
+
+func (f *fakeTerminations) IsTerminationRequested(_ context.Context, workflow string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requested[workflow], nil
+}
+
+func TestTerminationIsRequestedUntilRemoved(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := NewPoller(&fakeTerminations{requested: map[string]bool{"wf-1": true}}, 5*time.Millisecond, logger.New(logger.Options{}))
+	p.Add("wf-1")
+	p.Add("wf-2")
+	go p.Run(ctx)
+
+	for i := 0; i < 2; i++ {
+		select {
+		case workflow := <-p.Requests():
+			if workflow != "wf-1" {
+				t.Fatalf("expected a request for wf-1, got %s", workflow)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected request %d for wf-1", i+1)
+		}
+	}
+	p.Remove("wf-1")
+	// a poll that was already under way may still send it
+	deadline := time.After(50 * time.Millisecond)
+	drained := 0
+	for {
+		select {
+		case <-p.Requests():
+			if drained++; drained > 1 {
+				t.Fatal("expected no more requests once wf-1 was removed")
+			}
+		case <-deadline:
+			return
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+const defaultMaxEvents = 10
+
+type (
+	// Collector gathers the diagnostics of failed steps from the pods they ran in
+	Collector struct {
+		client  kubernetes.Interface
+		options Options
+	}
+
+	// Options control how much is collected
+	Options struct {
+		// LogLines is the number of lines at the end of each failed container's log to collect, 0 collects none
+		LogLines int64
+		// MaxEvents is the number of most recent warning events of the pod to collect
+		MaxEvents int
+	}
+)
+
+// NewCollector builds a Collector
+func NewCollector(client kubernetes.Interface, options Options) *Collector {
+	if options.LogLines < 0 {
+		options.LogLines = 0
+	}
+	if options.MaxEvents < 1 {
+		options.MaxEvents = defaultMaxEvents
+	}
+	return &Collector{
+		client:  client,
+		options: options,
+	}
+}
+
+// Collect gathers the diagnostics of the step whose log is at target: the state of its containers
+// that did not succeed, the end of their logs and the warnings recorded for its pod
+func (c *Collector) Collect(ctx context.Context, target logs.Target) (*reporter.Diagnostics, error) {
+	pod, err := c.client.CoreV1().Pods(target.Namespace).Get(ctx, target.Pod, metav1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pod %s/%s: %w", target.Namespace, target.Pod, err)
+	}
+	diag := &reporter.Diagnostics{
+		Pod:     pod.Name,
+		Reason:  pod.Status.Reason,
+		Message: pod.Status.Message,
+	}
+	for _, container := range target.Containers {
+		cs := containerStatus(pod, container)
+		if cs == nil {
+			continue
+		}
+		cd, failed := getContainerDiagnostics(cs)
+		if !failed {
+			continue
+		}
+		if cs.State.Terminated != nil && c.options.LogLines > 0 {
+			cd.LogTail = c.logTail(ctx, pod, container)
+		}
+		diag.Containers = append(diag.Containers, cd)
+	}
+	events, err := c.podEvents(ctx, pod)
+	if err != nil {
+		return diag, err
+	}
+	diag.Events = events
+	return diag, nil
+}
+
+// getContainerDiagnostics describes the state of a container, and tells if it did not succeed
+func getContainerDiagnostics(cs *corev1.ContainerStatus) (reporter.ContainerDiagnostics, bool) {
+	cd := reporter.ContainerDiagnostics{Name: cs.Name}
+	switch {
+	case cs.State.Terminated != nil:
+		exitCode := cs.State.Terminated.ExitCode
+		cd.ExitCode = &exitCode
+		cd.Reason = cs.State.Terminated.Reason
+		cd.Message = cs.State.Terminated.Message
+		return cd, exitCode != 0
+	case cs.State.Waiting != nil:
+		// a container that never started, e.g. because its image could not be pulled
+		cd.Reason = cs.State.Waiting.Reason
+		cd.Message = cs.State.Waiting.Message
+		return cd, cd.Reason != "" && cd.Reason != "PodInitializing"
+	}
+	return cd, false
+}
+
+// logTail returns the last lines of a container's log, or nothing when it can not be read
+func (c *Collector) logTail(ctx context.Context, pod *corev1.Pod, container string) []string {
+	lines := c.options.LogLines
+	data, err := c.client.CoreV1().Pods(pod.Namespace).GetLogs(pod.Name, &corev1.PodLogOptions{
+		Container: container,
+		TailLines: &lines,
+	}).DoRaw(ctx)
+	if err != nil {
+		return nil
+	}
+	text := strings.TrimRight(string(data), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// podEvents returns the most recent warning events of a pod, oldest first
+func (c *Collector) podEvents(ctx context.Context, pod *corev1.Pod) ([]reporter.DiagnosticsEvent, error) {
+	list, err := c.client.CoreV1().Events(pod.Namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fields.Set{
+			"involvedObject.kind": "Pod",
+			"involvedObject.name": pod.Name,
+			"involvedObject.uid":  string(pod.UID),
+			"type":                corev1.EventTypeWarning,
+		}.String(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events of pod %s/%s: %w", pod.Namespace, pod.Name, err)
+	}
+	var events []reporter.DiagnosticsEvent
+	for _, ev := range list.Items {
+		events = append(events, reporter.DiagnosticsEvent{
+			Type:     ev.Type,
+			Reason:   ev.Reason,
+			Message:  ev.Message,
+			Count:    ev.Count,
+			LastSeen: eventTime(ev).UTC(),
+		})
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].LastSeen.Before(events[j].LastSeen)
+	})
+	if len(events) > c.options.MaxEvents {
+		events = events[len(events)-c.options.MaxEvents:]
+	}
+	return events, nil
+}
+
+func containerStatus(pod *corev1.Pod, container string) *corev1.ContainerStatus {
+	for _, statuses := range [][]corev1.ContainerStatus{pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses} {
+		for i := range statuses {
+			if statuses[i].Name == container {
+				return &statuses[i]
+			}
+		}
+	}
+	return nil
+}
+
+// eventTime returns when an event was last seen, whichever API recorded it
+func eventTime(ev corev1.Event) time.Time {
+	switch {
+	case !ev.LastTimestamp.IsZero():
+		return ev.LastTimestamp.Time
+	case ev.Series != nil:
+		return ev.Series.LastObservedTime.Time
+	case !ev.EventTime.IsZero():
+		return ev.EventTime.Time
+	}
+	return ev.FirstTimestamp.Time
+}
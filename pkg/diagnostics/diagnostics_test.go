@@ -0,0 +1,195 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diagnostics
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var testTime = time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+
+func failedPod(statuses ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns", UID: "uid-pod"},
+		Status:     corev1.PodStatus{Phase: corev1.PodFailed, ContainerStatuses: statuses},
+	}
+}
+
+func terminated(name string, exitCode int32, reason string) corev1.ContainerStatus {
+	return corev1.ContainerStatus{Name: name, State: corev1.ContainerState{
+		Terminated: &corev1.ContainerStateTerminated{ExitCode: exitCode, Reason: reason},
+	}}
+}
+
+func podEvent(reason string, lastSeen time.Duration) corev1.Event {
+	return corev1.Event{
+		ObjectMeta:    metav1.ObjectMeta{Name: reason, Namespace: "ns"},
+		Type:          corev1.EventTypeWarning,
+		Reason:        reason,
+		Message:       reason + " message",
+		Count:         1,
+		LastTimestamp: metav1.NewTime(testTime.Add(lastSeen)),
+	}
+}
+
+// withEvents lists events as the API server would for the field selector of the warnings of pod
+func withEvents(t *testing.T, client *fake.Clientset, events ...corev1.Event) {
+	client.PrependReactor("list", "events", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		selector := action.(k8stesting.ListAction).GetListRestrictions().Fields.String()
+		want := "involvedObject.kind=Pod,involvedObject.name=pod,involvedObject.uid=uid-pod,type=Warning"
+		if selector != want {
+			t.Errorf("listed events with %q, want %q", selector, want)
+		}
+		return true, &corev1.EventList{Items: events}, nil
+	})
+}
+
+func target(containers ...string) logs.Target {
+	return logs.Target{Step: "build", Key: "build", Namespace: "ns", Pod: "pod", Containers: containers}
+}
+
+func TestCollectDescribesTheContainersThatFailed(t *testing.T) {
+	client := fake.NewSimpleClientset(failedPod(
+		terminated("ok", 0, "Completed"),
+		terminated("oom", 137, "OOMKilled"),
+		corev1.ContainerStatus{Name: "pull", State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+		}},
+		corev1.ContainerStatus{Name: "init", State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "PodInitializing"},
+		}},
+	))
+	withEvents(t, client)
+
+	diag, err := NewCollector(client, Options{}).Collect(context.Background(), target("ok", "oom", "pull", "init", "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitCode := int32(137)
+	want := []reporter.ContainerDiagnostics{
+		{Name: "oom", ExitCode: &exitCode, Reason: "OOMKilled"},
+		{Name: "pull", Reason: "ImagePullBackOff", Message: "Back-off pulling image"},
+	}
+	if !reflect.DeepEqual(diag.Containers, want) {
+		t.Errorf("containers are %+v, want %+v", diag.Containers, want)
+	}
+}
+
+func TestCollectKeepsTheReasonOfThePod(t *testing.T) {
+	pod := failedPod(terminated("step", 137, "Error"))
+	pod.Status.Reason = "DeadlineExceeded"
+	pod.Status.Message = "Pod was active on the node longer than the specified deadline"
+	client := fake.NewSimpleClientset(pod)
+	withEvents(t, client)
+
+	diag, err := NewCollector(client, Options{}).Collect(context.Background(), target("step"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diag.Pod != "pod" || diag.Reason != pod.Status.Reason || diag.Message != pod.Status.Message {
+		t.Errorf("diagnostics are %+v", diag)
+	}
+}
+
+func TestCollectKeepsTheLatestWarningsOfThePod(t *testing.T) {
+	client := fake.NewSimpleClientset(failedPod(terminated("step", 1, "Error")))
+	withEvents(t, client,
+		podEvent("Evicted", 3*time.Minute),
+		podEvent("FailedScheduling", time.Minute),
+		podEvent("ImagePullBackOff", 2*time.Minute),
+	)
+
+	diag, err := NewCollector(client, Options{MaxEvents: 2}).Collect(context.Background(), target("step"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reasons []string
+	for _, ev := range diag.Events {
+		reasons = append(reasons, ev.Reason)
+	}
+	if want := []string{"ImagePullBackOff", "Evicted"}; !reflect.DeepEqual(reasons, want) {
+		t.Errorf("events are %q, want %q", reasons, want)
+	}
+	if last := diag.Events[1]; last.Message != "Evicted message" || !last.LastSeen.Equal(testTime.Add(3*time.Minute)) {
+		t.Errorf("last event is %+v", last)
+	}
+}
+
+func TestCollectTailsTheLogOfTerminatedContainers(t *testing.T) {
+	client := fake.NewSimpleClientset(failedPod(
+		terminated("step", 1, "Error"),
+		corev1.ContainerStatus{Name: "pull", State: corev1.ContainerState{
+			Waiting: &corev1.ContainerStateWaiting{Reason: "ErrImagePull"},
+		}},
+	))
+	withEvents(t, client)
+
+	diag, err := NewCollector(client, Options{LogLines: 5}).Collect(context.Background(), target("step", "pull"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the fake clientset answers every log request with the same line
+	if tail := diag.Containers[0].LogTail; !reflect.DeepEqual(tail, []string{"fake logs"}) {
+		t.Errorf("log tail is %q", tail)
+	}
+	if tail := diag.Containers[1].LogTail; tail != nil {
+		t.Errorf("log tail of a container that never ran is %q", tail)
+	}
+	var requested []*corev1.PodLogOptions
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "log" {
+			requested = append(requested, action.(k8stesting.GenericAction).GetValue().(*corev1.PodLogOptions))
+		}
+	}
+	if len(requested) != 1 || requested[0].Container != "step" || requested[0].TailLines == nil || *requested[0].TailLines != 5 {
+		t.Errorf("requested logs %+v", requested)
+	}
+}
+
+func TestCollectReadsNoLogWithoutLines(t *testing.T) {
+	client := fake.NewSimpleClientset(failedPod(terminated("step", 1, "Error")))
+	withEvents(t, client)
+
+	diag, err := NewCollector(client, Options{}).Collect(context.Background(), target("step"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diag.Containers[0].LogTail != nil {
+		t.Errorf("log tail is %q", diag.Containers[0].LogTail)
+	}
+	for _, action := range client.Actions() {
+		if action.GetSubresource() == "log" {
+			t.Error("requested the log")
+		}
+	}
+}
+
+func TestCollectFailsWithoutThePod(t *testing.T) {
+	if _, err := NewCollector(fake.NewSimpleClientset(), Options{}).Collect(context.Background(), target("step")); err == nil {
+		t.Error("expected an error")
+	}
+}
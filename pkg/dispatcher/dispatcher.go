@@ -0,0 +1,211 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+const (
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = time.Minute
+)
+
+// ErrClosed is returned when reporting to a dispatcher that was closed
+var ErrClosed = errors.New("dispatcher is closed")
+
+type (
+	// Queue delivers reports in the background. Reports of the same workflow are always
+	// delivered in the order they were queued, and queueing blocks while the workflow's
+	// queue is full. A report that fails to be delivered is retried until it is delivered,
+	// it fails permanently (see reporter.Permanent) or the delivery context is done
+	Queue struct {
+		ctx     context.Context
+		cancel  context.CancelFunc
+		logger  logger.Logger
+		options Options
+		queues  []chan task
+		wg      sync.WaitGroup
+		mu      sync.RWMutex
+		closed  bool
+	}
+
+	// Dispatcher implements reporter.CodefreshAPI by queueing reports and
+	// delivering them to another CodefreshAPI in the background
+	Dispatcher struct {
+		*Queue
+		api reporter.CodefreshAPI
+	}
+
+	// Options to build new Queue or Dispatcher
+	Options struct {
+		// Workers is the number of queues, each delivered by its own goroutine
+		Workers int
+		// QueueSize is the number of reports each queue holds before reporting blocks
+		QueueSize int
+		// RetryDelay is the delay before retrying a failed delivery, doubled on every attempt
+		RetryDelay time.Duration
+		// MaxRetryDelay caps the delay between attempts
+		MaxRetryDelay time.Duration
+		// DrainTimeout is how long closing waits for the queued reports to be delivered
+		// before giving up on them, 0 waits until the delivery context is done
+		DrainTimeout time.Duration
+	}
+
+	task struct {
+		workflow string
+		desc     []interface{}
+		send     func(ctx context.Context) error
+	}
+)
+
+// NewQueue builds a Queue and starts its workers. Reports are delivered with ctx
+// rather than the context they were queued with, so they can outlive it
+func NewQueue(ctx context.Context, lgr logger.Logger, options Options) *Queue {
+	if options.Workers < 1 {
+		options.Workers = 1
+	}
+	if options.QueueSize < 0 {
+		options.QueueSize = 0
+	}
+	if options.RetryDelay <= 0 {
+		options.RetryDelay = defaultRetryDelay
+	}
+	if options.MaxRetryDelay <= 0 {
+		options.MaxRetryDelay = defaultMaxRetryDelay
+	}
+	q := &Queue{
+		logger:  lgr,
+		options: options,
+		queues:  make([]chan task, options.Workers),
+	}
+	q.ctx, q.cancel = context.WithCancel(ctx)
+	for i := range q.queues {
+		q.queues[i] = make(chan task, options.QueueSize)
+		q.wg.Add(1)
+		go q.work(q.queues[i])
+	}
+	return q
+}
+
+// New builds a Dispatcher delivering to api and starts its workers
+func New(ctx context.Context, api reporter.CodefreshAPI, lgr logger.Logger, options Options) *Dispatcher {
+	return &Dispatcher{
+		Queue: NewQueue(ctx, lgr, options),
+		api:   api,
+	}
+}
+
+func (d *Dispatcher) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return d.Dispatch(ctx, workflow, []interface{}{"workflow", workflow, "status", status}, func(ctx context.Context) error {
+		return d.api.ReportWorkflowStaus(ctx, workflow, status, err)
+	})
+}
+
+func (d *Dispatcher) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	return d.Dispatch(ctx, workflow, []interface{}{"workflow", workflow, "step", step.Name, "status", step.Status}, func(ctx context.Context) error {
+		return d.api.ReportWorkflowStepStaus(ctx, workflow, step)
+	})
+}
+
+func (d *Dispatcher) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	return d.Dispatch(ctx, workflow, []interface{}{"workflow", workflow, "variables", len(variables)}, func(ctx context.Context) error {
+		return d.api.ReportWorkflowVariables(ctx, workflow, variables)
+	})
+}
+
+// Dispatch queues send to be called in the background, after the reports that were queued
+// before it for the same workflow. desc describes the report in logs
+func (q *Queue) Dispatch(ctx context.Context, workflow string, desc []interface{}, send func(ctx context.Context) error) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrClosed
+	}
+	select {
+	case q.queues[q.shard(workflow)] <- task{workflow: workflow, desc: desc, send: send}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting reports and waits until every queued report was delivered,
+// or failed to be delivered for good
+func (q *Queue) Close() {
+	q.mu.Lock()
+	if q.closed {
+		q.mu.Unlock()
+		return
+	}
+	q.closed = true
+	for _, c := range q.queues {
+		close(c)
+	}
+	q.mu.Unlock()
+	if q.options.DrainTimeout > 0 {
+		timer := time.AfterFunc(q.options.DrainTimeout, q.cancel)
+		defer timer.Stop()
+	}
+	q.wg.Wait()
+	q.cancel()
+}
+
+// shard maps a workflow to a single queue, which keeps its reports ordered
+func (q *Queue) shard(workflow string) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(workflow))
+	return int(h.Sum32() % uint32(len(q.queues)))
+}
+
+func (q *Queue) work(c chan task) {
+	defer q.wg.Done()
+	for t := range c {
+		q.deliver(t)
+	}
+}
+
+// deliver sends a report, retrying until it is delivered. The reports queued after it
+// for the same workflow wait meanwhile, so they are never delivered before it
+func (q *Queue) deliver(t task) {
+	delay := q.options.RetryDelay
+	for attempt := 1; ; attempt++ {
+		err := t.send(q.ctx)
+		if err == nil {
+			return
+		}
+		if reporter.IsPermanent(err) || q.ctx.Err() != nil {
+			q.logger.Err(err, "failed to deliver report", t.desc...)
+			return
+		}
+		q.logger.Err(err, "failed to deliver report, retrying", append([]interface{}{"attempt", attempt, "delay", delay.String()}, t.desc...)...)
+		select {
+		case <-time.After(delay):
+		case <-q.ctx.Done():
+			q.logger.Err(err, "failed to deliver report", t.desc...)
+			return
+		}
+		if delay *= 2; delay > q.options.MaxRetryDelay {
+			delay = q.options.MaxRetryDelay
+		}
+	}
+}
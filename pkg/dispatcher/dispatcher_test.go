@@ -0,0 +1,139 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// flakyAPI fails the first attempts to deliver each report, with err when it is set
+type flakyAPI struct {
+	mu       sync.Mutex
+	failures int
+	err      error
+	attempts map[string]int
+	reports  []string
+}
+
+func (f *flakyAPI) report(desc string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.attempts == nil {
+		f.attempts = map[string]int{}
+	}
+	f.attempts[desc]++
+	if f.attempts[desc] <= f.failures {
+		if f.err != nil {
+			return f.err
+		}
+		return errors.New("unavailable")
+	}
+	f.reports = append(f.reports, desc)
+	return nil
+}
+
+func (f *flakyAPI) ReportWorkflowStaus(_ context.Context, workflow string, status reporter.WorkflowStatus, _ error) error {
+	return f.report(workflow + ":" + string(status))
+}
+
+func (f *flakyAPI) ReportWorkflowStepStaus(_ context.Context, workflow string, step reporter.WorkflowStep) error {
+	return f.report(workflow + ":" + step.Name + "=" + string(step.Status))
+}
+
+func (f *flakyAPI) ReportWorkflowVariables(_ context.Context, workflow string, variables []reporter.Variable) error {
+	return f.report(fmt.Sprintf("%s:variables=%d", workflow, len(variables)))
+}
+
+func (f *flakyAPI) delivered() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.reports...)
+}
+
+func testOptions() Options {
+	return Options{Workers: 2, QueueSize: 10, RetryDelay: time.Millisecond, MaxRetryDelay: 5 * time.Millisecond}
+}
+
+func TestFailedReportsAreRetriedInOrder(t *testing.T) {
+	api := &flakyAPI{failures: 2}
+	d := New(context.Background(), api, logger.New(logger.Options{}), testOptions())
+	ctx := context.Background()
+
+	steps := []string{"clone", "build", "test"}
+	for _, name := range steps {
+		if err := d.ReportWorkflowStepStaus(ctx, "wf", reporter.WorkflowStep{Name: name, Status: reporter.WorkflowStepRunning}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	want := []string{"wf:clone=running", "wf:build=running", "wf:test=running", "wf:success"}
+	if got := api.delivered(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestPermanentFailuresAreNotRetried(t *testing.T) {
+	api := &flakyAPI{failures: 1, err: reporter.Permanent(errors.New("bad request"))}
+	d := New(context.Background(), api, logger.New(logger.Options{}), testOptions())
+
+	if err := d.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	d.Close()
+
+	if got := api.delivered(); len(got) != 0 {
+		t.Fatalf("delivered %v", got)
+	}
+	if n := api.attempts["wf:running"]; n != 1 {
+		t.Fatalf("permanent failure was attempted %d times", n)
+	}
+}
+
+func TestCloseGivesUpAfterDrainTimeout(t *testing.T) {
+	api := &flakyAPI{failures: 1 << 30}
+	options := testOptions()
+	options.DrainTimeout = 50 * time.Millisecond
+	d := New(context.Background(), api, logger.New(logger.Options{}), options)
+
+	if err := d.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not give up on the failing report")
+	}
+	if err := d.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowSucceded, nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("reporting after Close returned %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/rest"
+)
+
+// ReportedAnnotation is set on the runs whose final state was reported, which are not reported again
+const ReportedAnnotation = "codefresh.io/reported-status"
+
+type (
+	// Engine is a source of workflow runs, such as Tekton pipelineruns or Argo workflows
+	Engine interface {
+		// Name of the engine, as selected by the user
+		Name() string
+		// Watch streams the state of the matching runs until ctx is done, when the channel is closed
+		Watch(ctx context.Context, options WatchOptions) (<-chan Event, error)
+		// Snapshot translates the state of a run into the workflow state it represents
+		Snapshot(run *Run) (*reporter.Workflow, error)
+		// HasFinished tells if a run has reached a final state
+		HasFinished(run *Run) bool
+		// WorkflowSelector returns the label selector of the runs of a single workflow
+		WorkflowSelector(workflowID string) string
+	}
+
+	// LogSource is implemented by engines that know where the logs of a run's steps are
+	LogSource interface {
+		// LogTargets returns the logs of the steps of a run that have started
+		LogTargets(run *Run) []logs.Target
+	}
+
+	// Canceller is implemented by engines that can stop a run before it finishes
+	Canceller interface {
+		// Cancel asks the engine to stop the run. The run reports its new state once it stopped
+		Cancel(ctx context.Context, run *Run) error
+	}
+
+	// Approver is implemented by engines that can resolve steps waiting for an approval
+	Approver interface {
+		// Resolve lets the step waiting for an approval go on, or fail when it was not approved
+		Resolve(ctx context.Context, run *Run, step string, approved bool) error
+	}
+
+	// Marker is implemented by engines that can record on a run that its final state was reported
+	Marker interface {
+		// MarkReported sets the ReportedAnnotation of the run to the final status it was reported with
+		MarkReported(ctx context.Context, run *Run, status string) error
+	}
+
+	// ParamSource is implemented by engines whose runs are started with parameters
+	ParamSource interface {
+		// Params returns the string parameters of a run by name
+		Params(run *Run) map[string]string
+	}
+
+	// Factory builds an Engine that talks to the cluster described by config
+	Factory func(config *rest.Config, options Options, lgr logger.Logger) (Engine, error)
+
+	// Options control how an engine translates runs into workflows.
+	// Engines ignore the options they do not support
+	Options struct {
+		// StepPerContainer reports each container of a task as a step of its own,
+		// instead of a single step for the whole task
+		StepPerContainer bool
+		// WorkflowIDLabel is the label holding the workflow ID of a run,
+		// for engines that group the objects of a run by it
+		WorkflowIDLabel string
+	}
+
+	// WatchOptions select the runs to watch
+	WatchOptions struct {
+		// Namespace to watch, empty for all namespaces
+		Namespace     string
+		LabelSelector string
+		// ResyncPeriod is how often every run is sent again, even if it did not change. 0 disables resyncs
+		ResyncPeriod time.Duration
+		// Informer prefers a shared informer over a list and watch loop, for engines that support both
+		Informer bool
+	}
+
+	// Run is a single execution of a workflow
+	Run struct {
+		UID         types.UID
+		Kind        string
+		Name        string
+		Namespace   string
+		Labels      map[string]string
+		Annotations map[string]string
+		// FinishedAt is when the run reached a final state as recorded by the cluster,
+		// zero while it is still going or when the engine does not know
+		FinishedAt time.Time
+		// Object is the engine specific object of the run
+		Object interface{}
+	}
+
+	// Event is the latest known state of a run
+	Event struct {
+		Run     *Run
+		Deleted bool
+	}
+)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]Factory{}
+)
+
+// Register makes an engine available by name, it is meant to be called from the engine's init
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("engine %q is already registered", name))
+	}
+	factories[name] = factory
+}
+
+// New builds the engine registered by name
+func New(name string, config *rest.Config, options Options, lgr logger.Logger) (Engine, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q, expected one of %v", name, Names())
+	}
+	return factory(config, options, lgr)
+}
+
+// IsRegistered tells if an engine was registered with the given name
+func IsRegistered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+// Names returns the names of the registered engines
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Forward runs forward in the background to turn the events of an engine's watcher into run events,
+// which it sends with send until it returns or send fails because ctx is done. The returned channel is closed then
+func Forward(ctx context.Context, forward func(send func(Event) bool)) <-chan Event {
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		forward(func(ev Event) bool {
+			select {
+			case events <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		})
+	}()
+	return events
+}
+
+// String describes the run for logs and messages
+func (r *Run) String() string {
+	return fmt.Sprintf("%s %s/%s", r.Kind, r.Namespace, r.Name)
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"k8s.io/client-go/rest"
+)
+
+// testEngine is an engine that only knows its name
+type testEngine struct {
+	name string
+}
+
+func (e *testEngine) Name() string {
+	return e.name
+}
+
+func (e *testEngine) Watch(context.Context, WatchOptions) (<-chan Event, error) {
+	return nil, errors.New("not watchable")
+}
+
+func (e *testEngine) Snapshot(*Run) (*reporter.Workflow, error) {
+	return reporter.NewWorkflow(), nil
+}
+
+func (e *testEngine) HasFinished(*Run) bool {
+	return false
+}
+
+func (e *testEngine) WorkflowSelector(workflowID string) string {
+	return "id=" + workflowID
+}
+
+// register registers a test engine, which is dropped once the test is over
+func register(t *testing.T, name string, factory Factory) {
+	Register(name, factory)
+	t.Cleanup(func() {
+		factoriesMu.Lock()
+		defer factoriesMu.Unlock()
+		delete(factories, name)
+	})
+}
+
+func TestNewBuildsTheRegisteredEngine(t *testing.T) {
+	var got Options
+	register(t, "test", func(_ *rest.Config, options Options, _ logger.Logger) (Engine, error) {
+		got = options
+		return &testEngine{name: "test"}, nil
+	})
+
+	options := Options{StepPerContainer: true, WorkflowIDLabel: "example.com/id"}
+	eng, err := New("test", &rest.Config{}, options, logger.New(logger.Options{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if eng.Name() != "test" || got != options {
+		t.Errorf("built %q with %+v", eng.Name(), got)
+	}
+	if !IsRegistered("test") {
+		t.Error("the engine is not registered")
+	}
+}
+
+func TestNewFailsWhenTheFactoryFails(t *testing.T) {
+	register(t, "test", func(*rest.Config, Options, logger.Logger) (Engine, error) {
+		return nil, errors.New("no cluster")
+	})
+	if _, err := New("test", &rest.Config{}, Options{}, logger.New(logger.Options{})); err == nil || err.Error() != "no cluster" {
+		t.Errorf("expected the factory's error, got %v", err)
+	}
+}
+
+func TestNewFailsForAnUnknownEngine(t *testing.T) {
+	register(t, "b", nil)
+	register(t, "a", nil)
+
+	_, err := New("unknown", &rest.Config{}, Options{}, logger.New(logger.Options{}))
+	if err == nil || err.Error() != `unknown engine "unknown", expected one of [a b]` {
+		t.Errorf("unexpected error %v", err)
+	}
+	if IsRegistered("unknown") {
+		t.Error("an unknown engine is registered")
+	}
+}
+
+func TestNamesAreSorted(t *testing.T) {
+	register(t, "b", nil)
+	register(t, "c", nil)
+	register(t, "a", nil)
+
+	if names := Names(); !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("names are %q", names)
+	}
+}
+
+func TestRegisterPanicsOnADuplicate(t *testing.T) {
+	register(t, "test", nil)
+	defer func() {
+		if r := recover(); r != `engine "test" is already registered` {
+			t.Errorf("unexpected panic %v", r)
+		}
+	}()
+	Register("test", nil)
+}
+
+func TestForwardSendsEveryEventThenCloses(t *testing.T) {
+	runs := []*Run{{Name: "a"}, {Name: "b"}}
+	events := Forward(context.Background(), func(send func(Event) bool) {
+		for _, run := range runs {
+			if !send(Event{Run: run}) {
+				return
+			}
+		}
+	})
+
+	var got []*Run
+	for ev := range events {
+		got = append(got, ev.Run)
+	}
+	if !reflect.DeepEqual(got, runs) {
+		t.Errorf("forwarded %v", got)
+	}
+}
+
+func TestForwardStopsOnceTheContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan bool, 1)
+	events := Forward(ctx, func(send func(Event) bool) {
+		send(Event{Run: &Run{Name: "a"}})
+		// nobody receives this one
+		stopped <- !send(Event{Run: &Run{Name: "b"}})
+	})
+
+	<-events
+	cancel()
+	select {
+	case ok := <-stopped:
+		if !ok {
+			t.Error("send succeeded once the context was done")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("send blocked once the context was done")
+	}
+	if _, open := <-events; open {
+		t.Error("the events were not closed")
+	}
+}
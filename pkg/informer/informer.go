@@ -0,0 +1,66 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package informer forwards the notifications of shared informers to the channels of the watchers
+package informer
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// Gate lets informer handlers send to a channel that is closed once the informers are stopped.
+// Handlers may still be running after the informers are stopped, so closing the channel
+// must wait for the ones that are sending
+type Gate struct {
+	mu     sync.RWMutex
+	closed bool
+}
+
+// Send calls send unless the gate is closed, send must return once the watch context is done
+func (g *Gate) Send(send func()) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+	if !g.closed {
+		send()
+	}
+}
+
+// Close calls close once no handler is sending, the sends that come after it are dropped
+func (g *Gate) Close(close func()) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.closed = true
+	close()
+}
+
+// Handler calls handle for every object that is added, updated or deleted,
+// with the last known state of the objects that were deleted while the informer was not watching
+func Handler(handle func(obj interface{}, deleted bool)) cache.ResourceEventHandler {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			handle(obj, false)
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			handle(obj, false)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			handle(obj, true)
+		},
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package informer
+
+import (
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestGateDropsSendsAfterClose(t *testing.T) {
+	events := make(chan int, 1)
+	var g Gate
+	g.Send(func() { events <- 1 })
+	g.Close(func() { close(events) })
+	// would panic on the closed channel
+	g.Send(func() { events <- 2 })
+
+	var got []int
+	for ev := range events {
+		got = append(got, ev)
+	}
+	if len(got) != 1 || got[0] != 1 {
+		t.Errorf("expected only the send before close, got %v", got)
+	}
+}
+
+func TestGateCloseWaitsForSends(t *testing.T) {
+	events := make(chan int)
+	var g Gate
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go g.Send(func() {
+		wg.Done()
+		events <- 1
+	})
+	wg.Wait()
+	closed := make(chan struct{})
+	go func() {
+		g.Close(func() { close(events) })
+		close(closed)
+	}()
+	if ev := <-events; ev != 1 {
+		t.Fatalf("expected the pending send, got %d", ev)
+	}
+	<-closed
+	if _, ok := <-events; ok {
+		t.Error("expected the channel to be closed")
+	}
+}
+
+func TestHandlerUnwrapsTombstones(t *testing.T) {
+	var gotObj interface{}
+	var gotDeleted bool
+	h := Handler(func(obj interface{}, deleted bool) {
+		gotObj, gotDeleted = obj, deleted
+	})
+	h.OnDelete(cache.DeletedFinalStateUnknown{Key: "ns/a", Obj: "a"})
+	if gotObj != "a" || !gotDeleted {
+		t.Errorf("expected the deleted object, got %v deleted=%v", gotObj, gotDeleted)
+	}
+	h.OnUpdate("a", "b")
+	if gotObj != "b" || gotDeleted {
+		t.Errorf("expected the new object, got %v deleted=%v", gotObj, gotDeleted)
+	}
+}
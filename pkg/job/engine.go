@@ -0,0 +1,145 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// EngineName selects the Job engine
+const EngineName = "job"
+
+// Engine implements engine.Engine for groups of Kubernetes jobs, and for the jobs created by a CronJob
+type Engine struct {
+	client     kubernetes.Interface
+	groupLabel string
+	logger     logger.Logger
+}
+
+func init() {
+	engine.Register(EngineName, NewEngine)
+}
+
+// NewEngine builds the Job engine
+func NewEngine(config *rest.Config, options engine.Options, lgr logger.Logger) (engine.Engine, error) {
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	groupLabel := options.WorkflowIDLabel
+	if groupLabel == "" {
+		groupLabel = GroupLabel
+	}
+	return &Engine{
+		client:     client,
+		groupLabel: groupLabel,
+		logger:     lgr,
+	}, nil
+}
+
+func (e *Engine) Name() string {
+	return EngineName
+}
+
+// Watch always uses informers, options.Informer is ignored
+func (e *Engine) Watch(ctx context.Context, options engine.WatchOptions) (<-chan engine.Event, error) {
+	w := &Watcher{
+		Client:        e.client,
+		Namespace:     options.Namespace,
+		LabelSelector: options.LabelSelector,
+		ResyncPeriod:  options.ResyncPeriod,
+		GroupLabel:    e.groupLabel,
+		Logger:        e.logger,
+	}
+	return engine.Forward(ctx, func(send func(engine.Event) bool) {
+		for ev := range w.Watch(ctx) {
+			if !send(engine.Event{Run: newRun(ev.Group, e.groupLabel), Deleted: ev.Deleted}) {
+				return
+			}
+		}
+	}), nil
+}
+
+func (e *Engine) Snapshot(run *engine.Run) (*reporter.Workflow, error) {
+	g, err := group(run)
+	if err != nil {
+		return nil, err
+	}
+	return GetWorkflowSnapshot(g)
+}
+
+func (e *Engine) HasFinished(run *engine.Run) bool {
+	g, err := group(run)
+	return err == nil && GroupHasFinished(g)
+}
+
+func (e *Engine) WorkflowSelector(workflowID string) string {
+	return fmt.Sprintf("%s=%s", e.groupLabel, workflowID)
+}
+
+// MarkReported annotates every job of the group with the final status it was reported with
+func (e *Engine) MarkReported(ctx context.Context, run *engine.Run, status string) error {
+	g, err := group(run)
+	if err != nil {
+		return err
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{engine.ReportedAnnotation: status},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	for _, job := range g.Jobs {
+		if _, err := e.client.BatchV1().Jobs(job.Namespace).Patch(ctx, job.Name, types.MergePatchType, patch, metav1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newRun describes a group with the metadata of its first job,
+// a job without the group label is identified by its own UID
+func newRun(g *Group, groupLabel string) *engine.Run {
+	run := &engine.Run{
+		UID:       types.UID(fmt.Sprintf("jobs/%s/%s", g.Namespace, g.Name)),
+		Kind:      "jobs",
+		Name:      g.Name,
+		Namespace: g.Namespace,
+		Object:    g,
+	}
+	if len(g.Jobs) > 0 {
+		first := g.Jobs[0]
+		run.Labels = first.Labels
+		run.Annotations = first.Annotations
+		if first.Labels[groupLabel] == "" {
+			run.UID = first.UID
+		}
+	}
+	if GroupHasFinished(g) {
+		for _, job := range g.Jobs {
+			if _, finishedAt := getJobTimes(job); finishedAt.After(run.FinishedAt) {
+				run.FinishedAt = finishedAt
+			}
+		}
+	}
+	return run
+}
+
+func group(run *engine.Run) (*Group, error) {
+	g, ok := run.Object.(*Group)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a group of jobs", run)
+	}
+	return g, nil
+}
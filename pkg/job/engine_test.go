@@ -0,0 +1,81 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func completedJob(name string, labels map[string]string, completedAt time.Time) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns", UID: types.UID("uid-" + name), Labels: labels},
+		Status: batchv1.JobStatus{
+			CompletionTime: &metav1.Time{Time: completedAt},
+			Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobComplete, Status: corev1.ConditionTrue},
+			},
+		},
+	}
+}
+
+func TestKeyOfUsesTheGroupLabel(t *testing.T) {
+	job := completedJob("a", map[string]string{"example.com/wf": "wf-1"}, time.Now())
+	if k := keyOf(job, "example.com/wf"); k.group != "wf-1" {
+		t.Errorf("expected the job to be grouped as wf-1, got %+v", k)
+	}
+	if k := keyOf(job, GroupLabel); k.group != "" || k.job != "a" {
+		t.Errorf("expected the job to be a group of its own, got %+v", k)
+	}
+}
+
+func TestNewRunFinishesWithTheLastJob(t *testing.T) {
+	labels := map[string]string{"example.com/wf": "wf-1"}
+	first := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	last := first.Add(time.Minute)
+	g := &Group{
+		Name:      "wf-1",
+		Namespace: "ns",
+		Jobs:      []*batchv1.Job{completedJob("a", labels, last), completedJob("b", labels, first)},
+	}
+	run := newRun(g, "example.com/wf")
+	if !run.FinishedAt.Equal(last) {
+		t.Errorf("expected the run to finish at %v, got %v", last, run.FinishedAt)
+	}
+	if run.UID != "jobs/ns/wf-1" {
+		t.Errorf("expected the run to be identified by its group, got %q", run.UID)
+	}
+
+	g.Jobs[1].Status = batchv1.JobStatus{}
+	if run := newRun(g, "example.com/wf"); !run.FinishedAt.IsZero() {
+		t.Errorf("expected a running group to have no finish time, got %v", run.FinishedAt)
+	}
+}
+
+func TestMarkReportedAnnotatesEveryJob(t *testing.T) {
+	labels := map[string]string{"example.com/wf": "wf-1"}
+	a, b := completedJob("a", labels, time.Now()), completedJob("b", labels, time.Now())
+	client := fake.NewSimpleClientset(a, b)
+	e := &Engine{client: client, groupLabel: "example.com/wf"}
+
+	run := newRun(&Group{Name: "wf-1", Namespace: "ns", Jobs: []*batchv1.Job{a, b}}, e.groupLabel)
+	if err := e.MarkReported(context.Background(), run, "success"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		job, err := client.BatchV1().Jobs("ns").Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := job.Annotations[engine.ReportedAnnotation]; got != "success" {
+			t.Errorf("expected job %s to be marked as reported, got %q", name, got)
+		}
+	}
+}
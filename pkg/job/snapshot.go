@@ -0,0 +1,182 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// jobReasonDeadlineExceeded is the reason of the failure of a job that ran longer than its active deadline
+const jobReasonDeadlineExceeded = "DeadlineExceeded"
+
+// GetWorkflowSnapshot translates the current state of a group of jobs into a workflow.
+// A job whose pod has a single container is a single step, otherwise each container
+// is a step of its own, named "<job>/<container>"
+func GetWorkflowSnapshot(g *Group) (*reporter.Workflow, error) {
+	workflow := reporter.NewWorkflow()
+	workflow.Status, workflow.Err = GetGroupStatus(g)
+
+	for _, job := range g.Jobs {
+		status, err := GetJobStatus(job, g.Pods[job.Name])
+		startedAt, finishedAt := getJobTimes(job)
+		containers := job.Spec.Template.Spec.Containers
+		if len(containers) <= 1 {
+			workflow.AddStep(job.Name, &reporter.WorkflowStep{
+				Name:       job.Name,
+				Status:     status,
+				Err:        err,
+				StartedAt:  startedAt,
+				FinishedAt: finishedAt,
+			})
+			continue
+		}
+		pod := latestPod(g.Pods[job.Name])
+		for _, c := range containers {
+			name := fmt.Sprintf("%s/%s", job.Name, c.Name)
+			step := getContainerStep(name, c.Name, pod)
+			if status.IsFailure() && !step.Status.IsFinal() {
+				// the job gave up on the containers that did not finish
+				step.Status, step.Err, step.FinishedAt = status, err, finishedAt
+			}
+			workflow.AddStep(name, step)
+		}
+	}
+	return workflow, nil
+}
+
+// GetGroupStatus returns the workflow status of a group of jobs, which failed
+// once any of its jobs failed and succeeded once all of them completed
+func GetGroupStatus(g *Group) (reporter.WorkflowStatus, error) {
+	if len(g.Jobs) == 0 {
+		return reporter.WorkflowPending, nil
+	}
+	completed := 0
+	started := false
+	for _, job := range g.Jobs {
+		status, err := GetJobStatus(job, g.Pods[job.Name])
+		switch status {
+		case reporter.WorkflowStepFailed:
+			return reporter.WorkflowFailed, err
+		case reporter.WorkflowStepTimeout:
+			return reporter.WorkflowTimeout, err
+		case reporter.WorkflowStepSucceded:
+			completed++
+			started = true
+		case reporter.WorkflowStepRunning:
+			started = true
+		}
+	}
+	if completed == len(g.Jobs) {
+		return reporter.WorkflowSucceded, nil
+	}
+	if started {
+		return reporter.WorkflowRunning, nil
+	}
+	return reporter.WorkflowPending, nil
+}
+
+// GetJobStatus returns the step status of a job from its conditions, and from its pods
+// while it has none. A job is running once any of its pods ran
+func GetJobStatus(job *batchv1.Job, pods []*corev1.Pod) (reporter.WorkflowStepStatus, error) {
+	if cond := jobCondition(job, batchv1.JobFailed); cond != nil {
+		if cond.Reason == jobReasonDeadlineExceeded {
+			return reporter.WorkflowStepTimeout, fmt.Errorf("%s: %s", cond.Reason, cond.Message)
+		}
+		return reporter.WorkflowStepFailed, fmt.Errorf("%s: %s", cond.Reason, cond.Message)
+	}
+	if cond := jobCondition(job, batchv1.JobComplete); cond != nil {
+		return reporter.WorkflowStepSucceded, nil
+	}
+	if job.Status.Succeeded > 0 || job.Status.Failed > 0 {
+		return reporter.WorkflowStepRunning, nil
+	}
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodPending {
+			return reporter.WorkflowStepRunning, nil
+		}
+	}
+	return reporter.WorkflowStepPending, nil
+}
+
+// GroupHasFinished tells if every job of the group has completed or failed
+func GroupHasFinished(g *Group) bool {
+	for _, job := range g.Jobs {
+		if jobCondition(job, batchv1.JobComplete) == nil && jobCondition(job, batchv1.JobFailed) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// getContainerStep returns the step of a container from the state it has in pod
+func getContainerStep(stepName, container string, pod *corev1.Pod) *reporter.WorkflowStep {
+	step := &reporter.WorkflowStep{
+		Name:   stepName,
+		Status: reporter.WorkflowStepPending,
+	}
+	if pod == nil {
+		return step
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name != container {
+			continue
+		}
+		switch {
+		case cs.State.Terminated != nil:
+			t := cs.State.Terminated
+			exitCode := t.ExitCode
+			step.ExitCode = &exitCode
+			step.StartedAt = t.StartedAt.Time
+			step.FinishedAt = t.FinishedAt.Time
+			step.Status = reporter.WorkflowStepSucceded
+			if exitCode != 0 {
+				step.Status = reporter.WorkflowStepFailed
+				step.Err = fmt.Errorf("container %s exited with code %d: %s", container, exitCode, strings.TrimSpace(t.Reason+" "+t.Message))
+			}
+		case cs.State.Running != nil:
+			step.Status = reporter.WorkflowStepRunning
+			step.StartedAt = cs.State.Running.StartedAt.Time
+		}
+	}
+	return step
+}
+
+// getJobTimes returns when a job started and finished, the latter being zero while it runs
+func getJobTimes(job *batchv1.Job) (time.Time, time.Time) {
+	var startedAt, finishedAt time.Time
+	if job.Status.StartTime != nil {
+		startedAt = job.Status.StartTime.Time
+	}
+	if job.Status.CompletionTime != nil {
+		finishedAt = job.Status.CompletionTime.Time
+	} else if cond := jobCondition(job, batchv1.JobFailed); cond != nil {
+		// only successful jobs have a completion time
+		finishedAt = cond.LastTransitionTime.Time
+	}
+	return startedAt, finishedAt
+}
+
+func jobCondition(job *batchv1.Job, condType batchv1.JobConditionType) *batchv1.JobCondition {
+	for i, cond := range job.Status.Conditions {
+		if cond.Type == condType && cond.Status == corev1.ConditionTrue {
+			return &job.Status.Conditions[i]
+		}
+	}
+	return nil
+}
+
+// latestPod returns the pod that was created last, which holds the latest attempt of the job
+func latestPod(pods []*corev1.Pod) *corev1.Pod {
+	var latest *corev1.Pod
+	for _, pod := range pods {
+		if latest == nil || latest.CreationTimestamp.Before(&pod.CreationTimestamp) {
+			latest = pod
+		}
+	}
+	return latest
+}
@@ -0,0 +1,184 @@
+package job
+
+import (
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func jobWith(name string, status batchv1.JobStatus, containers ...string) *batchv1.Job {
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ns"},
+		Status:     status,
+	}
+	for _, c := range containers {
+		job.Spec.Template.Spec.Containers = append(job.Spec.Template.Spec.Containers, corev1.Container{Name: c})
+	}
+	return job
+}
+
+func condition(condType batchv1.JobConditionType, reason string) batchv1.JobStatus {
+	return batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+		{Type: condType, Status: corev1.ConditionTrue, Reason: reason, Message: "message"},
+	}}
+}
+
+func podIn(phase corev1.PodPhase, containers ...corev1.ContainerStatus) *corev1.Pod {
+	return &corev1.Pod{Status: corev1.PodStatus{Phase: phase, ContainerStatuses: containers}}
+}
+
+func TestGetJobStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  batchv1.JobStatus
+		pods    []*corev1.Pod
+		want    reporter.WorkflowStepStatus
+		wantErr string
+	}{
+		{name: "complete", status: condition(batchv1.JobComplete, ""), want: reporter.WorkflowStepSucceded},
+		{name: "failed", status: condition(batchv1.JobFailed, "BackoffLimitExceeded"), want: reporter.WorkflowStepFailed, wantErr: "BackoffLimitExceeded: message"},
+		{name: "deadline exceeded", status: condition(batchv1.JobFailed, "DeadlineExceeded"), want: reporter.WorkflowStepTimeout, wantErr: "DeadlineExceeded: message"},
+		{
+			name: "condition not true",
+			status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+				{Type: batchv1.JobFailed, Status: corev1.ConditionFalse},
+			}},
+			want: reporter.WorkflowStepPending,
+		},
+		{name: "retrying", status: batchv1.JobStatus{Failed: 1}, want: reporter.WorkflowStepRunning},
+		{name: "pod running", pods: []*corev1.Pod{podIn(corev1.PodPending), podIn(corev1.PodRunning)}, want: reporter.WorkflowStepRunning},
+		{name: "pod pending", pods: []*corev1.Pod{podIn(corev1.PodPending)}, want: reporter.WorkflowStepPending},
+		{name: "no pods", want: reporter.WorkflowStepPending},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := GetJobStatus(jobWith("a", tt.status), tt.pods)
+			if got != tt.want {
+				t.Errorf("GetJobStatus() = %q, want %q", got, tt.want)
+			}
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("GetJobStatus() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetGroupStatus(t *testing.T) {
+	complete := condition(batchv1.JobComplete, "")
+	tests := []struct {
+		name   string
+		jobs   []batchv1.JobStatus
+		pods   []*corev1.Pod
+		want   reporter.WorkflowStatus
+		failed bool
+	}{
+		{name: "no jobs", want: reporter.WorkflowPending},
+		{name: "all pending", jobs: []batchv1.JobStatus{{}, {}}, want: reporter.WorkflowPending},
+		{name: "some complete", jobs: []batchv1.JobStatus{complete, {}}, want: reporter.WorkflowRunning},
+		{name: "first running", jobs: []batchv1.JobStatus{{}, {}}, pods: []*corev1.Pod{podIn(corev1.PodRunning)}, want: reporter.WorkflowRunning},
+		{name: "all complete", jobs: []batchv1.JobStatus{complete, complete}, want: reporter.WorkflowSucceded},
+		{name: "one failed", jobs: []batchv1.JobStatus{complete, condition(batchv1.JobFailed, "BackoffLimitExceeded"), {}}, want: reporter.WorkflowFailed, failed: true},
+		{name: "one timed out", jobs: []batchv1.JobStatus{condition(batchv1.JobFailed, "DeadlineExceeded"), {}}, want: reporter.WorkflowTimeout, failed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &Group{Name: "wf", Namespace: "ns", Pods: map[string][]*corev1.Pod{}}
+			for i, status := range tt.jobs {
+				g.Jobs = append(g.Jobs, jobWith(string(rune('a'+i)), status))
+			}
+			g.Pods["a"] = tt.pods
+			got, err := GetGroupStatus(g)
+			if got != tt.want {
+				t.Errorf("GetGroupStatus() = %q, want %q", got, tt.want)
+			}
+			if (err != nil) != tt.failed {
+				t.Errorf("GetGroupStatus() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestGetWorkflowSnapshotMakesAStepOfEveryContainer(t *testing.T) {
+	started := metav1.NewTime(time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC))
+	finished := metav1.NewTime(started.Add(time.Minute))
+	g := &Group{
+		Name:      "wf",
+		Namespace: "ns",
+		Jobs: []*batchv1.Job{
+			jobWith("single", batchv1.JobStatus{StartTime: &started, CompletionTime: &finished, Conditions: condition(batchv1.JobComplete, "").Conditions}, "main"),
+			jobWith("multi", batchv1.JobStatus{StartTime: &started}, "ok", "oom", "running", "waiting"),
+		},
+		Pods: map[string][]*corev1.Pod{
+			"multi": {podIn(corev1.PodRunning,
+				corev1.ContainerStatus{Name: "ok", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{StartedAt: started, FinishedAt: finished}}},
+				corev1.ContainerStatus{Name: "oom", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{ExitCode: 137, Reason: "OOMKilled"}}},
+				corev1.ContainerStatus{Name: "running", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: started}}},
+				corev1.ContainerStatus{Name: "waiting", State: corev1.ContainerState{Waiting: &corev1.ContainerStateWaiting{Reason: "ContainerCreating"}}},
+			)},
+		},
+	}
+
+	workflow, err := GetWorkflowSnapshot(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Status != reporter.WorkflowRunning {
+		t.Errorf("workflow is %q", workflow.Status)
+	}
+	want := map[string]reporter.WorkflowStepStatus{
+		"single":        reporter.WorkflowStepSucceded,
+		"multi/ok":      reporter.WorkflowStepSucceded,
+		"multi/oom":     reporter.WorkflowStepFailed,
+		"multi/running": reporter.WorkflowStepRunning,
+		"multi/waiting": reporter.WorkflowStepPending,
+	}
+	if len(workflow.Steps) != len(want) {
+		t.Errorf("got %d steps, want %d", len(workflow.Steps), len(want))
+	}
+	for key, status := range want {
+		step := workflow.Steps[key]
+		if step == nil || step.Status != status {
+			t.Errorf("step %s is %+v, want %q", key, step, status)
+		}
+	}
+	if single := workflow.Steps["single"]; !single.StartedAt.Equal(started.Time) || !single.FinishedAt.Equal(finished.Time) {
+		t.Errorf("single step ran from %v to %v", single.StartedAt, single.FinishedAt)
+	}
+	oom := workflow.Steps["multi/oom"]
+	if oom.ExitCode == nil || *oom.ExitCode != 137 || oom.Err == nil || oom.Err.Error() != "container oom exited with code 137: OOMKilled" {
+		t.Errorf("oom step is %+v", oom)
+	}
+}
+
+func TestGetWorkflowSnapshotFailsTheContainersOfAFailedJob(t *testing.T) {
+	g := &Group{
+		Name:      "wf",
+		Namespace: "ns",
+		Jobs:      []*batchv1.Job{jobWith("multi", condition(batchv1.JobFailed, "DeadlineExceeded"), "done", "stuck")},
+		Pods: map[string][]*corev1.Pod{
+			"multi": {podIn(corev1.PodFailed,
+				corev1.ContainerStatus{Name: "done", State: corev1.ContainerState{Terminated: &corev1.ContainerStateTerminated{}}},
+				corev1.ContainerStatus{Name: "stuck", State: corev1.ContainerState{Running: &corev1.ContainerStateRunning{}}},
+			)},
+		},
+	}
+
+	workflow, err := GetWorkflowSnapshot(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if workflow.Status != reporter.WorkflowTimeout {
+		t.Errorf("workflow is %q", workflow.Status)
+	}
+	if status := workflow.Steps["multi/done"].Status; status != reporter.WorkflowStepSucceded {
+		t.Errorf("finished container is %q", status)
+	}
+	if stuck := workflow.Steps["multi/stuck"]; stuck.Status != reporter.WorkflowStepTimeout || stuck.Err == nil {
+		t.Errorf("unfinished container is %+v", stuck)
+	}
+}
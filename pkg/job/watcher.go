@@ -0,0 +1,241 @@
+package job
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/informer"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	batchlisters "k8s.io/client-go/listers/batch/v1"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+const (
+	// GroupLabel is the default label that groups the jobs of a namespace into a single workflow run.
+	// A job without it is a run of its own, and so is every job created by a CronJob, which all get
+	// the labels of its job template
+	GroupLabel = "codefresh.io/workflow-id"
+
+	// jobNameLabel is set by the job controller on the pods it creates
+	jobNameLabel = "job-name"
+	// cronJobKind is the kind of the owner of the jobs created by a CronJob
+	cronJobKind = "CronJob"
+)
+
+type (
+	// Watcher streams the state of groups of jobs and their pods, using shared informers
+	// which re-list and re-watch as needed
+	Watcher struct {
+		Client        kubernetes.Interface
+		Namespace     string
+		LabelSelector string
+		// ResyncPeriod is how often every group is sent again, even if it did not change. 0 disables resyncs
+		ResyncPeriod time.Duration
+		// GroupLabel groups the jobs into runs, GroupLabel is used when empty
+		GroupLabel string
+		Logger     logger.Logger
+	}
+
+	// Group is the jobs that make up a single workflow run
+	Group struct {
+		// Name is the value of the group label, or the name of the job for a run of a single job
+		Name      string
+		Namespace string
+		// Jobs sorted by the time they were created
+		Jobs []*batchv1.Job
+		// Pods maps job names to their pods
+		Pods map[string][]*corev1.Pod
+	}
+
+	// Event is the latest known state of a group
+	Event struct {
+		Group   *Group
+		Deleted bool
+	}
+
+	groupKey struct {
+		namespace string
+		group     string
+		job       string
+	}
+)
+
+// Watch starts watching in the background. The returned channel is closed once ctx is done
+func (w *Watcher) Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	go w.run(ctx, events)
+	return events
+}
+
+// run turns job and pod changes into the keys of the groups they belong to,
+// and sends the state of each changed group as built from the informer caches
+func (w *Watcher) run(ctx context.Context, events chan<- Event) {
+	defer close(events)
+
+	jobFactory := informers.NewSharedInformerFactoryWithOptions(w.Client, w.ResyncPeriod,
+		informers.WithNamespace(w.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = w.LabelSelector
+		}),
+	)
+	podFactory := informers.NewSharedInformerFactoryWithOptions(w.Client, w.ResyncPeriod,
+		informers.WithNamespace(w.Namespace),
+		informers.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = jobNameLabel
+		}),
+	)
+	jobInformer := jobFactory.Batch().V1().Jobs()
+	podInformer := podFactory.Core().V1().Pods()
+	jobLister := jobInformer.Lister()
+	podLister := podInformer.Lister()
+
+	// keys is never closed, handlers stop sending once ctx is done
+	keys := make(chan groupKey)
+	enqueue := func(k groupKey) {
+		select {
+		case keys <- k:
+		case <-ctx.Done():
+		}
+	}
+	jobInformer.Informer().AddEventHandler(informer.Handler(func(obj interface{}, _ bool) {
+		job, ok := obj.(*batchv1.Job)
+		if !ok {
+			w.Logger.Err(fmt.Errorf("Invalid object type"), "unexpected object type from informer")
+			return
+		}
+		enqueue(keyOf(job, w.groupLabel()))
+	}))
+	podInformer.Informer().AddEventHandler(informer.Handler(func(obj interface{}, _ bool) {
+		pod, ok := obj.(*corev1.Pod)
+		if !ok {
+			w.Logger.Err(fmt.Errorf("Invalid object type"), "unexpected object type from informer")
+			return
+		}
+		// pods of jobs that are not watched are not in the lister
+		job, err := jobLister.Jobs(pod.Namespace).Get(pod.Labels[jobNameLabel])
+		if err != nil {
+			return
+		}
+		enqueue(keyOf(job, w.groupLabel()))
+	}))
+
+	jobFactory.Start(ctx.Done())
+	podFactory.Start(ctx.Done())
+	for informer, synced := range jobFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			w.Logger.Info("Jobs informer did not sync", "informer", informer.String())
+			return
+		}
+	}
+	for informer, synced := range podFactory.WaitForCacheSync(ctx.Done()) {
+		if !synced {
+			w.Logger.Info("Pods informer did not sync", "informer", informer.String())
+			return
+		}
+	}
+
+	// last holds the last sent state of every group, sent again once all of its jobs are deleted
+	last := map[groupKey]*Group{}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case k := <-keys:
+			g, err := w.group(k, jobLister, podLister)
+			if err != nil {
+				w.Logger.Err(err, "failed to get jobs", "namespace", k.namespace, "group", k.name())
+				continue
+			}
+			ev := Event{Group: g}
+			if len(g.Jobs) == 0 {
+				prev, ok := last[k]
+				if !ok {
+					continue
+				}
+				delete(last, k)
+				ev = Event{Group: prev, Deleted: true}
+			} else {
+				last[k] = g
+			}
+			select {
+			case events <- ev:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// group builds the current state of a group from the informer caches
+func (w *Watcher) group(k groupKey, jobLister batchlisters.JobLister, podLister corelisters.PodLister) (*Group, error) {
+	g := &Group{
+		Name:      k.name(),
+		Namespace: k.namespace,
+		Pods:      map[string][]*corev1.Pod{},
+	}
+	var jobs []*batchv1.Job
+	if k.job == "" {
+		var err error
+		jobs, err = jobLister.Jobs(k.namespace).List(labels.SelectorFromSet(labels.Set{w.groupLabel(): k.group}))
+		if err != nil {
+			return nil, err
+		}
+	} else if job, err := jobLister.Jobs(k.namespace).Get(k.job); err == nil {
+		jobs = []*batchv1.Job{job}
+	}
+	for _, job := range jobs {
+		g.Jobs = append(g.Jobs, job.DeepCopy())
+		pods, err := podLister.Pods(k.namespace).List(labels.SelectorFromSet(labels.Set{jobNameLabel: job.Name}))
+		if err != nil {
+			return nil, err
+		}
+		for _, pod := range pods {
+			g.Pods[job.Name] = append(g.Pods[job.Name], pod.DeepCopy())
+		}
+	}
+	sort.Slice(g.Jobs, func(i, j int) bool {
+		ci, cj := g.Jobs[i].CreationTimestamp, g.Jobs[j].CreationTimestamp
+		if !ci.Equal(&cj) {
+			return ci.Before(&cj)
+		}
+		return g.Jobs[i].Name < g.Jobs[j].Name
+	})
+	return g, nil
+}
+
+func (w *Watcher) groupLabel() string {
+	if w.GroupLabel != "" {
+		return w.GroupLabel
+	}
+	return GroupLabel
+}
+
+func keyOf(job *batchv1.Job, groupLabel string) groupKey {
+	group := job.Labels[groupLabel]
+	if group == "" || isScheduled(job) {
+		return groupKey{namespace: job.Namespace, group: group, job: job.Name}
+	}
+	return groupKey{namespace: job.Namespace, group: group}
+}
+
+// isScheduled tells if a job was created by a CronJob
+func isScheduled(job *batchv1.Job) bool {
+	owner := metav1.GetControllerOf(job)
+	return owner != nil && owner.Kind == cronJobKind
+}
+
+func (k groupKey) name() string {
+	if k.job != "" {
+		return k.job
+	}
+	return k.group
+}
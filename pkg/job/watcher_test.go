@@ -0,0 +1,55 @@
+package job
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	batchv1 "k8s.io/api/batch/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func scheduledJob(name string, labels map[string]string) *batchv1.Job {
+	job := completedJob(name, labels, time.Now())
+	controller := true
+	job.OwnerReferences = []metav1.OwnerReference{
+		{APIVersion: "batch/v1beta1", Kind: cronJobKind, Name: "nightly", UID: "uid-nightly", Controller: &controller},
+	}
+	return job
+}
+
+func TestKeyOfMakesARunOfEveryJobOfACronJob(t *testing.T) {
+	labels := map[string]string{GroupLabel: "nightly"}
+	a, b := scheduledJob("nightly-1", labels), scheduledJob("nightly-2", labels)
+	if ka, kb := keyOf(a, GroupLabel), keyOf(b, GroupLabel); ka == kb {
+		t.Errorf("expected the runs of a CronJob to be apart, got %+v", ka)
+	}
+	if k := keyOf(a, GroupLabel); k.name() != "nightly-1" {
+		t.Errorf("expected the run to be named after its job, got %q", k.name())
+	}
+}
+
+func TestWatcherSendsEveryJobOfACronJobApart(t *testing.T) {
+	labels := map[string]string{GroupLabel: "nightly"}
+	client := fake.NewSimpleClientset(scheduledJob("nightly-1", labels), scheduledJob("nightly-2", labels))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := &Watcher{Client: client, Namespace: "ns", Logger: logger.New(logger.Options{})}
+	events := w.Watch(ctx)
+
+	seen := map[string]int{}
+	for len(seen) < 2 {
+		select {
+		case ev := <-events:
+			seen[ev.Group.Name] = len(ev.Group.Jobs)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got groups %v", seen)
+		}
+	}
+	if seen["nightly-1"] != 1 || seen["nightly-2"] != 1 {
+		t.Errorf("expected a group of one job for each run, got %v", seen)
+	}
+}
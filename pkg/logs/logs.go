@@ -0,0 +1,82 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+type (
+	// Sink receives the logs of workflow steps
+	Sink interface {
+		// WriteLog sends the next chunk of a step's log
+		WriteLog(ctx context.Context, workflow string, chunk Chunk) error
+		// EndLog signals that a step's log is complete
+		EndLog(ctx context.Context, workflow string, step string) error
+	}
+
+	// Chunk is a part of a step's log, made of whole lines
+	Chunk struct {
+		Step      string
+		Container string
+		// Offset is the number of bytes of the step's log that came before this chunk
+		Offset int64
+		Data   []byte
+	}
+
+	// Target is where the log of a single step is
+	Target struct {
+		// Step is the name the step is reported with
+		Step string
+		// Key is the key of the step in the workflow snapshot
+		Key       string
+		Namespace string
+		Pod       string
+		// Containers are the containers that make up the step, followed one after the other
+		Containers []string
+	}
+
+	// WriterSink implements Sink by writing every line to Writer, prefixed with its workflow and step
+	WriterSink struct {
+		Writer io.Writer
+		mu     sync.Mutex
+	}
+)
+
+func (w *WriterSink) WriteLog(_ context.Context, workflow string, chunk Chunk) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prefix := []byte(fmt.Sprintf("[%s/%s] ", workflow, chunk.Step))
+	for _, line := range bytes.SplitAfter(chunk.Data, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		if _, err := w.Writer.Write(append(prefix, line...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WriterSink) EndLog(_ context.Context, workflow string, step string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, err := fmt.Fprintf(w.Writer, "[%s/%s] --- end of log ---\n", workflow, step)
+	return err
+}
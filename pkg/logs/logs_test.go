@@ -0,0 +1,62 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestWriterSinkPrefixesEveryLine(t *testing.T) {
+	var buf bytes.Buffer
+	s := &WriterSink{Writer: &buf}
+	ctx := context.Background()
+	if err := s.WriteLog(ctx, "wf", Chunk{Step: "build", Data: []byte("a\nb\n")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.EndLog(ctx, "wf", "build"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[wf/build] a\n[wf/build] b\n[wf/build] --- end of log ---\n"
+	if buf.String() != want {
+		t.Errorf("wrote %q, want %q", buf.String(), want)
+	}
+}
+
+func TestPositionSkipsTheLinesThatWereRead(t *testing.T) {
+	pos := &position{}
+	for _, line := range []string{"2020-01-01T10:00:00.1Z a\n", "2020-01-01T10:00:00.2Z b\n"} {
+		pos.next(line)
+	}
+	// a resumed stream starts again at the time of the last read line
+	pos.skip = pos.count
+
+	var got []string
+	for _, line := range []string{
+		"2020-01-01T10:00:00.1Z a\n",
+		"2020-01-01T10:00:00.2Z b\n",
+		"2020-01-01T10:00:00.2Z c\n",
+		"no timestamp\n",
+	} {
+		if msg, ok := pos.next(line); ok {
+			got = append(got, msg)
+		}
+	}
+	if len(got) != 2 || got[0] != "c\n" || got[1] != "no timestamp\n" {
+		t.Errorf("read %q", got)
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	minFollowBackoff = time.Second
+	maxFollowBackoff = 30 * time.Second
+)
+
+type (
+	// Streamer follows the logs of steps and forwards them to a Sink, each step once
+	Streamer struct {
+		ctx     context.Context
+		client  kubernetes.Interface
+		sink    Sink
+		logger  logger.Logger
+		options Options
+		mu      sync.Mutex
+		started map[string]map[string]bool
+		wg      sync.WaitGroup
+	}
+
+	// Options to build new Streamer
+	Options struct {
+		// ChunkSize is the number of bytes buffered before a chunk is sent
+		ChunkSize int
+		// FlushInterval is how often buffered lines are sent, even if the chunk is not full
+		FlushInterval time.Duration
+	}
+
+	// position is the timestamp of the last line that was read, and how many lines had it,
+	// used to skip the lines that were already read when a stream is resumed
+	position struct {
+		time  time.Time
+		count int
+		skip  int
+	}
+)
+
+// NewStreamer builds a Streamer. Logs are followed and sent with ctx
+func NewStreamer(ctx context.Context, client kubernetes.Interface, sink Sink, lgr logger.Logger, options Options) *Streamer {
+	if options.ChunkSize < 1 {
+		options.ChunkSize = 16 * 1024
+	}
+	if options.FlushInterval <= 0 {
+		options.FlushInterval = time.Second
+	}
+	return &Streamer{
+		ctx:     ctx,
+		client:  client,
+		sink:    sink,
+		logger:  lgr,
+		options: options,
+		started: map[string]map[string]bool{},
+	}
+}
+
+// Stream starts following the targets of a workflow that are not followed yet
+func (s *Streamer) Stream(workflow string, targets []Target) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started[workflow] == nil {
+		s.started[workflow] = map[string]bool{}
+	}
+	for _, t := range targets {
+		if s.started[workflow][t.Step] {
+			continue
+		}
+		s.started[workflow][t.Step] = true
+		s.wg.Add(1)
+		go s.follow(workflow, t)
+	}
+}
+
+// Forget drops what is known about a workflow, whose steps are not followed again only
+// while it is remembered
+func (s *Streamer) Forget(workflow string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.started, workflow)
+}
+
+// Wait waits until every followed step's log ended, or the streamer's context is done
+func (s *Streamer) Wait() {
+	s.wg.Wait()
+}
+
+func (s *Streamer) follow(workflow string, t Target) {
+	defer s.wg.Done()
+	lgr := s.logger.Fork("workflow", workflow, "step", t.Step)
+	var offset int64
+	for _, container := range t.Containers {
+		if !s.followContainer(workflow, t, container, &offset, lgr) {
+			return
+		}
+	}
+	if err := s.sink.EndLog(s.ctx, workflow, t.Step); err != nil {
+		lgr.Err(err, "failed to end step log")
+	}
+}
+
+// followContainer follows the log of a container until it terminates, resuming
+// from the last read line whenever the stream ends early. It tells if the log is complete
+func (s *Streamer) followContainer(workflow string, t Target, container string, offset *int64, lgr logger.Logger) bool {
+	pos := &position{}
+	backoff := minFollowBackoff
+	for s.ctx.Err() == nil {
+		opts := &corev1.PodLogOptions{
+			Container:  container,
+			Follow:     true,
+			Timestamps: true,
+		}
+		if !pos.time.IsZero() {
+			since := metav1.NewTime(pos.time)
+			opts.SinceTime = &since
+			pos.skip = pos.count
+		}
+		stream, err := s.client.CoreV1().Pods(t.Namespace).GetLogs(t.Pod, opts).Stream(s.ctx)
+		if apierrors.IsNotFound(err) {
+			lgr.Info("Pod is gone, log is incomplete", "pod", t.Pod, "container", container)
+			return true
+		}
+		if err == nil {
+			backoff = minFollowBackoff
+			err = s.read(workflow, t, container, stream, pos, offset, lgr)
+			stream.Close()
+		}
+		if s.ctx.Err() != nil {
+			return false
+		}
+		if s.hasTerminated(t, container) {
+			return true
+		}
+		if err != nil {
+			// most likely a container that did not start yet
+			lgr.Info("Failed to follow log, retrying", "container", container, "error", err.Error(), "retry-in", backoff.String())
+		}
+		select {
+		case <-time.After(backoff):
+		case <-s.ctx.Done():
+		}
+		if backoff *= 2; backoff > maxFollowBackoff {
+			backoff = maxFollowBackoff
+		}
+	}
+	return false
+}
+
+// read sends the lines of stream in chunks until it ends
+func (s *Streamer) read(workflow string, t Target, container string, stream io.Reader, pos *position, offset *int64, lgr logger.Logger) error {
+	lines := make(chan string)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(lines)
+		r := bufio.NewReader(stream)
+		for {
+			line, err := r.ReadString('\n')
+			if line != "" {
+				select {
+				case lines <- line:
+				case <-s.ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				if err != io.EOF {
+					errc <- err
+				}
+				return
+			}
+		}
+	}()
+
+	var buf bytes.Buffer
+	flush := func() {
+		if buf.Len() == 0 {
+			return
+		}
+		chunk := Chunk{
+			Step:      t.Step,
+			Container: container,
+			Offset:    *offset,
+			Data:      append([]byte(nil), buf.Bytes()...),
+		}
+		*offset += int64(buf.Len())
+		buf.Reset()
+		// logs are best effort, a chunk that could not be sent is dropped
+		if err := s.sink.WriteLog(s.ctx, workflow, chunk); err != nil {
+			lgr.Err(err, "failed to send log chunk", "offset", chunk.Offset)
+		}
+	}
+	ticker := time.NewTicker(s.options.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				flush()
+				select {
+				case err := <-errc:
+					return err
+				default:
+					return nil
+				}
+			}
+			if msg, ok := pos.next(line); ok {
+				buf.WriteString(msg)
+			}
+			if buf.Len() >= s.options.ChunkSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.ctx.Done():
+			flush()
+			return s.ctx.Err()
+		}
+	}
+}
+
+// hasTerminated tells if a container will not write to its log anymore
+func (s *Streamer) hasTerminated(t Target, container string) bool {
+	pod, err := s.client.CoreV1().Pods(t.Namespace).Get(s.ctx, t.Pod, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		return true
+	}
+	if err != nil {
+		return false
+	}
+	if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+		return true
+	}
+	for _, cs := range pod.Status.ContainerStatuses {
+		if cs.Name == container {
+			return cs.State.Terminated != nil
+		}
+	}
+	return false
+}
+
+// next strips the timestamp off a line, and tells if it was not read before
+func (p *position) next(line string) (string, bool) {
+	parts := strings.SplitN(line, " ", 2)
+	ts, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil || len(parts) != 2 {
+		return line, true
+	}
+	switch {
+	case ts.Before(p.time):
+		return "", false
+	case ts.Equal(p.time):
+		if p.skip > 0 {
+			p.skip--
+			return "", false
+		}
+		p.count++
+	default:
+		p.time = ts
+		p.count = 1
+		p.skip = 0
+	}
+	return parts[1], true
+}
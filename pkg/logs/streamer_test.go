@@ -0,0 +1,201 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// podServer stands in for the API server of a single pod, answering the n-th log request of a
+// container with its n-th stream, and telling the container terminated once every stream was read
+type podServer struct {
+	mu       sync.Mutex
+	streams  map[string][]string
+	requests map[string][]string
+}
+
+func (s *podServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch req.URL.Path {
+	case "/api/v1/namespaces/ns/pods/pod/log":
+		container := req.URL.Query().Get("container")
+		n := len(s.requests[container])
+		s.requests[container] = append(s.requests[container], req.URL.Query().Get("sinceTime"))
+		if n >= len(s.streams[container]) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		_, _ = w.Write([]byte(s.streams[container][n]))
+	case "/api/v1/namespaces/ns/pods/pod":
+		pod := corev1.Pod{
+			TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+		}
+		for container, streams := range s.streams {
+			cs := corev1.ContainerStatus{Name: container}
+			if len(s.requests[container]) >= len(streams) {
+				cs.State.Terminated = &corev1.ContainerStateTerminated{}
+			}
+			pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, cs)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(&pod)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (s *podServer) sinceTimes(container string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests[container]...)
+}
+
+// sinkRecorder records the chunks it receives, and closes ended once a step's log is complete
+type sinkRecorder struct {
+	mu     sync.Mutex
+	chunks []Chunk
+	ended  chan string
+}
+
+func (r *sinkRecorder) WriteLog(_ context.Context, _ string, chunk Chunk) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chunks = append(r.chunks, chunk)
+	return nil
+}
+
+func (r *sinkRecorder) EndLog(_ context.Context, _ string, step string) error {
+	r.ended <- step
+	return nil
+}
+
+func (r *sinkRecorder) received() []Chunk {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Chunk(nil), r.chunks...)
+}
+
+func streamPod(t *testing.T, streams map[string][]string, options Options, containers ...string) (*podServer, *sinkRecorder) {
+	srv := &podServer{streams: streams, requests: map[string][]string{}}
+	ts := httptest.NewServer(srv)
+	t.Cleanup(ts.Close)
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: ts.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	rec := &sinkRecorder{ended: make(chan string, 1)}
+	s := NewStreamer(ctx, client, rec, logger.New(logger.Options{}), options)
+	s.Stream("wf", []Target{{Step: "build", Key: "build", Namespace: "ns", Pod: "pod", Containers: containers}})
+	select {
+	case step := <-rec.ended:
+		if step != "build" {
+			t.Fatalf("ended step %q", step)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the log of the step did not end")
+	}
+	s.Wait()
+	return srv, rec
+}
+
+func TestStreamerResumesWithoutRepeatingOrLosingLines(t *testing.T) {
+	// the stream ends early, and the next one starts from the second of the last read line
+	_, rec := streamPod(t, map[string][]string{"step": {
+		"2020-01-01T10:00:00.1Z a\n2020-01-01T10:00:00.2Z b\n2020-01-01T10:00:00.2Z c\n",
+		"2020-01-01T10:00:00.1Z a\n2020-01-01T10:00:00.2Z b\n2020-01-01T10:00:00.2Z c\n" +
+			"2020-01-01T10:00:00.2Z d\n2020-01-01T10:00:01Z e\n",
+	}}, Options{}, "step")
+
+	var data strings.Builder
+	var offset int64
+	for _, chunk := range rec.received() {
+		if chunk.Offset != offset {
+			t.Errorf("chunk at offset %d, want %d", chunk.Offset, offset)
+		}
+		offset += int64(len(chunk.Data))
+		data.Write(chunk.Data)
+	}
+	if data.String() != "a\nb\nc\nd\ne\n" {
+		t.Errorf("log is %q", data.String())
+	}
+}
+
+func TestStreamerResumesFromTheLastReadLine(t *testing.T) {
+	srv, _ := streamPod(t, map[string][]string{"step": {
+		"2020-01-01T10:00:05.5Z a\n",
+		"2020-01-01T10:00:05.5Z a\n",
+	}}, Options{}, "step")
+
+	want := []string{"", "2020-01-01T10:00:05Z"}
+	if got := srv.sinceTimes("step"); !reflect.DeepEqual(got, want) {
+		t.Errorf("streams since %q, want %q", got, want)
+	}
+}
+
+func TestStreamerChunksAtTheSizeLimit(t *testing.T) {
+	_, rec := streamPod(t, map[string][]string{
+		"init": {"2020-01-01T10:00:00Z ab\n2020-01-01T10:00:01Z cd\n2020-01-01T10:00:02Z ef\n"},
+		"step": {"2020-01-01T10:00:03Z gh\n"},
+	}, Options{ChunkSize: 4, FlushInterval: time.Hour}, "init", "step")
+
+	want := []Chunk{
+		{Step: "build", Container: "init", Offset: 0, Data: []byte("ab\ncd\n")},
+		{Step: "build", Container: "init", Offset: 6, Data: []byte("ef\n")},
+		{Step: "build", Container: "step", Offset: 9, Data: []byte("gh\n")},
+	}
+	if got := rec.received(); !reflect.DeepEqual(got, want) {
+		t.Errorf("chunks are %+v, want %+v", got, want)
+	}
+}
+
+func TestStreamerEndsTheLogOfAGonePod(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := &sinkRecorder{ended: make(chan string, 1)}
+	s := NewStreamer(context.Background(), client, rec, logger.New(logger.Options{}), Options{})
+	s.Stream("wf", []Target{{Step: "build", Namespace: "ns", Pod: "pod", Containers: []string{"step"}}})
+	s.Wait()
+
+	if step := <-rec.ended; step != "build" {
+		t.Errorf("ended step %q", step)
+	}
+	if chunks := rec.received(); len(chunks) != 0 {
+		t.Errorf("sent chunks %+v", chunks)
+	}
+}
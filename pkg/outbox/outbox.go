@@ -0,0 +1,427 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+const (
+	kindWorkflow  = "workflow"
+	kindStep      = "step"
+	kindVariables = "variables"
+
+	// compactAfter is the number of acknowledgments after which the file is rewritten
+	// with only the events that are still pending
+	compactAfter = 1000
+)
+
+type (
+	// Outbox implements reporter.CodefreshAPI on top of another CodefreshAPI,
+	// recording every event in an append-only file before it is sent and
+	// acknowledging it after it was delivered. Events that were not acknowledged
+	// are replayed in order. The events of a workflow are delivered in order,
+	// independently of the events of other workflows
+	Outbox struct {
+		api     reporter.CodefreshAPI
+		logger  logger.Logger
+		queue   Queue
+		path    string
+		mu      sync.Mutex
+		file    *os.File
+		seq     uint64
+		pending []*record
+		// acks is the number of acknowledgments written since the file was compacted
+		acks int
+		// delivering serializes the deliveries of each workflow
+		delivering keyedMutex
+	}
+
+	// record is a single line in the outbox file, either an event or an acknowledgment of one
+	record struct {
+		Seq      uint64 `json:"seq"`
+		Ack      bool   `json:"ack,omitempty"`
+		Kind     string `json:"kind,omitempty"`
+		Workflow string `json:"workflow,omitempty"`
+		Step     string `json:"step,omitempty"`
+		Status   string `json:"status,omitempty"`
+		Err      string `json:"error,omitempty"`
+		// steps only
+		ExitCode   *int32     `json:"exitCode,omitempty"`
+		StartedAt  *time.Time `json:"startedAt,omitempty"`
+		FinishedAt *time.Time `json:"finishedAt,omitempty"`
+		Group      string     `json:"group,omitempty"`
+		// step results, or the variables of the workflow
+		Variables   []reporter.Variable   `json:"variables,omitempty"`
+		Diagnostics *reporter.Diagnostics `json:"diagnostics,omitempty"`
+	}
+
+	// Queue delivers in the background, such as a dispatcher.Queue
+	Queue interface {
+		Dispatch(ctx context.Context, workflow string, desc []interface{}, send func(ctx context.Context) error) error
+	}
+
+	// Options to open an Outbox
+	Options struct {
+		// Queue delivers the events in the background once they were recorded, and retries
+		// them until they are delivered. Events are delivered before reporting returns when it is nil
+		Queue Queue
+	}
+
+	// keyedMutex is a mutex per key, which only exists while it is locked or waited for
+	keyedMutex struct {
+		mu    sync.Mutex
+		locks map[string]*refMutex
+	}
+
+	refMutex struct {
+		sync.Mutex
+		refs int
+	}
+)
+
+// Open loads the outbox file at path, creating it if needed
+func Open(path string, api reporter.CodefreshAPI, lgr logger.Logger, options Options) (*Outbox, error) {
+	o := &Outbox{
+		api:    api,
+		logger: lgr,
+		queue:  options.Queue,
+		path:   path,
+	}
+	if err := o.load(); err != nil {
+		return nil, err
+	}
+	// start from a file holding only the pending events
+	if err := o.compact(); err != nil {
+		return nil, err
+	}
+	lgr.Info("Loaded outbox", "path", path, "pending", len(o.pending))
+	return o, nil
+}
+
+// Replay sends the events that were recorded but never acknowledged, in order
+func (o *Outbox) Replay(ctx context.Context) error {
+	for _, workflow := range o.pendingWorkflows() {
+		if err := o.deliver(ctx, workflow); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReplayWorkflow sends the events of a workflow that were recorded but never acknowledged, in order
+func (o *Outbox) ReplayWorkflow(ctx context.Context, workflow string) error {
+	if o.nextPending(workflow) == nil {
+		return nil
+	}
+	return o.deliver(ctx, workflow)
+}
+
+// Close closes the outbox file
+func (o *Outbox) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.file.Close()
+}
+
+func (o *Outbox) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return o.report(ctx, &record{
+		Kind:     kindWorkflow,
+		Workflow: workflow,
+		Status:   string(status),
+		Err:      reporter.ErrString(err),
+	})
+}
+
+func (o *Outbox) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	return o.report(ctx, &record{
+		Kind:        kindStep,
+		Workflow:    workflow,
+		Step:        step.Name,
+		Status:      string(step.Status),
+		Err:         reporter.ErrString(step.Err),
+		ExitCode:    step.ExitCode,
+		StartedAt:   reporter.TimePtr(step.StartedAt),
+		FinishedAt:  reporter.TimePtr(step.FinishedAt),
+		Group:       step.Group,
+		Variables:   step.Results,
+		Diagnostics: step.Diagnostics,
+	})
+}
+
+func (o *Outbox) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	return o.report(ctx, &record{
+		Kind:      kindVariables,
+		Workflow:  workflow,
+		Variables: variables,
+	})
+}
+
+func (o *Outbox) report(ctx context.Context, r *record) error {
+	o.mu.Lock()
+	o.seq++
+	r.Seq = o.seq
+	if err := o.append(r); err != nil {
+		o.mu.Unlock()
+		return err
+	}
+	o.pending = append(o.pending, r)
+	o.mu.Unlock()
+	return o.deliver(ctx, r.Workflow)
+}
+
+// deliver sends the pending events of a workflow, in the background when there is a queue
+func (o *Outbox) deliver(ctx context.Context, workflow string) error {
+	if o.queue == nil {
+		return o.flush(ctx, workflow)
+	}
+	err := o.queue.Dispatch(ctx, workflow, []interface{}{"workflow", workflow}, func(ctx context.Context) error {
+		return o.flush(ctx, workflow)
+	})
+	if err != nil {
+		// the events were recorded, they are delivered along with the next ones or replayed on restart
+		o.logger.Err(err, "failed to queue outbox delivery", "workflow", workflow)
+	}
+	return nil
+}
+
+// flush delivers the pending events of a workflow in order, stopping at the first failure
+// so that later events are never delivered before earlier ones. Events that failed permanently
+// are dropped. Other workflows are not held back while the events are sent
+func (o *Outbox) flush(ctx context.Context, workflow string) error {
+	o.delivering.lock(workflow)
+	defer o.delivering.unlock(workflow)
+	for {
+		r := o.nextPending(workflow)
+		if r == nil {
+			return nil
+		}
+		if err := o.send(ctx, r); err != nil {
+			if !reporter.IsPermanent(err) {
+				return err
+			}
+			o.logger.Err(err, "Dropping outbox event that can not be delivered", "seq", r.Seq, "kind", r.Kind, "workflow", r.Workflow, "step", r.Step, "status", r.Status)
+		}
+		if err := o.ack(r); err != nil {
+			return err
+		}
+	}
+}
+
+// nextPending returns the oldest pending event of a workflow
+func (o *Outbox) nextPending(workflow string) *record {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, r := range o.pending {
+		if r.Workflow == workflow {
+			return r
+		}
+	}
+	return nil
+}
+
+// pendingWorkflows returns the workflows with pending events, oldest first
+func (o *Outbox) pendingWorkflows() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	var workflows []string
+	seen := map[string]bool{}
+	for _, r := range o.pending {
+		if !seen[r.Workflow] {
+			seen[r.Workflow] = true
+			workflows = append(workflows, r.Workflow)
+		}
+	}
+	return workflows
+}
+
+// ack records that an event was delivered, and compacts the file once enough events were
+func (o *Outbox) ack(r *record) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := o.append(&record{Seq: r.Seq, Ack: true}); err != nil {
+		return err
+	}
+	for i, p := range o.pending {
+		if p == r {
+			o.pending = append(o.pending[:i], o.pending[i+1:]...)
+			break
+		}
+	}
+	o.acks++
+	if o.acks < compactAfter {
+		return nil
+	}
+	return o.compact()
+}
+
+func (o *Outbox) send(ctx context.Context, r *record) error {
+	var err error
+	if r.Err != "" {
+		err = errors.New(r.Err)
+	}
+	if r.Kind == kindVariables {
+		return o.api.ReportWorkflowVariables(ctx, r.Workflow, r.Variables)
+	}
+	if r.Kind == kindStep {
+		step := reporter.WorkflowStep{
+			Name:        r.Step,
+			Status:      reporter.WorkflowStepStatus(r.Status),
+			Err:         err,
+			ExitCode:    r.ExitCode,
+			Group:       r.Group,
+			Results:     r.Variables,
+			Diagnostics: r.Diagnostics,
+		}
+		if r.StartedAt != nil {
+			step.StartedAt = *r.StartedAt
+		}
+		if r.FinishedAt != nil {
+			step.FinishedAt = *r.FinishedAt
+		}
+		return o.api.ReportWorkflowStepStaus(ctx, r.Workflow, step)
+	}
+	return o.api.ReportWorkflowStaus(ctx, r.Workflow, reporter.WorkflowStatus(r.Status), err)
+}
+
+func (o *Outbox) append(r *record) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if _, err = o.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to outbox: %w", err)
+	}
+	return o.file.Sync()
+}
+
+// compact replaces the file with one holding only the pending events. The new file is
+// written aside and renamed over the old one, so a crash leaves either of them whole
+func (o *Outbox) compact() error {
+	tmp := o.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	for _, r := range o.pending {
+		data, err := json.Marshal(r)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		_, _ = w.Write(append(data, '\n'))
+	}
+	err = w.Flush()
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, o.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to compact outbox: %w", err)
+	}
+	if o.file != nil {
+		o.file.Close()
+	}
+	o.file, err = os.OpenFile(o.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open outbox: %w", err)
+	}
+	o.acks = 0
+	return nil
+}
+
+func (o *Outbox) load() error {
+	f, err := os.Open(o.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read outbox: %w", err)
+	}
+	defer f.Close()
+
+	acked := map[uint64]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		r := &record{}
+		if err := json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// most likely a write that was cut short when the process was killed
+			o.logger.Err(err, "Skipping invalid outbox record", "line", line)
+			continue
+		}
+		if r.Seq > o.seq {
+			o.seq = r.Seq
+		}
+		if r.Ack {
+			acked[r.Seq] = true
+			continue
+		}
+		o.pending = append(o.pending, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	pending := o.pending[:0]
+	for _, r := range o.pending {
+		if !acked[r.Seq] {
+			pending = append(pending, r)
+		}
+	}
+	o.pending = pending
+	return nil
+}
+
+func (k *keyedMutex) lock(key string) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = map[string]*refMutex{}
+	}
+	m, ok := k.locks[key]
+	if !ok {
+		m = &refMutex{}
+		k.locks[key] = m
+	}
+	m.refs++
+	k.mu.Unlock()
+	m.Lock()
+}
+
+func (k *keyedMutex) unlock(key string) {
+	k.mu.Lock()
+	m := k.locks[key]
+	m.refs--
+	if m.refs == 0 {
+		delete(k.locks, key)
+	}
+	k.mu.Unlock()
+	m.Unlock()
+}
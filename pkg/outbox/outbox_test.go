@@ -0,0 +1,291 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// fakeAPI records the reports it gets, failing while err is set
+type fakeAPI struct {
+	mu      sync.Mutex
+	err     error
+	reports []string
+	// block holds back the reports of a workflow until it is closed
+	block map[string]chan struct{}
+}
+
+func (f *fakeAPI) report(workflow, desc string) error {
+	f.mu.Lock()
+	block := f.block[workflow]
+	f.mu.Unlock()
+	if block != nil {
+		<-block
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return f.err
+	}
+	f.reports = append(f.reports, workflow+":"+desc)
+	return nil
+}
+
+func (f *fakeAPI) ReportWorkflowStaus(_ context.Context, workflow string, status reporter.WorkflowStatus, _ error) error {
+	return f.report(workflow, string(status))
+}
+
+func (f *fakeAPI) ReportWorkflowStepStaus(_ context.Context, workflow string, step reporter.WorkflowStep) error {
+	return f.report(workflow, step.Name+"="+string(step.Status))
+}
+
+func (f *fakeAPI) ReportWorkflowVariables(_ context.Context, workflow string, variables []reporter.Variable) error {
+	return f.report(workflow, fmt.Sprintf("variables=%d", len(variables)))
+}
+
+func (f *fakeAPI) delivered() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.reports...)
+}
+
+func openTestOutbox(t *testing.T, path string, api reporter.CodefreshAPI) *Outbox {
+	o, err := Open(path, api, logger.New(logger.Options{}), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { o.Close() })
+	return o
+}
+
+func countLines(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for scanner := bufio.NewScanner(f); scanner.Scan(); n++ {
+	}
+	return n
+}
+
+func TestRepeatedTransitionsAreDelivered(t *testing.T) {
+	api := &fakeAPI{}
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox"), api)
+	ctx := context.Background()
+
+	for _, status := range []reporter.WorkflowStepStatus{reporter.WorkflowStepRunning, reporter.WorkflowStepPendingApproval, reporter.WorkflowStepRunning} {
+		if err := o.ReportWorkflowStepStaus(ctx, "wf", reporter.WorkflowStep{Name: "approve", Status: status}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{"wf:approve=running", "wf:approve=pending-approval", "wf:approve=running"}
+	if got := api.delivered(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+}
+
+func TestPendingEventsAreReplayedInOrder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	failing := &fakeAPI{err: errors.New("unavailable")}
+	o := openTestOutbox(t, path, failing)
+	ctx := context.Background()
+
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err == nil {
+		t.Fatal("expected the delivery to fail")
+	}
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err == nil {
+		t.Fatal("expected the delivery to fail")
+	}
+	o.Close()
+
+	api := &fakeAPI{}
+	o = openTestOutbox(t, path, api)
+	if err := o.Replay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"wf:running", "wf:success"}
+	if got := api.delivered(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("delivered %v, want %v", got, want)
+	}
+	o.Close()
+
+	// the same workflow ID may be run again, its events are not mistaken for the old ones
+	api = &fakeAPI{}
+	o = openTestOutbox(t, path, api)
+	if err := o.Replay(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.delivered(); !reflect.DeepEqual(got, []string{"wf:running"}) {
+		t.Fatalf("delivered %v", got)
+	}
+}
+
+func TestReplayWorkflowReplaysOnlyThatWorkflow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	o := openTestOutbox(t, path, &fakeAPI{err: errors.New("unavailable")})
+	ctx := context.Background()
+	for _, workflow := range []string{"wf-1", "wf-2"} {
+		if err := o.ReportWorkflowStaus(ctx, workflow, reporter.WorkflowRunning, nil); err == nil {
+			t.Fatal("expected the delivery to fail")
+		}
+	}
+	o.Close()
+
+	api := &fakeAPI{}
+	o = openTestOutbox(t, path, api)
+	if err := o.ReplayWorkflow(ctx, "wf-2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.ReplayWorkflow(ctx, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.delivered(); !reflect.DeepEqual(got, []string{"wf-2:running"}) {
+		t.Fatalf("delivered %v", got)
+	}
+	if len(o.pending) != 1 || o.pending[0].Workflow != "wf-1" {
+		t.Fatalf("expected the other workflow to stay pending, got %+v", o.pending)
+	}
+}
+
+func TestOpenCompactsDeliveredEvents(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	api := &fakeAPI{}
+	o := openTestOutbox(t, path, api)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if err := o.ReportWorkflowStaus(ctx, fmt.Sprintf("wf-%d", i), reporter.WorkflowRunning, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api.err = errors.New("unavailable")
+	_ = o.ReportWorkflowStaus(ctx, "wf-0", reporter.WorkflowSucceded, nil)
+	if n := countLines(t, path); n != 21 {
+		t.Fatalf("file has %d lines before compaction, want 21", n)
+	}
+	o.Close()
+
+	o = openTestOutbox(t, path, &fakeAPI{})
+	if n := countLines(t, path); n != 1 {
+		t.Fatalf("file has %d lines after compaction, want the single pending event", n)
+	}
+	if len(o.pending) != 1 || o.pending[0].Status != string(reporter.WorkflowSucceded) {
+		t.Fatalf("unexpected pending events %+v", o.pending)
+	}
+}
+
+func TestSlowWorkflowDoesNotHoldBackOthers(t *testing.T) {
+	block := make(chan struct{})
+	api := &fakeAPI{block: map[string]chan struct{}{"slow": block}}
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox"), api)
+	ctx := context.Background()
+
+	slowDone := make(chan error)
+	go func() {
+		slowDone <- o.ReportWorkflowStaus(ctx, "slow", reporter.WorkflowRunning, nil)
+	}()
+	fastDone := make(chan error)
+	go func() {
+		// give the slow delivery time to start
+		time.Sleep(50 * time.Millisecond)
+		fastDone <- o.ReportWorkflowStaus(ctx, "fast", reporter.WorkflowRunning, nil)
+	}()
+	select {
+	case err := <-fastDone:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("delivery of another workflow was held back")
+	}
+	close(block)
+	if err := <-slowDone; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// heldQueue holds the deliveries it gets until they are run
+type heldQueue struct {
+	sends []func(ctx context.Context) error
+}
+
+func (q *heldQueue) Dispatch(_ context.Context, _ string, _ []interface{}, send func(ctx context.Context) error) error {
+	q.sends = append(q.sends, send)
+	return nil
+}
+
+func TestEventsAreRecordedBeforeTheyAreQueued(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox")
+	api := &fakeAPI{}
+	queue := &heldQueue{}
+	o, err := Open(path, api, logger.New(logger.Options{}), Options{Queue: queue})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer o.Close()
+	ctx := context.Background()
+
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if n := countLines(t, path); n != 1 {
+		t.Fatalf("event was not recorded before it was queued, file has %d lines", n)
+	}
+	if len(api.delivered()) != 0 || len(queue.sends) != 1 {
+		t.Fatalf("event was delivered before the queue ran it")
+	}
+	if err := queue.sends[0](ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.delivered(); !reflect.DeepEqual(got, []string{"wf:running"}) {
+		t.Fatalf("delivered %v", got)
+	}
+	if n := countLines(t, path); n != 2 {
+		t.Fatalf("event was not acknowledged, file has %d lines", n)
+	}
+}
+
+func TestPermanentFailuresAreDropped(t *testing.T) {
+	api := &fakeAPI{err: reporter.Permanent(errors.New("bad request"))}
+	o := openTestOutbox(t, filepath.Join(t.TempDir(), "outbox"), api)
+	ctx := context.Background()
+
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	api.err = nil
+	if err := o.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.delivered(); !reflect.DeepEqual(got, []string{"wf:success"}) {
+		t.Fatalf("delivered %v", got)
+	}
+}
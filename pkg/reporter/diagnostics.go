@@ -0,0 +1,36 @@
+package reporter
+
+import "time"
+
+type (
+	// Diagnostics explain why a step failed, as seen by the cluster it ran on
+	Diagnostics struct {
+		Pod string `json:"pod,omitempty"`
+		// Reason and Message of the pod, such as Evicted
+		Reason     string                 `json:"reason,omitempty"`
+		Message    string                 `json:"message,omitempty"`
+		Containers []ContainerDiagnostics `json:"containers,omitempty"`
+		// Events are the warnings recorded for the pod, such as FailedScheduling
+		Events []DiagnosticsEvent `json:"events,omitempty"`
+	}
+
+	// ContainerDiagnostics describe a container of the step that did not succeed
+	ContainerDiagnostics struct {
+		Name     string `json:"name"`
+		ExitCode *int32 `json:"exitCode,omitempty"`
+		// Reason the container terminated (e.g. OOMKilled, Error) or is waiting (e.g. ImagePullBackOff)
+		Reason  string `json:"reason,omitempty"`
+		Message string `json:"message,omitempty"`
+		// LogTail is the end of the container's log
+		LogTail []string `json:"logTail,omitempty"`
+	}
+
+	// DiagnosticsEvent is a Kubernetes event recorded for the pod of a step
+	DiagnosticsEvent struct {
+		Type     string    `json:"type"`
+		Reason   string    `json:"reason"`
+		Message  string    `json:"message,omitempty"`
+		Count    int32     `json:"count,omitempty"`
+		LastSeen time.Time `json:"lastSeen,omitempty"`
+	}
+)
@@ -1,5 +1,7 @@
 package reporter
 
+import "time"
+
 type (
 	WorkflowStatus string
 
@@ -8,11 +10,28 @@ type (
 	WorkflowStep struct {
 		Name   string
 		Status WorkflowStepStatus
+		Err    error
+		// ExitCode of the step's container once it terminated, for engines that know it
+		ExitCode *int32
+		// StartedAt and FinishedAt are when the step started and finished running, zero while unknown
+		StartedAt  time.Time
+		FinishedAt time.Time
+		// Group the step belongs to, such as the finally tasks of a pipeline. Empty for regular steps
+		Group string
+		// Results the step produced, known once it finished
+		Results []Variable
+		// Diagnostics of a failed step, for engines that can collect them
+		Diagnostics *Diagnostics
 	}
 
 	Workflow struct {
 		Status WorkflowStatus
+		Err    error
 		Steps  map[string]*WorkflowStep // maps task names to steps objects
+		// Results the workflow produced, known once it finished. They are reported as the
+		// variables of the workflow before its final status
+		Results []Variable
+		order   []string
 	}
 )
 
@@ -22,6 +41,10 @@ const (
 	WorkflowRunning  WorkflowStatus = "running"
 	WorkflowSucceded WorkflowStatus = "success"
 	WorkflowFailed   WorkflowStatus = "error"
+	// WorkflowTerminated means the workflow was stopped before it finished
+	WorkflowTerminated WorkflowStatus = "terminated"
+	// WorkflowTimeout means the workflow was stopped because it ran longer than it was allowed to
+	WorkflowTimeout WorkflowStatus = "timeout"
 )
 
 // Workflow step statuses
@@ -31,8 +54,56 @@ const (
 	WorkflowStepSucceded WorkflowStepStatus = "success"
 	WorkflowStepFailed   WorkflowStepStatus = "error"
 	WorkflowStepSkipped  WorkflowStepStatus = "skipped"
+	// WorkflowStepTerminated means the step was stopped before it finished
+	WorkflowStepTerminated WorkflowStepStatus = "terminated"
+	// WorkflowStepTimeout means the step was stopped because it ran longer than it was allowed to
+	WorkflowStepTimeout WorkflowStepStatus = "timeout"
+	// WorkflowStepPendingApproval means the step waits for a user to approve it
+	WorkflowStepPendingApproval WorkflowStepStatus = "pending-approval"
+	// WorkflowStepDenied means the step was not approved
+	WorkflowStepDenied WorkflowStepStatus = "denied"
 )
 
+// IsFinal tells if the workflow can not change its status anymore
+func (s WorkflowStatus) IsFinal() bool {
+	switch s {
+	case WorkflowSucceded, WorkflowFailed, WorkflowTerminated, WorkflowTimeout:
+		return true
+	}
+	return false
+}
+
+// IsFailure tells if the workflow finished without succeeding
+func (s WorkflowStatus) IsFailure() bool {
+	return s.IsFinal() && s != WorkflowSucceded
+}
+
+// IsFinal tells if the step can not change its status anymore
+func (s WorkflowStepStatus) IsFinal() bool {
+	switch s {
+	case WorkflowStepSucceded, WorkflowStepFailed, WorkflowStepSkipped, WorkflowStepTerminated, WorkflowStepTimeout, WorkflowStepDenied:
+		return true
+	}
+	return false
+}
+
+// IsFailure tells if the step finished without succeeding or being skipped
+func (s WorkflowStepStatus) IsFailure() bool {
+	switch s {
+	case WorkflowStepFailed, WorkflowStepTerminated, WorkflowStepTimeout, WorkflowStepDenied:
+		return true
+	}
+	return false
+}
+
+// Duration is how long the step ran, 0 until it started and finished
+func (s WorkflowStep) Duration() time.Duration {
+	if s.StartedAt.IsZero() || s.FinishedAt.IsZero() {
+		return 0
+	}
+	return s.FinishedAt.Sub(s.StartedAt)
+}
+
 func NewWorkflow() *Workflow {
 	return &Workflow{
 		Status: WorkflowPending,
@@ -0,0 +1,38 @@
+package reporter
+
+import "errors"
+
+// PermanentError is a failure to report that would happen again, so the report is not worth retrying
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks a failure to report as not worth retrying
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// ErrString returns the message of err, empty when there is none
+func ErrString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// IsPermanent tells if a failure to report is not worth retrying
+func IsPermanent(err error) bool {
+	var perr *PermanentError
+	return errors.As(err, &perr)
+}
@@ -1,6 +1,11 @@
 package reporter
 
-import "github.com/codefresh-io/status-reporter/pkg/logger"
+import (
+	"context"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
 
 type (
 	// Reporter reports status of single step or pipeline
@@ -10,8 +15,9 @@ type (
 
 	// CodefreshAPI to report the status
 	CodefreshAPI interface {
-		ReportWorkflowStaus(workflow string, status WorkflowStatus, err error) error
-		ReportWorkflowStepStaus(workflow string, step string, status WorkflowStepStatus, err error) error
+		ReportWorkflowStaus(ctx context.Context, workflow string, status WorkflowStatus, err error) error
+		ReportWorkflowStepStaus(ctx context.Context, workflow string, step WorkflowStep) error
+		ReportWorkflowVariables(ctx context.Context, workflow string, variables []Variable) error
 	}
 
 	// WorkflowStatusReporter implements Reporter
@@ -19,6 +25,8 @@ type (
 		CodefreshAPI CodefreshAPI
 		Logger       logger.Logger
 		WorkflowID   string
+		// Variables applies to the results of the workflow and of its steps
+		Variables VariablesPolicy
 	}
 
 	// WorkflowStepStatusReporter implements Reporter
@@ -31,18 +39,49 @@ type (
 )
 
 // Report status
-func (w *WorkflowStatusReporter) Report(status WorkflowStatus, err error) error {
+func (w *WorkflowStatusReporter) Report(ctx context.Context, status WorkflowStatus, err error) error {
 	w.Logger.Info("Reporting workflow status", "workflow-id", w.WorkflowID, "status", status, "error", err)
-	return w.CodefreshAPI.ReportWorkflowStaus(w.WorkflowID, status, err)
+	return w.CodefreshAPI.ReportWorkflowStaus(ctx, w.WorkflowID, status, err)
+}
+
+func (w *WorkflowStatusReporter) ReportStep(ctx context.Context, step WorkflowStep) error {
+	w.Logger.Info("Reporting workflow step status", "workflow-id", w.WorkflowID, "step", step.Name, "status", step.Status, "error", step.Err)
+	step.Results = w.applyVariablesPolicy(step.Results, "step", step.Name)
+	return w.CodefreshAPI.ReportWorkflowStepStaus(ctx, w.WorkflowID, step)
+}
+
+// ReportVariables reports the results of the workflow, unless there are none left once the policy applied
+func (w *WorkflowStatusReporter) ReportVariables(ctx context.Context, vars []Variable) error {
+	vars = w.applyVariablesPolicy(vars)
+	if len(vars) == 0 {
+		return nil
+	}
+	w.Logger.Info("Reporting workflow variables", "workflow-id", w.WorkflowID, "count", len(vars))
+	return w.CodefreshAPI.ReportWorkflowVariables(ctx, w.WorkflowID, vars)
 }
 
-func (w *WorkflowStatusReporter) ReportStep(step string, status WorkflowStepStatus, err error) error {
-	w.Logger.Info("Reporting workflow step status", "workflow-id", w.WorkflowID, "step", step, "status", status, "error", err)
-	return w.CodefreshAPI.ReportWorkflowStepStaus(w.WorkflowID, step, status, err)
+func (w *WorkflowStatusReporter) applyVariablesPolicy(vars []Variable, keysAndValues ...interface{}) []Variable {
+	if len(vars) == 0 {
+		return vars
+	}
+	vars, dropped := w.Variables.Apply(vars)
+	if len(dropped) > 0 {
+		w.Logger.Info("Dropped variables over the size limit", append([]interface{}{"workflow-id", w.WorkflowID, "dropped", dropped}, keysAndValues...)...)
+	}
+	return vars
 }
 
 // Report status
-func (w *WorkflowStepStatusReporter) Report(status WorkflowStepStatus) error {
+func (w *WorkflowStepStatusReporter) Report(ctx context.Context, status WorkflowStepStatus) error {
 	w.Logger.Info("Reporting workflow status", "status", status, "workflow-id", w.WorkflowID, "step", w.Step)
-	return w.CodefreshAPI.ReportWorkflowStepStaus(w.WorkflowID, w.Step, status, nil)
+	return w.CodefreshAPI.ReportWorkflowStepStaus(ctx, w.WorkflowID, WorkflowStep{Name: w.Step, Status: status})
+}
+
+// TimePtr returns t in UTC, or nil when it is zero so reports leave it out
+func TimePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
 }
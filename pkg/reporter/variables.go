@@ -0,0 +1,91 @@
+package reporter
+
+import (
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// RedactedValue replaces the values of sensitive variables
+const RedactedValue = "*****"
+
+type (
+	// Variable is a named value produced by a workflow or by one of its steps, such as a task result
+	Variable struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	}
+
+	// VariablesPolicy controls which variables are reported and how much of them.
+	// The zero value reports every variable as is
+	VariablesPolicy struct {
+		// MaxValueSize truncates longer values, in bytes. 0 disables the limit
+		MaxValueSize int
+		// MaxTotalSize drops the variables that would make the total size of the names
+		// and values reported at once exceed it, in bytes. 0 disables the limit
+		MaxTotalSize int
+		// Redact lists the case-insensitive glob patterns (e.g. "*token*") of the names
+		// whose values are replaced with RedactedValue
+		Redact []string
+	}
+)
+
+// DefaultVariablesPolicy returns the policy used when none is configured
+func DefaultVariablesPolicy() VariablesPolicy {
+	return VariablesPolicy{
+		MaxValueSize: 4 * 1024,
+		MaxTotalSize: 64 * 1024,
+		Redact:       []string{"*password*", "*secret*", "*token*", "*credentials*"},
+	}
+}
+
+// Validate checks that the policy can be used
+func (p VariablesPolicy) Validate() error {
+	for _, pattern := range p.Redact {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Apply returns the variables as they should be reported, redacted and within the size limits,
+// along with the names of the variables that were dropped
+func (p VariablesPolicy) Apply(vars []Variable) ([]Variable, []string) {
+	var result []Variable
+	var dropped []string
+	total := 0
+	for _, v := range vars {
+		if p.isRedacted(v.Name) {
+			v.Value = RedactedValue
+		}
+		if p.MaxValueSize > 0 && len(v.Value) > p.MaxValueSize {
+			v.Value = truncate(v.Value, p.MaxValueSize)
+		}
+		if p.MaxTotalSize > 0 && total+len(v.Name)+len(v.Value) > p.MaxTotalSize {
+			dropped = append(dropped, v.Name)
+			continue
+		}
+		total += len(v.Name) + len(v.Value)
+		result = append(result, v)
+	}
+	return result, dropped
+}
+
+func (p VariablesPolicy) isRedacted(name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range p.Redact {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate cuts s to at most size bytes, without splitting a rune
+func truncate(s string, size int) string {
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size]
+}
@@ -0,0 +1,73 @@
+package reporter
+
+import (
+	"reflect"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestVariablesPolicyApply(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      VariablesPolicy
+		vars        []Variable
+		want        []Variable
+		wantDropped []string
+	}{
+		{
+			name: "zero value reports everything",
+			vars: []Variable{{Name: "token", Value: "abc"}},
+			want: []Variable{{Name: "token", Value: "abc"}},
+		},
+		{
+			name:   "redacts matching names",
+			policy: VariablesPolicy{Redact: []string{"*TOKEN*"}},
+			vars:   []Variable{{Name: "github-token", Value: "abc"}, {Name: "image", Value: "app:1"}},
+			want:   []Variable{{Name: "github-token", Value: RedactedValue}, {Name: "image", Value: "app:1"}},
+		},
+		{
+			name:   "truncates long values",
+			policy: VariablesPolicy{MaxValueSize: 3},
+			vars:   []Variable{{Name: "digest", Value: "abcdef"}},
+			want:   []Variable{{Name: "digest", Value: "abc"}},
+		},
+		{
+			name:   "truncates on a rune boundary",
+			policy: VariablesPolicy{MaxValueSize: 4},
+			vars:   []Variable{{Name: "greeting", Value: "héllo"}, {Name: "emoji", Value: "a😀b"}},
+			want:   []Variable{{Name: "greeting", Value: "hél"}, {Name: "emoji", Value: "a"}},
+		},
+		{
+			name:        "drops variables over the total size",
+			policy:      VariablesPolicy{MaxTotalSize: 10},
+			vars:        []Variable{{Name: "a", Value: "1234"}, {Name: "b", Value: "123456"}, {Name: "c", Value: "1"}},
+			want:        []Variable{{Name: "a", Value: "1234"}, {Name: "c", Value: "1"}},
+			wantDropped: []string{"b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, dropped := tt.policy.Apply(tt.vars)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+			if !reflect.DeepEqual(dropped, tt.wantDropped) {
+				t.Errorf("expected %v to be dropped, got %v", tt.wantDropped, dropped)
+			}
+			for _, v := range got {
+				if !utf8.ValidString(v.Value) {
+					t.Errorf("expected %s to be valid UTF-8, got %q", v.Name, v.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestVariablesPolicyValidate(t *testing.T) {
+	if err := (VariablesPolicy{Redact: []string{"[token"}}).Validate(); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+	if err := DefaultVariablesPolicy().Validate(); err != nil {
+		t.Errorf("expected the default policy to be valid, got %v", err)
+	}
+}
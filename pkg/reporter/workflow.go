@@ -0,0 +1,140 @@
+package reporter
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// AddStep adds a step to the workflow, steps are synced in the order they were added
+func (w *Workflow) AddStep(key string, step *WorkflowStep) {
+	if _, ok := w.Steps[key]; !ok {
+		w.order = append(w.order, key)
+	}
+	w.Steps[key] = step
+}
+
+// StepKeys returns the keys of the workflow steps, in the order they were added.
+// Steps that were set directly on the map come last, sorted by key
+func (w *Workflow) StepKeys() []string {
+	keys := make([]string, 0, len(w.Steps))
+	seen := map[string]bool{}
+	for _, k := range w.order {
+		if _, ok := w.Steps[k]; ok && !seen[k] {
+			keys = append(keys, k)
+			seen[k] = true
+		}
+	}
+	var rest []string
+	for k := range w.Steps {
+		if !seen[k] {
+			rest = append(rest, k)
+		}
+	}
+	sort.Strings(rest)
+	return append(keys, rest...)
+}
+
+// Sync reports every transition needed to bring the workflow from its current state
+// to the desired one, so a state observed late (e.g. a run that already finished)
+// still produces the complete sequence of reports. A transition is applied only
+// after the CodefreshAPI accepted its report, so a report that was not accepted is
+// made again on the next sync. Once accepted, delivering the report is up to the
+// CodefreshAPI, e.g. a dispatcher retries it until it is delivered
+func (w *Workflow) Sync(ctx context.Context, desired *Workflow, wsr *WorkflowStatusReporter) error {
+	if desired.Status == WorkflowPending || w.Status.IsFinal() {
+		return nil
+	}
+	if w.Status == WorkflowPending {
+		if err := wsr.Report(ctx, WorkflowRunning, nil); err != nil {
+			return err
+		}
+		w.Status = WorkflowRunning
+	}
+
+	for _, key := range desired.StepKeys() {
+		if err := w.syncStep(ctx, key, desired.Steps[key], wsr); err != nil {
+			return err
+		}
+	}
+
+	if desired.Status.IsFinal() {
+		if len(desired.Results) > 0 && w.Results == nil {
+			if err := wsr.ReportVariables(ctx, desired.Results); err != nil {
+				return err
+			}
+			w.Results = desired.Results
+		}
+		if err := wsr.Report(ctx, desired.Status, desired.Err); err != nil {
+			return err
+		}
+		w.Status = desired.Status
+		w.Err = desired.Err
+	}
+	return nil
+}
+
+func (w *Workflow) syncStep(ctx context.Context, key string, desired *WorkflowStep, wsr *WorkflowStatusReporter) error {
+	step, ok := w.Steps[key]
+	if !ok {
+		step = &WorkflowStep{Name: desired.Name, Status: WorkflowStepPending}
+		w.AddStep(key, step)
+	}
+	if step.Name == "" {
+		step.Name = desired.Name
+	}
+	if step.Status == desired.Status || step.Status.IsFinal() || desired.Status == WorkflowStepPending {
+		return nil
+	}
+	// engines that only see a single transition at a time (e.g. events) do not know
+	// when a step started once it finished
+	startedAt := desired.StartedAt
+	if startedAt.IsZero() {
+		startedAt = step.StartedAt
+	}
+	// a step has to be reported as running before it can be reported with any other status,
+	// but skipped, which a step gets without ever running
+	if step.Status == WorkflowStepPending && desired.Status != WorkflowStepRunning && desired.Status != WorkflowStepSkipped {
+		running := WorkflowStep{Name: step.Name, Status: WorkflowStepRunning, StartedAt: startedAt, Group: desired.Group}
+		if err := wsr.ReportStep(ctx, running); err != nil {
+			return err
+		}
+		step.Status = WorkflowStepRunning
+		step.StartedAt = startedAt
+	}
+	next := *desired
+	next.Name = step.Name
+	next.StartedAt = startedAt
+	if err := wsr.ReportStep(ctx, next); err != nil {
+		return err
+	}
+	*step = next
+	return nil
+}
+
+// Terminate reports the workflow and its started steps as terminated, unless it has already finished
+func (w *Workflow) Terminate(ctx context.Context, reason error, wsr *WorkflowStatusReporter) error {
+	if w.Status.IsFinal() {
+		return nil
+	}
+	for _, key := range w.StepKeys() {
+		step := w.Steps[key]
+		if step.Status == WorkflowStepPending || step.Status.IsFinal() {
+			continue
+		}
+		terminated := *step
+		terminated.Status = WorkflowStepTerminated
+		terminated.Err = reason
+		terminated.FinishedAt = time.Now()
+		if err := wsr.ReportStep(ctx, terminated); err != nil {
+			return err
+		}
+		*step = terminated
+	}
+	if err := wsr.Report(ctx, WorkflowTerminated, reason); err != nil {
+		return err
+	}
+	w.Status = WorkflowTerminated
+	w.Err = reason
+	return nil
+}
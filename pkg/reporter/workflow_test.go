@@ -0,0 +1,155 @@
+package reporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+)
+
+// recordingAPI records the reports it accepts, and rejects the ones it is told to fail once
+type recordingAPI struct {
+	reports []string
+	fail    map[string]bool
+}
+
+func (r *recordingAPI) record(report string) error {
+	if r.fail[report] {
+		delete(r.fail, report)
+		return errors.New("rejected")
+	}
+	r.reports = append(r.reports, report)
+	return nil
+}
+
+func (r *recordingAPI) ReportWorkflowStaus(_ context.Context, _ string, status WorkflowStatus, _ error) error {
+	return r.record("workflow:" + string(status))
+}
+
+func (r *recordingAPI) ReportWorkflowStepStaus(_ context.Context, _ string, step WorkflowStep) error {
+	return r.record(fmt.Sprintf("step:%s:%s", step.Name, step.Status))
+}
+
+func (r *recordingAPI) ReportWorkflowVariables(_ context.Context, _ string, vars []Variable) error {
+	return r.record(fmt.Sprintf("variables:%d", len(vars)))
+}
+
+func newTestReporter(api *recordingAPI) *WorkflowStatusReporter {
+	return &WorkflowStatusReporter{CodefreshAPI: api, Logger: logger.New(logger.Options{}), WorkflowID: "wf"}
+}
+
+func workflowWith(status WorkflowStatus, steps ...*WorkflowStep) *Workflow {
+	w := NewWorkflow()
+	w.Status = status
+	for _, step := range steps {
+		w.AddStep(step.Name, step)
+	}
+	return w
+}
+
+func TestSyncReportsEveryTransitionOfALateState(t *testing.T) {
+	api := &recordingAPI{}
+	desired := workflowWith(WorkflowSucceded,
+		&WorkflowStep{Name: "build", Status: WorkflowStepSucceded},
+		&WorkflowStep{Name: "notify", Status: WorkflowStepSkipped},
+	)
+	desired.Results = []Variable{{Name: "image", Value: "app:1"}}
+
+	workflow := NewWorkflow()
+	if err := workflow.Sync(context.Background(), desired, newTestReporter(api)); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"workflow:running",
+		"step:build:running",
+		"step:build:success",
+		"step:notify:skipped",
+		"variables:1",
+		"workflow:success",
+	}
+	if !reflect.DeepEqual(api.reports, want) {
+		t.Errorf("expected %v, got %v", want, api.reports)
+	}
+	if workflow.Status != WorkflowSucceded {
+		t.Errorf("expected the workflow to be done, got %s", workflow.Status)
+	}
+}
+
+func TestSyncRetriesOnlyTheRejectedReports(t *testing.T) {
+	api := &recordingAPI{fail: map[string]bool{"step:build:success": true}}
+	wsr := newTestReporter(api)
+	desired := workflowWith(WorkflowRunning,
+		&WorkflowStep{Name: "build", Status: WorkflowStepSucceded},
+		&WorkflowStep{Name: "test", Status: WorkflowStepRunning},
+	)
+
+	workflow := NewWorkflow()
+	if err := workflow.Sync(context.Background(), desired, wsr); err == nil {
+		t.Fatal("expected the rejected report to fail the sync")
+	}
+	if err := workflow.Sync(context.Background(), desired, wsr); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"workflow:running",
+		"step:build:running",
+		"step:build:success",
+		"step:test:running",
+	}
+	if !reflect.DeepEqual(api.reports, want) {
+		t.Errorf("expected %v, got %v", want, api.reports)
+	}
+}
+
+func TestSyncIgnoresPendingWorkflowsAndFinishedOnes(t *testing.T) {
+	api := &recordingAPI{}
+	wsr := newTestReporter(api)
+	workflow := NewWorkflow()
+	if err := workflow.Sync(context.Background(), workflowWith(WorkflowPending), wsr); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.reports) != 0 {
+		t.Fatalf("expected a pending workflow not to be reported, got %v", api.reports)
+	}
+
+	if err := workflow.Sync(context.Background(), workflowWith(WorkflowFailed), wsr); err != nil {
+		t.Fatal(err)
+	}
+	if err := workflow.Sync(context.Background(), workflowWith(WorkflowSucceded), wsr); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"workflow:running", "workflow:error"}
+	if !reflect.DeepEqual(api.reports, want) {
+		t.Errorf("expected %v, got %v", want, api.reports)
+	}
+}
+
+func TestTerminateStopsTheStartedSteps(t *testing.T) {
+	api := &recordingAPI{}
+	wsr := newTestReporter(api)
+	workflow := NewWorkflow()
+	desired := workflowWith(WorkflowRunning,
+		&WorkflowStep{Name: "build", Status: WorkflowStepSucceded},
+		&WorkflowStep{Name: "test", Status: WorkflowStepRunning},
+		&WorkflowStep{Name: "deploy", Status: WorkflowStepPending},
+	)
+	if err := workflow.Sync(context.Background(), desired, wsr); err != nil {
+		t.Fatal(err)
+	}
+	api.reports = nil
+
+	reason := errors.New("stopped")
+	if err := workflow.Terminate(context.Background(), reason, wsr); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"step:test:terminated", "workflow:terminated"}
+	if !reflect.DeepEqual(api.reports, want) {
+		t.Errorf("expected %v, got %v", want, api.reports)
+	}
+	if workflow.Status != WorkflowTerminated || workflow.Err != reason {
+		t.Errorf("expected the workflow to be terminated, got %s: %v", workflow.Status, workflow.Err)
+	}
+}
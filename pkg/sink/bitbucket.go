@@ -0,0 +1,138 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+const (
+	// DefaultBitbucketURL is the URL of the Bitbucket Cloud API
+	DefaultBitbucketURL = "https://api.bitbucket.org/2.0"
+
+	// bitbucketMaxKey is the longest build status key Bitbucket Server accepts
+	bitbucketMaxKey = 40
+)
+
+type (
+	// Bitbucket implements reporter.CodefreshAPI by publishing the status of workflows and of
+	// their steps on the commits they built, as Bitbucket Cloud or Server build statuses
+	Bitbucket struct {
+		commitStatuses
+		server bool
+	}
+
+	// BitbucketOptions to build new Bitbucket, whose URL is DefaultBitbucketURL when empty.
+	// TargetURL is required, Bitbucket does not accept build statuses without a link
+	BitbucketOptions struct {
+		CommitStatusOptions
+		// Server publishes to the Bitbucket Server (Data Center) API, at the root URL of the server
+		Server bool
+	}
+
+	bitbucketStatus struct {
+		Key         string `json:"key"`
+		State       string `json:"state"`
+		Name        string `json:"name"`
+		URL         string `json:"url"`
+		Description string `json:"description,omitempty"`
+	}
+)
+
+// NewBitbucket builds a Bitbucket sink that finds the commit of each workflow in commits.
+// The repository of a commit is its full name ("workspace/repository") on Bitbucket Cloud,
+// and is not needed by Bitbucket Server
+func NewBitbucket(commits *Commits, options BitbucketOptions) (*Bitbucket, error) {
+	if options.TargetURL == "" {
+		return nil, fmt.Errorf("bitbucket build statuses require a target URL")
+	}
+	if options.URL == "" && !options.Server {
+		options.URL = DefaultBitbucketURL
+	}
+	b := &Bitbucket{
+		commitStatuses: commitStatuses{
+			provider: ProviderBitbucket,
+			commits:  commits,
+			options:  options.CommitStatusOptions,
+		},
+		server: options.Server,
+	}
+	b.publish = b.publishStatus
+	return b, nil
+}
+
+func (b *Bitbucket) publishStatus(ctx context.Context, workflow string, commit Commit, r commitReport) error {
+	statusURL := fmt.Sprintf("%s/repositories/%s/commit/%s/statuses/build", b.apiURL(commit), commit.Repository, commit.SHA)
+	if b.server {
+		statusURL = fmt.Sprintf("%s/rest/build-status/1.0/commits/%s", b.apiURL(commit), commit.SHA)
+	}
+	_, err := b.send(ctx, http.MethodPost, statusURL, bitbucketStatus{
+		Key:         bitbucketKey(r.name),
+		State:       BitbucketState(r.status, b.server),
+		Name:        r.name,
+		URL:         b.targetURL(workflow),
+		Description: truncate(description(r), 255),
+	}, b.headers(commit))
+	return err
+}
+
+// headers authenticate with a bearer token, or with basic auth when the token is "<user>:<app password>"
+func (b *Bitbucket) headers(commit Commit) http.Header {
+	headers := http.Header{}
+	token := b.token(commit)
+	if token == "" {
+		return headers
+	}
+	req := &http.Request{Header: headers}
+	if parts := strings.SplitN(token, ":", 2); len(parts) == 2 {
+		req.SetBasicAuth(parts[0], parts[1])
+	} else {
+		headers.Set("Authorization", "Bearer "+token)
+	}
+	return headers
+}
+
+// bitbucketKey identifies a status among the statuses of a commit, within the length Bitbucket accepts
+func bitbucketKey(name string) string {
+	if len(name) <= bitbucketMaxKey {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:bitbucketMaxKey]
+}
+
+// BitbucketState maps a workflow or step status to the state of a Bitbucket build status.
+// Bitbucket Server has no state for stopped builds, which fail instead
+func BitbucketState(status string, server bool) string {
+	switch status {
+	case string(reporter.WorkflowSucceded), string(reporter.WorkflowStepSkipped):
+		return "SUCCESSFUL"
+	case string(reporter.WorkflowFailed), string(reporter.WorkflowTimeout), string(reporter.WorkflowStepDenied):
+		return "FAILED"
+	case string(reporter.WorkflowTerminated):
+		if server {
+			return "FAILED"
+		}
+		return "STOPPED"
+	}
+	return "INPROGRESS"
+}
@@ -0,0 +1,85 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestBitbucketState(t *testing.T) {
+	if got := BitbucketState(string(reporter.WorkflowTerminated), false); got != "STOPPED" {
+		t.Errorf("expected cloud to stop terminated builds, got %s", got)
+	}
+	if got := BitbucketState(string(reporter.WorkflowTerminated), true); got != "FAILED" {
+		t.Errorf("expected server to fail terminated builds, got %s", got)
+	}
+	if got := BitbucketState(string(reporter.WorkflowRunning), true); got != "INPROGRESS" {
+		t.Errorf("expected running builds to be in progress, got %s", got)
+	}
+}
+
+func TestBitbucketKeyFitsTheServerLimit(t *testing.T) {
+	if got := bitbucketKey("codefresh/build"); got != "codefresh/build" {
+		t.Errorf("expected a short key to be kept, got %s", got)
+	}
+	long := "codefresh/" + strings.Repeat("step", 20)
+	if got := bitbucketKey(long); len(got) != bitbucketMaxKey || got != bitbucketKey(long) {
+		t.Errorf("expected a stable key of %d characters, got %s", bitbucketMaxKey, got)
+	}
+}
+
+func TestBitbucketAuthentication(t *testing.T) {
+	api := &apiRecorder{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	commits := NewCommits(time.Minute)
+	b, err := NewBitbucket(commits, BitbucketOptions{
+		CommitStatusOptions: CommitStatusOptions{
+			URL:        srv.URL,
+			Token:      "user:app-password",
+			Context:    "codefresh",
+			TargetURL:  "https://g.codefresh.io/build/{workflow}",
+			HTTPClient: srv.Client(),
+		},
+		Server: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	commits.Set("basic", Commit{SHA: "abc"})
+	commits.Set("bearer", Commit{SHA: "def", Token: "run-token"})
+	for _, workflow := range []string{"basic", "bearer"} {
+		if err := b.ReportWorkflowStaus(context.Background(), workflow, reporter.WorkflowRunning, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	requests := api.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 statuses, got %+v", requests)
+	}
+	if requests[0].path != "/rest/build-status/1.0/commits/abc" || !strings.HasPrefix(requests[0].auth, "Basic ") {
+		t.Errorf("expected basic auth on the server API, got %s with %q", requests[0].path, requests[0].auth)
+	}
+	if requests[1].auth != "Bearer run-token" {
+		t.Errorf("expected the run's token as a bearer token, got %q", requests[1].auth)
+	}
+}
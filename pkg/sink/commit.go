@@ -0,0 +1,64 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import "time"
+
+// Providers hosting commits
+const (
+	ProviderGitHub    = "github"
+	ProviderGitLab    = "gitlab"
+	ProviderBitbucket = "bitbucket"
+)
+
+type (
+	// Commit is the revision of a repository a workflow built, which source control sinks report to
+	Commit struct {
+		// Repository is the full name of the repository, e.g. "owner/name"
+		Repository string
+		SHA        string
+		// Token authenticates to the source control API, instead of the sink's token
+		Token string
+		// Provider hosting the repository, only its sink reports the commit. Every sink does when empty
+		Provider string
+		// URL of the source control API, instead of the sink's URL. The sink's token is never sent to it
+		URL string
+	}
+
+	// Commits maps workflows to the commits they built. A workflow that is known
+	// not to have built a commit maps to an empty Commit
+	Commits struct {
+		registry
+	}
+)
+
+// NewCommits builds Commits that keep forgotten workflows for ttl
+func NewCommits(ttl time.Duration) *Commits {
+	return &Commits{registry: newRegistry(ttl)}
+}
+
+// Set sets the commit a workflow built
+func (c *Commits) Set(workflow string, commit Commit) {
+	c.set(workflow, commit)
+}
+
+// Get returns the commit a workflow built, if the workflow is known
+func (c *Commits) Get(workflow string) (Commit, bool) {
+	v, ok := c.get(workflow)
+	if !ok {
+		return Commit{}, false
+	}
+	return v.(Commit), true
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+type (
+	// CommitStatusOptions are shared by the sinks that publish statuses on commits
+	CommitStatusOptions struct {
+		// URL of the API, for the commits that do not have their own
+		URL string
+		// Token authenticates to URL, for the commits that do not have their own.
+		// It is never sent to the URL of a commit hosted elsewhere
+		Token string
+		// Context names the workflow's status, its steps are named "<context>/<step>"
+		Context string
+		// TargetURL links the statuses to the workflow, {workflow} is replaced with the workflow ID
+		TargetURL string
+		// Steps reports the status of each step besides the status of the workflow,
+		// which is the only status reported otherwise
+		Steps      bool
+		HTTPClient *http.Client
+	}
+
+	// commitStatuses implements reporter.CodefreshAPI for the sinks that publish statuses on commits.
+	// Workflows that did not build a commit, or whose commit is hosted by another provider, are not
+	// reported. The reports of unknown workflows can not be delivered
+	commitStatuses struct {
+		provider string
+		commits  *Commits
+		options  CommitStatusOptions
+		publish  func(ctx context.Context, workflow string, commit Commit, r commitReport) error
+	}
+
+	// commitReport is a workflow or step transition, as published on a commit
+	commitReport struct {
+		name        string
+		status      string
+		err         string
+		final       bool
+		startedAt   time.Time
+		completedAt time.Time
+	}
+)
+
+func (s *commitStatuses) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return s.report(ctx, workflow, commitReport{
+		name:   s.options.Context,
+		status: string(status),
+		err:    reporter.ErrString(err),
+		final:  status.IsFinal(),
+	})
+}
+
+func (s *commitStatuses) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	if !s.options.Steps {
+		return nil
+	}
+	return s.report(ctx, workflow, commitReport{
+		name:        fmt.Sprintf("%s/%s", s.options.Context, step.Name),
+		status:      string(step.Status),
+		err:         reporter.ErrString(step.Err),
+		final:       step.Status.IsFinal(),
+		startedAt:   step.StartedAt,
+		completedAt: step.FinishedAt,
+	})
+}
+
+// ReportWorkflowVariables does nothing, commit statuses have no variables
+func (s *commitStatuses) ReportWorkflowVariables(context.Context, string, []reporter.Variable) error {
+	return nil
+}
+
+func (s *commitStatuses) report(ctx context.Context, workflow string, r commitReport) error {
+	commit, ok := s.commits.Get(workflow)
+	if !ok {
+		return reporter.Permanent(fmt.Errorf("the commit of workflow %s is unknown", workflow))
+	}
+	if commit.SHA == "" || (commit.Provider != "" && commit.Provider != s.provider) {
+		return nil
+	}
+	return s.publish(ctx, workflow, commit, r)
+}
+
+// apiURL returns the URL of the API hosting the commit
+func (s *commitStatuses) apiURL(commit Commit) string {
+	if commit.URL != "" {
+		return strings.TrimRight(commit.URL, "/")
+	}
+	return strings.TrimRight(s.options.URL, "/")
+}
+
+// token returns the token that authenticates to the API hosting the commit. The sink's token is
+// only sent to the sink's URL, the commits hosted anywhere else must bring their own token
+func (s *commitStatuses) token(commit Commit) string {
+	if commit.Token != "" {
+		return commit.Token
+	}
+	if s.apiURL(commit) != strings.TrimRight(s.options.URL, "/") {
+		return ""
+	}
+	return s.options.Token
+}
+
+func (s *commitStatuses) targetURL(workflow string) string {
+	return strings.ReplaceAll(s.options.TargetURL, "{workflow}", workflow)
+}
+
+// send makes a request to the API hosting the commit, with body as JSON
+func (s *commitStatuses) send(ctx context.Context, method, url string, body interface{}, headers http.Header) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return send(ctx, s.options.HTTPClient, method, url, data, headers)
+}
+
+// description summarizes a transition for source control, which shows it next to its status
+func description(r commitReport) string {
+	if r.err != "" {
+		return fmt.Sprintf("%s: %s", r.status, r.err)
+	}
+	return r.status
+}
+
+// truncate cuts s to at most max bytes, ending with "..." once cut, without splitting a rune
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	size := max - len("...")
+	for size > 0 && !utf8.RuneStart(s[size]) {
+		size--
+	}
+	return s[:size] + "..."
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestCommitStatusesKeepTheSinkTokenToTheSinkURL(t *testing.T) {
+	ctx := context.Background()
+	elsewhere := &apiRecorder{}
+	srv := httptest.NewServer(elsewhere)
+	t.Cleanup(srv.Close)
+	api := &apiRecorder{}
+	g, commits, _ := newTestGitHub(t, api, GitHubStatuses)
+
+	commits.Set("configured", Commit{Repository: "owner/repo", SHA: "abc", URL: g.options.URL + "/"})
+	commits.Set("elsewhere", Commit{Repository: "owner/repo", SHA: "abc", URL: srv.URL})
+	commits.Set("own-token", Commit{Repository: "owner/repo", SHA: "abc", URL: srv.URL, Token: "run-token"})
+	for _, workflow := range []string{"configured", "elsewhere", "own-token"} {
+		if err := g.ReportWorkflowStaus(ctx, workflow, reporter.WorkflowRunning, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if requests := api.received(); len(requests) != 1 || requests[0].auth != "token sink-token" {
+		t.Errorf("expected the sink's URL to get the sink's token, got %+v", requests)
+	}
+	requests := elsewhere.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 statuses on the run's URL, got %+v", requests)
+	}
+	if requests[0].auth != "" {
+		t.Errorf("expected the sink's token not to be sent to the run's URL, got %q", requests[0].auth)
+	}
+	if requests[1].auth != "token run-token" {
+		t.Errorf("expected the run's own token, got %q", requests[1].auth)
+	}
+}
+
+func TestTruncateDoesNotSplitRunes(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{s: "short", max: 10, want: "short"},
+		{s: "exactly10!", max: 10, want: "exactly10!"},
+		{s: "a longer description", max: 10, want: "a longe..."},
+		{s: "déploiement", max: 5, want: "d..."},
+		{s: "ééééé", max: 8, want: "éé..."},
+		{s: "日本語の説明", max: 10, want: "日本..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got := truncate(tt.s, tt.max)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+			}
+			if len(got) > tt.max || !utf8.ValidString(got) {
+				t.Errorf("truncate(%q, %d) = %q is not a valid string of at most %d bytes", tt.s, tt.max, got, tt.max)
+			}
+		})
+	}
+}
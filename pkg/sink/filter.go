@@ -0,0 +1,63 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// Filter implements reporter.CodefreshAPI on top of another CodefreshAPI, passing on only
+// the workflow and step reports with one of the selected statuses. Variables are always passed on
+type Filter struct {
+	api      reporter.CodefreshAPI
+	statuses map[string]bool
+}
+
+// NewFilter builds a Filter that passes on the reports with any of the statuses,
+// which are matched against both workflow and step statuses. No statuses pass on every report
+func NewFilter(api reporter.CodefreshAPI, statuses []string) *Filter {
+	f := &Filter{api: api}
+	if len(statuses) > 0 {
+		f.statuses = map[string]bool{}
+		for _, s := range statuses {
+			f.statuses[s] = true
+		}
+	}
+	return f
+}
+
+func (f *Filter) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	if !f.matches(string(status)) {
+		return nil
+	}
+	return f.api.ReportWorkflowStaus(ctx, workflow, status, err)
+}
+
+func (f *Filter) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	if !f.matches(string(step.Status)) {
+		return nil
+	}
+	return f.api.ReportWorkflowStepStaus(ctx, workflow, step)
+}
+
+func (f *Filter) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	return f.api.ReportWorkflowVariables(ctx, workflow, variables)
+}
+
+func (f *Filter) matches(status string) bool {
+	return f.statuses == nil || f.statuses[status]
+}
@@ -0,0 +1,50 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestFilterPassesOnTheSelectedStatuses(t *testing.T) {
+	ctx := context.Background()
+	api := &recordingAPI{}
+	f := NewFilter(api, []string{string(reporter.WorkflowFailed), string(reporter.WorkflowSucceded)})
+
+	for _, status := range []reporter.WorkflowStatus{reporter.WorkflowRunning, reporter.WorkflowFailed, reporter.WorkflowSucceded} {
+		if err := f.ReportWorkflowStaus(ctx, "wf", status, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []reporter.WorkflowStatus{reporter.WorkflowFailed, reporter.WorkflowSucceded}
+	if !reflect.DeepEqual(api.statuses, want) {
+		t.Errorf("expected %v, got %v", want, api.statuses)
+	}
+}
+
+func TestFilterWithoutStatusesPassesOnEverything(t *testing.T) {
+	api := &recordingAPI{}
+	f := NewFilter(api, nil)
+	if err := f.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(api.statuses) != 1 {
+		t.Errorf("expected the report to be passed on, got %v", api.statuses)
+	}
+}
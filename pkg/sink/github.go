@@ -0,0 +1,250 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+const (
+	// DefaultGitHubURL is the URL of the public GitHub API
+	DefaultGitHubURL = "https://api.github.com"
+
+	// GitHubStatuses reports commit statuses
+	GitHubStatuses = "statuses"
+	// GitHubChecks reports check runs, which requires the token of a GitHub App
+	GitHubChecks = "checks"
+)
+
+type (
+	// GitHub implements reporter.CodefreshAPI by publishing the status of workflows and of
+	// their steps on the commits they built, as commit statuses or check runs
+	GitHub struct {
+		commitStatuses
+		mode      string
+		checkRuns *CheckRuns
+	}
+
+	// CheckRuns maps workflows to the IDs of the check runs reporting them, by check name
+	CheckRuns struct {
+		registry
+	}
+
+	// GitHubOptions to build new GitHub, whose URL is DefaultGitHubURL when empty
+	GitHubOptions struct {
+		CommitStatusOptions
+		// Mode is either GitHubStatuses (the default) or GitHubChecks
+		Mode string
+	}
+
+	gitHubStatus struct {
+		State       string `json:"state"`
+		TargetURL   string `json:"target_url,omitempty"`
+		Description string `json:"description,omitempty"`
+		Context     string `json:"context"`
+	}
+
+	gitHubCheckRun struct {
+		ID          int64           `json:"id,omitempty"`
+		Name        string          `json:"name,omitempty"`
+		HeadSHA     string          `json:"head_sha,omitempty"`
+		DetailsURL  string          `json:"details_url,omitempty"`
+		Status      string          `json:"status,omitempty"`
+		Conclusion  string          `json:"conclusion,omitempty"`
+		StartedAt   *time.Time      `json:"started_at,omitempty"`
+		CompletedAt *time.Time      `json:"completed_at,omitempty"`
+		Output      *gitHubCheckOut `json:"output,omitempty"`
+	}
+
+	gitHubCheckOut struct {
+		Title   string `json:"title"`
+		Summary string `json:"summary"`
+	}
+)
+
+// NewCheckRuns builds CheckRuns that keep forgotten workflows for ttl
+func NewCheckRuns(ttl time.Duration) *CheckRuns {
+	return &CheckRuns{registry: newRegistry(ttl)}
+}
+
+// NewGitHub builds a GitHub sink that finds the commit of each workflow in commits,
+// and keeps the check runs it created in checkRuns
+func NewGitHub(commits *Commits, checkRuns *CheckRuns, options GitHubOptions) (*GitHub, error) {
+	if options.URL == "" {
+		options.URL = DefaultGitHubURL
+	}
+	if options.Mode == "" {
+		options.Mode = GitHubStatuses
+	}
+	if options.Mode != GitHubStatuses && options.Mode != GitHubChecks {
+		return nil, fmt.Errorf("unknown GitHub mode %q, expected %q or %q", options.Mode, GitHubStatuses, GitHubChecks)
+	}
+	g := &GitHub{
+		commitStatuses: commitStatuses{
+			provider: ProviderGitHub,
+			commits:  commits,
+			options:  options.CommitStatusOptions,
+		},
+		mode:      options.Mode,
+		checkRuns: checkRuns,
+	}
+	g.publish = g.publishStatus
+	if g.mode == GitHubChecks {
+		g.publish = g.publishCheckRun
+	}
+	return g, nil
+}
+
+// publishStatus sets a commit status, which replaces the previous status with the same context
+func (g *GitHub) publishStatus(ctx context.Context, workflow string, commit Commit, r commitReport) error {
+	url := fmt.Sprintf("%s/repos/%s/statuses/%s", g.apiURL(commit), commit.Repository, commit.SHA)
+	_, err := g.send(ctx, http.MethodPost, url, gitHubStatus{
+		State:       GitHubState(r.status),
+		TargetURL:   g.targetURL(workflow),
+		Description: truncate(description(r), 140),
+		Context:     r.name,
+	}, g.headers(commit))
+	return err
+}
+
+// publishCheckRun creates the check run of the first transition, and updates it with the next ones
+func (g *GitHub) publishCheckRun(ctx context.Context, workflow string, commit Commit, r commitReport) error {
+	check := gitHubCheckRun{
+		Name:       r.name,
+		HeadSHA:    commit.SHA,
+		DetailsURL: g.targetURL(workflow),
+		Status:     "in_progress",
+		StartedAt:  reporter.TimePtr(r.startedAt),
+		Output: &gitHubCheckOut{
+			Title:   r.status,
+			Summary: description(r),
+		},
+	}
+	if r.final {
+		check.Status = "completed"
+		check.Conclusion = GitHubConclusion(r.status)
+		check.CompletedAt = reporter.TimePtr(r.completedAt)
+		if check.CompletedAt == nil {
+			check.CompletedAt = reporter.TimePtr(time.Now())
+		}
+	}
+
+	if id, ok := g.checkRuns.get(workflow, r.name); ok {
+		url := fmt.Sprintf("%s/repos/%s/check-runs/%d", g.apiURL(commit), commit.Repository, id)
+		if _, err := g.send(ctx, http.MethodPatch, url, check, g.headers(commit)); err != nil {
+			return err
+		}
+		if r.final {
+			// a completed check run is not updated again
+			g.checkRuns.remove(workflow, r.name)
+		}
+		return nil
+	}
+	url := fmt.Sprintf("%s/repos/%s/check-runs", g.apiURL(commit), commit.Repository)
+	data, err := g.send(ctx, http.MethodPost, url, check, g.headers(commit))
+	if err != nil {
+		return err
+	}
+	created := gitHubCheckRun{}
+	if err := json.Unmarshal(data, &created); err != nil {
+		return fmt.Errorf("failed to read created check run: %w", err)
+	}
+	if !r.final {
+		g.checkRuns.set(workflow, r.name, created.ID)
+	}
+	return nil
+}
+
+func (c *CheckRuns) get(workflow, name string) (int64, bool) {
+	v, ok := c.registry.get(workflow)
+	if !ok {
+		return 0, false
+	}
+	id, ok := v.(map[string]int64)[name]
+	return id, ok
+}
+
+func (c *CheckRuns) set(workflow, name string, id int64) {
+	c.update(workflow, func(v interface{}, ok bool) interface{} {
+		ids := checkRunsBut(v, ok, name)
+		ids[name] = id
+		return ids
+	})
+}
+
+func (c *CheckRuns) remove(workflow, name string) {
+	c.update(workflow, func(v interface{}, ok bool) interface{} {
+		return checkRunsBut(v, ok, name)
+	})
+}
+
+// checkRunsBut copies the check runs of a workflow but the one named name,
+// the map is replaced rather than changed since readers may be holding it
+func checkRunsBut(v interface{}, ok bool, name string) map[string]int64 {
+	ids := map[string]int64{}
+	if ok {
+		for n, id := range v.(map[string]int64) {
+			if n != name {
+				ids[n] = id
+			}
+		}
+	}
+	return ids
+}
+
+func (g *GitHub) headers(commit Commit) http.Header {
+	headers := http.Header{}
+	headers.Set("Accept", "application/vnd.github.v3+json")
+	if token := g.token(commit); token != "" {
+		headers.Set("Authorization", "token "+token)
+	}
+	return headers
+}
+
+// GitHubState maps a workflow or step status to the state of a commit status
+func GitHubState(status string) string {
+	switch status {
+	case string(reporter.WorkflowSucceded), string(reporter.WorkflowStepSkipped):
+		return "success"
+	case string(reporter.WorkflowFailed), string(reporter.WorkflowStepDenied):
+		return "failure"
+	case string(reporter.WorkflowTerminated), string(reporter.WorkflowTimeout):
+		return "error"
+	}
+	return "pending"
+}
+
+// GitHubConclusion maps a final workflow or step status to the conclusion of a check run
+func GitHubConclusion(status string) string {
+	switch status {
+	case string(reporter.WorkflowSucceded):
+		return "success"
+	case string(reporter.WorkflowStepSkipped):
+		return "skipped"
+	case string(reporter.WorkflowTerminated):
+		return "cancelled"
+	case string(reporter.WorkflowTimeout):
+		return "timed_out"
+	case string(reporter.WorkflowStepDenied):
+		return "action_required"
+	}
+	return "failure"
+}
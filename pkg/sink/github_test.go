@@ -0,0 +1,233 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// apiRecorder stands in for a source control API, recording the requests it gets
+type apiRecorder struct {
+	mu       sync.Mutex
+	requests []apiRequest
+	// respond is the body of the responses, "{}" when empty
+	respond string
+}
+
+type apiRequest struct {
+	method string
+	path   string
+	auth   string
+	header http.Header
+	body   map[string]interface{}
+}
+
+func (a *apiRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body := map[string]interface{}{}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requests = append(a.requests, apiRequest{
+		method: req.Method,
+		path:   req.URL.EscapedPath(),
+		auth:   req.Header.Get("Authorization"),
+		header: req.Header.Clone(),
+		body:   body,
+	})
+	resp := a.respond
+	if resp == "" {
+		resp = "{}"
+	}
+	_, _ = w.Write([]byte(resp))
+}
+
+func (a *apiRecorder) received() []apiRequest {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]apiRequest(nil), a.requests...)
+}
+
+func newTestGitHub(t *testing.T, api *apiRecorder, mode string) (*GitHub, *Commits, *CheckRuns) {
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	commits := NewCommits(time.Minute)
+	checkRuns := NewCheckRuns(time.Minute)
+	g, err := NewGitHub(commits, checkRuns, GitHubOptions{
+		CommitStatusOptions: CommitStatusOptions{
+			URL:        srv.URL,
+			Token:      "sink-token",
+			Context:    "codefresh",
+			TargetURL:  "https://g.codefresh.io/build/{workflow}",
+			Steps:      true,
+			HTTPClient: srv.Client(),
+		},
+		Mode: mode,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g, commits, checkRuns
+}
+
+func TestGitHubState(t *testing.T) {
+	tests := map[string]string{
+		string(reporter.WorkflowRunning):             "pending",
+		string(reporter.WorkflowStepPendingApproval): "pending",
+		string(reporter.WorkflowSucceded):            "success",
+		string(reporter.WorkflowStepSkipped):         "success",
+		string(reporter.WorkflowFailed):              "failure",
+		string(reporter.WorkflowStepDenied):          "failure",
+		string(reporter.WorkflowTerminated):          "error",
+		string(reporter.WorkflowTimeout):             "error",
+	}
+	for status, want := range tests {
+		if got := GitHubState(status); got != want {
+			t.Errorf("GitHubState(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestGitHubConclusion(t *testing.T) {
+	tests := map[string]string{
+		string(reporter.WorkflowSucceded):    "success",
+		string(reporter.WorkflowStepSkipped): "skipped",
+		string(reporter.WorkflowTerminated):  "cancelled",
+		string(reporter.WorkflowTimeout):     "timed_out",
+		string(reporter.WorkflowStepDenied):  "action_required",
+		string(reporter.WorkflowFailed):      "failure",
+	}
+	for status, want := range tests {
+		if got := GitHubConclusion(status); got != want {
+			t.Errorf("GitHubConclusion(%q) = %q, want %q", status, got, want)
+		}
+	}
+}
+
+func TestGitHubStatuses(t *testing.T) {
+	api := &apiRecorder{}
+	g, commits, _ := newTestGitHub(t, api, GitHubStatuses)
+	ctx := context.Background()
+	commits.Set("wf", Commit{Repository: "owner/repo", SHA: "abc"})
+	commits.Set("other-provider", Commit{Repository: "owner/repo", SHA: "def", Provider: ProviderGitLab})
+
+	if err := g.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	step := reporter.WorkflowStep{Name: "build", Status: reporter.WorkflowStepFailed, Err: fmt.Errorf("exit code 1")}
+	if err := g.ReportWorkflowStepStaus(ctx, "wf", step); err != nil {
+		t.Fatal(err)
+	}
+	// neither is published: the first did not build a commit, the second is hosted by another provider
+	commits.Set("no-commit", Commit{})
+	for _, workflow := range []string{"no-commit", "other-provider"} {
+		if err := g.ReportWorkflowStaus(ctx, workflow, reporter.WorkflowRunning, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// and the reports of an unknown workflow are not taken as delivered
+	if err := g.ReportWorkflowStaus(ctx, "unknown", reporter.WorkflowRunning, nil); !reporter.IsPermanent(err) {
+		t.Fatalf("expected the report of an unknown workflow to fail for good, got %v", err)
+	}
+
+	requests := api.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 statuses, got %+v", requests)
+	}
+	for _, req := range requests {
+		if req.method != http.MethodPost || req.path != "/repos/owner/repo/statuses/abc" {
+			t.Errorf("expected a status of the commit, got %s %s", req.method, req.path)
+		}
+		if req.auth != "token sink-token" {
+			t.Errorf("expected the sink's token, got %q", req.auth)
+		}
+		if req.body["target_url"] != "https://g.codefresh.io/build/wf" {
+			t.Errorf("expected the status to link to the workflow, got %v", req.body["target_url"])
+		}
+	}
+	if requests[0].body["context"] != "codefresh" || requests[0].body["state"] != "pending" {
+		t.Errorf("unexpected workflow status %v", requests[0].body)
+	}
+	if requests[1].body["context"] != "codefresh/build" || requests[1].body["state"] != "failure" ||
+		requests[1].body["description"] != string(reporter.WorkflowStepFailed)+": exit code 1" {
+		t.Errorf("unexpected step status %v", requests[1].body)
+	}
+}
+
+func TestGitHubCheckRunIsCreatedThenUpdated(t *testing.T) {
+	api := &apiRecorder{respond: `{"id": 42}`}
+	g, commits, checkRuns := newTestGitHub(t, api, GitHubChecks)
+	ctx := context.Background()
+	commits.Set("wf", Commit{Repository: "owner/repo", SHA: "abc"})
+
+	if err := g.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	requests := api.received()
+	if len(requests) != 2 {
+		t.Fatalf("expected the check run to be created and updated, got %+v", requests)
+	}
+	created, updated := requests[0], requests[1]
+	if created.method != http.MethodPost || created.path != "/repos/owner/repo/check-runs" {
+		t.Errorf("expected the check run to be created, got %s %s", created.method, created.path)
+	}
+	if created.body["head_sha"] != "abc" || created.body["name"] != "codefresh" || created.body["status"] != "in_progress" {
+		t.Errorf("unexpected created check run %v", created.body)
+	}
+	if updated.method != http.MethodPatch || updated.path != "/repos/owner/repo/check-runs/42" {
+		t.Errorf("expected the check run to be updated, got %s %s", updated.method, updated.path)
+	}
+	if updated.body["status"] != "completed" || updated.body["conclusion"] != "success" || updated.body["completed_at"] == nil {
+		t.Errorf("unexpected updated check run %v", updated.body)
+	}
+	if _, ok := checkRuns.get("wf", "codefresh"); ok {
+		t.Error("expected the completed check run to be dropped")
+	}
+}
+
+func TestCheckRunsAreDroppedOnceForgotten(t *testing.T) {
+	checkRuns := NewCheckRuns(0)
+	checkRuns.set("wf", "codefresh", 1)
+	checkRuns.set("wf", "codefresh/build", 2)
+	if id, ok := checkRuns.get("wf", "codefresh/build"); !ok || id != 2 {
+		t.Fatalf("expected the check run of the step, got %d", id)
+	}
+
+	checkRuns.Forget("wf")
+	// still there until the next change, for the reports that are on their way
+	if _, ok := checkRuns.get("wf", "codefresh"); !ok {
+		t.Fatal("expected the check run to be kept until the ttl passed")
+	}
+	time.Sleep(time.Millisecond)
+	checkRuns.set("other", "codefresh", 3)
+	if _, ok := checkRuns.get("wf", "codefresh"); ok {
+		t.Error("expected the check runs of a forgotten workflow to be dropped")
+	}
+}
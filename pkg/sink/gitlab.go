@@ -0,0 +1,89 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// DefaultGitLabURL is the URL of the GitLab.com API
+const DefaultGitLabURL = "https://gitlab.com/api/v4"
+
+type (
+	// GitLab implements reporter.CodefreshAPI by publishing the status of workflows and of
+	// their steps on the commits they built, as GitLab commit statuses
+	GitLab struct {
+		commitStatuses
+	}
+
+	gitLabStatus struct {
+		State       string `json:"state"`
+		Name        string `json:"name"`
+		TargetURL   string `json:"target_url,omitempty"`
+		Description string `json:"description,omitempty"`
+	}
+)
+
+// NewGitLab builds a GitLab sink that finds the commit of each workflow in commits.
+// The repository of a commit is the ID or the full path of its project
+func NewGitLab(commits *Commits, options CommitStatusOptions) *GitLab {
+	if options.URL == "" {
+		options.URL = DefaultGitLabURL
+	}
+	g := &GitLab{
+		commitStatuses: commitStatuses{
+			provider: ProviderGitLab,
+			commits:  commits,
+			options:  options,
+		},
+	}
+	g.publish = g.publishStatus
+	return g
+}
+
+func (g *GitLab) publishStatus(ctx context.Context, workflow string, commit Commit, r commitReport) error {
+	statusURL := fmt.Sprintf("%s/projects/%s/statuses/%s", g.apiURL(commit), url.PathEscape(commit.Repository), commit.SHA)
+	headers := http.Header{}
+	if token := g.token(commit); token != "" {
+		headers.Set("PRIVATE-TOKEN", token)
+	}
+	_, err := g.send(ctx, http.MethodPost, statusURL, gitLabStatus{
+		State:       GitLabState(r.status),
+		Name:        r.name,
+		TargetURL:   g.targetURL(workflow),
+		Description: truncate(description(r), 255),
+	}, headers)
+	return err
+}
+
+// GitLabState maps a workflow or step status to the state of a GitLab commit status
+func GitLabState(status string) string {
+	switch status {
+	case string(reporter.WorkflowPending):
+		return "pending"
+	case string(reporter.WorkflowSucceded), string(reporter.WorkflowStepSkipped):
+		return "success"
+	case string(reporter.WorkflowFailed), string(reporter.WorkflowTimeout), string(reporter.WorkflowStepDenied):
+		return "failed"
+	case string(reporter.WorkflowTerminated):
+		return "canceled"
+	}
+	return "running"
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestGitLabState(t *testing.T) {
+	tests := map[string]string{
+		string(reporter.WorkflowPending):     "pending",
+		string(reporter.WorkflowRunning):     "running",
+		string(reporter.WorkflowStepSkipped): "success",
+		string(reporter.WorkflowTimeout):     "failed",
+		string(reporter.WorkflowTerminated):  "canceled",
+	}
+	for status, want := range tests {
+		if got := GitLabState(status); got != want {
+			t.Errorf("%s: expected %s, got %s", status, want, got)
+		}
+	}
+}
+
+func TestGitLabPublishesOnTheProject(t *testing.T) {
+	api := &apiRecorder{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	commits := NewCommits(time.Minute)
+	g := NewGitLab(commits, CommitStatusOptions{URL: srv.URL, Token: "sink-token", Context: "codefresh", HTTPClient: srv.Client()})
+
+	commits.Set("wf", Commit{Repository: "group/project", SHA: "abc"})
+	if err := g.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatal(err)
+	}
+	requests := api.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected a status, got %+v", requests)
+	}
+	if requests[0].path != "/projects/group%2Fproject/statuses/abc" {
+		t.Errorf("expected the project's path to be escaped, got %s", requests[0].path)
+	}
+	if got := requests[0].header.Get("PRIVATE-TOKEN"); got != "sink-token" {
+		t.Errorf("expected the sink's token, got %q", got)
+	}
+	if requests[0].body["state"] != "success" || requests[0].body["name"] != "codefresh" {
+		t.Errorf("unexpected status %v", requests[0].body)
+	}
+}
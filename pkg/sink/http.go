@@ -0,0 +1,77 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// StatusError is returned when a destination rejects a report
+type StatusError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e StatusError) Error() string {
+	return fmt.Sprintf("HTTP request rejected. Status-Code: %d. Message: %s", e.StatusCode, e.Message)
+}
+
+// isRetryableStatus tells if a report rejected with the status code may be accepted later,
+// other client errors are rejected again however many times the report is sent
+func isRetryableStatus(code int) bool {
+	return code < 400 || code >= 500 || code == http.StatusRequestTimeout || code == http.StatusTooManyRequests
+}
+
+// send makes an HTTP request with body and headers, and fails unless the response is a success
+func send(ctx context.Context, client *http.Client, method, url string, body []byte, headers http.Header) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = headers.Clone()
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := StatusError{StatusCode: resp.StatusCode, Message: string(data)}
+		if !isRetryableStatus(resp.StatusCode) {
+			return nil, reporter.Permanent(err)
+		}
+		return nil, err
+	}
+	return data, nil
+}
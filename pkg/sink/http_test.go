@@ -0,0 +1,61 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestSendMarksRejectedReportsAsPermanent(t *testing.T) {
+	tests := []struct {
+		code      int
+		permanent bool
+	}{
+		{code: http.StatusBadRequest, permanent: true},
+		{code: http.StatusUnauthorized, permanent: true},
+		{code: http.StatusNotFound, permanent: true},
+		{code: http.StatusRequestTimeout},
+		{code: http.StatusTooManyRequests},
+		{code: http.StatusInternalServerError},
+		{code: http.StatusBadGateway},
+	}
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.code), func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.code)
+				_, _ = w.Write([]byte("rejected"))
+			}))
+			defer srv.Close()
+
+			_, err := send(context.Background(), srv.Client(), http.MethodPost, srv.URL, []byte("{}"), nil)
+			if err == nil {
+				t.Fatal("expected the report to be rejected")
+			}
+			if got := reporter.IsPermanent(err); got != tt.permanent {
+				t.Errorf("expected permanent to be %v, got %v", tt.permanent, got)
+			}
+			var statusErr StatusError
+			if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.code || statusErr.Message != "rejected" {
+				t.Errorf("expected a status error with code %d, got %v", tt.code, err)
+			}
+		})
+	}
+}
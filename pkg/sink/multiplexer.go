@@ -0,0 +1,96 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+type (
+	// Multiplexer implements reporter.CodefreshAPI by sending every report to all of its sinks
+	// at the same time. A sink that fails does not stop the others from getting the report,
+	// its failure is logged and the report fails only when every sink failed, so reporting
+	// again does not send the same report twice to the sinks that got it. A failure of some
+	// of the sinks is not retried, so sinks are expected to retry their reports on their own,
+	// as they do behind a dispatcher or an outbox
+	Multiplexer struct {
+		logger logger.Logger
+		sinks  []namedSink
+	}
+
+	namedSink struct {
+		name string
+		api  reporter.CodefreshAPI
+	}
+)
+
+// NewMultiplexer builds a Multiplexer without sinks
+func NewMultiplexer(lgr logger.Logger) *Multiplexer {
+	return &Multiplexer{logger: lgr}
+}
+
+// Add adds a sink, its name is used to tell where reports failed
+func (m *Multiplexer) Add(name string, api reporter.CodefreshAPI) {
+	m.sinks = append(m.sinks, namedSink{name: name, api: api})
+}
+
+func (m *Multiplexer) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return m.send(func(api reporter.CodefreshAPI) error {
+		return api.ReportWorkflowStaus(ctx, workflow, status, err)
+	}, "workflow", workflow, "status", status)
+}
+
+func (m *Multiplexer) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	return m.send(func(api reporter.CodefreshAPI) error {
+		return api.ReportWorkflowStepStaus(ctx, workflow, step)
+	}, "workflow", workflow, "step", step.Name, "status", step.Status)
+}
+
+func (m *Multiplexer) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	return m.send(func(api reporter.CodefreshAPI) error {
+		return api.ReportWorkflowVariables(ctx, workflow, variables)
+	}, "workflow", workflow, "variables", len(variables))
+}
+
+func (m *Multiplexer) send(report func(api reporter.CodefreshAPI) error, keysAndValues ...interface{}) error {
+	errs := make([]error, len(m.sinks))
+	var wg sync.WaitGroup
+	for i, s := range m.sinks {
+		wg.Add(1)
+		go func(i int, s namedSink) {
+			defer wg.Done()
+			if errs[i] = report(s.api); errs[i] != nil {
+				m.logger.Err(errs[i], "sink failed to report", append([]interface{}{"sink", s.name}, keysAndValues...)...)
+			}
+		}(i, s)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	if failed > 0 && failed == len(m.sinks) {
+		return fmt.Errorf("all %d sinks failed to report: %w", failed, errs[0])
+	}
+	return nil
+}
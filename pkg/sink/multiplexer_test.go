@@ -0,0 +1,70 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// recordingAPI records the workflow statuses it is given, or fails with err
+type recordingAPI struct {
+	mu       sync.Mutex
+	err      error
+	statuses []reporter.WorkflowStatus
+}
+
+func (r *recordingAPI) ReportWorkflowStaus(_ context.Context, _ string, status reporter.WorkflowStatus, _ error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		return r.err
+	}
+	r.statuses = append(r.statuses, status)
+	return nil
+}
+
+func (r *recordingAPI) ReportWorkflowStepStaus(context.Context, string, reporter.WorkflowStep) error {
+	return r.err
+}
+
+func (r *recordingAPI) ReportWorkflowVariables(context.Context, string, []reporter.Variable) error {
+	return r.err
+}
+
+func TestMultiplexerFailsOnlyWhenEverySinkFailed(t *testing.T) {
+	ctx := context.Background()
+	ok, failing := &recordingAPI{}, &recordingAPI{err: errors.New("down")}
+	mux := NewMultiplexer(logger.New(logger.Options{}))
+	mux.Add("ok", ok)
+	mux.Add("failing", failing)
+
+	if err := mux.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatalf("expected a partial failure to be left to the failing sink, got %v", err)
+	}
+	if len(ok.statuses) != 1 {
+		t.Errorf("expected the working sink to get the report, got %v", ok.statuses)
+	}
+
+	ok.err = errors.New("down too")
+	if err := mux.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err == nil {
+		t.Error("expected the report to fail once every sink failed")
+	}
+}
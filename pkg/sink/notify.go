@@ -0,0 +1,184 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// DefaultNotificationTemplate renders notifications when no template is configured
+const DefaultNotificationTemplate = `{{ if eq .Event.Kind "workflow" }}Workflow {{ .Run.Name }}{{ else }}Step {{ .Event.Step }} of {{ .Run.Name }}{{ end }} {{ .Event.Status }}{{ with .Event.Err }}: {{ . }}{{ end }}{{ with .URL }} {{ . }}{{ end }}`
+
+type (
+	// Run describes the run of a workflow, for the sinks that tell people about it
+	Run struct {
+		Name      string
+		Namespace string
+		// Pipeline is the name of what the run executes, shared by its runs
+		Pipeline string
+	}
+
+	// Runs maps workflows to their runs
+	Runs struct {
+		registry
+	}
+
+	// NotificationOptions are shared by the sinks that notify people through chat
+	NotificationOptions struct {
+		// Template renders the text of the notification, DefaultNotificationTemplate when empty.
+		// It is executed with a Notification
+		Template string
+		// OnlyFailures notifies only about the workflows and steps that failed
+		OnlyFailures bool
+		// Pipelines are the glob patterns of the pipelines to notify about, every pipeline when empty
+		Pipelines []string
+		// TargetURL links the notifications to the workflow, {workflow} is replaced with the workflow ID
+		TargetURL  string
+		HTTPClient *http.Client
+	}
+
+	// Notification is what the template of a notification is rendered with
+	Notification struct {
+		Event *Event
+		Run   Run
+		URL   string
+	}
+
+	// notifier implements reporter.CodefreshAPI for the sinks that notify people about the start
+	// and the end of workflows, and about the steps that failed
+	notifier struct {
+		runs     *Runs
+		options  NotificationOptions
+		template *template.Template
+		post     func(ctx context.Context, n *Notification, text string) error
+	}
+)
+
+// NewRuns builds Runs that keep forgotten workflows for ttl
+func NewRuns(ttl time.Duration) *Runs {
+	return &Runs{registry: newRegistry(ttl)}
+}
+
+// Set sets the run of a workflow
+func (r *Runs) Set(workflow string, run Run) {
+	r.set(workflow, run)
+}
+
+// Get returns the run of a workflow, if it is known
+func (r *Runs) Get(workflow string) (Run, bool) {
+	v, ok := r.get(workflow)
+	if !ok {
+		return Run{}, false
+	}
+	return v.(Run), true
+}
+
+func newNotifier(runs *Runs, options NotificationOptions) (notifier, error) {
+	text := options.Template
+	if text == "" {
+		text = DefaultNotificationTemplate
+	}
+	tmpl, err := template.New("notification").Funcs(template.FuncMap{"json": toJSON}).Parse(text)
+	if err != nil {
+		return notifier{}, fmt.Errorf("invalid notification template: %w", err)
+	}
+	for _, pattern := range options.Pipelines {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return notifier{}, fmt.Errorf("invalid pipeline pattern %q: %w", pattern, err)
+		}
+	}
+	return notifier{
+		runs:     runs,
+		options:  options,
+		template: tmpl,
+	}, nil
+}
+
+func (n *notifier) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	if status != reporter.WorkflowRunning && !status.IsFinal() {
+		return nil
+	}
+	if n.options.OnlyFailures && !status.IsFailure() {
+		return nil
+	}
+	return n.notify(ctx, NewWorkflowEvent(workflow, status, err))
+}
+
+func (n *notifier) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	if !step.Status.IsFailure() {
+		return nil
+	}
+	return n.notify(ctx, NewStepEvent(workflow, step))
+}
+
+// ReportWorkflowVariables does nothing, variables are not worth a notification
+func (n *notifier) ReportWorkflowVariables(context.Context, string, []reporter.Variable) error {
+	return nil
+}
+
+func (n *notifier) notify(ctx context.Context, ev *Event) error {
+	run, ok := n.runs.Get(ev.Workflow)
+	if !ok {
+		return reporter.Permanent(fmt.Errorf("the run of workflow %s is unknown", ev.Workflow))
+	}
+	if !n.selects(run.Pipeline) {
+		return nil
+	}
+	notification := &Notification{
+		Event: ev,
+		Run:   run,
+		URL:   strings.ReplaceAll(n.options.TargetURL, "{workflow}", ev.Workflow),
+	}
+	var buf bytes.Buffer
+	if err := n.template.Execute(&buf, notification); err != nil {
+		// rendering the same notification again fails the same way
+		return reporter.Permanent(fmt.Errorf("failed to render notification template: %w", err))
+	}
+	return n.post(ctx, notification, buf.String())
+}
+
+func (n *notifier) selects(pipeline string) bool {
+	if len(n.options.Pipelines) == 0 {
+		return true
+	}
+	for _, pattern := range n.options.Pipelines {
+		if ok, _ := path.Match(pattern, pipeline); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isFailure tells if a notification is about a workflow or step that failed
+func (n *Notification) isFailure() bool {
+	if n.Event.Kind == KindStep {
+		return reporter.WorkflowStepStatus(n.Event.Status).IsFailure()
+	}
+	return reporter.WorkflowStatus(n.Event.Status).IsFailure()
+}
+
+// isFinal tells if a notification is about the end of a workflow
+func (n *Notification) isFinal() bool {
+	return n.Event.Kind == KindWorkflow && reporter.WorkflowStatus(n.Event.Status).IsFinal()
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"sync"
+	"time"
+)
+
+// registry maps workflows to what sinks need to know about them, beyond their reports.
+// Forgotten workflows are kept for a while, so the reports that are still on their way can be delivered
+type registry struct {
+	mu        sync.RWMutex
+	ttl       time.Duration
+	values    map[string]interface{}
+	forgotten map[string]time.Time
+}
+
+func newRegistry(ttl time.Duration) registry {
+	return registry{
+		ttl:       ttl,
+		values:    map[string]interface{}{},
+		forgotten: map[string]time.Time{},
+	}
+}
+
+func (r *registry) set(workflow string, v interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+	r.values[workflow] = v
+	delete(r.forgotten, workflow)
+}
+
+func (r *registry) get(workflow string) (interface{}, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.values[workflow]
+	return v, ok
+}
+
+// update replaces the value of a workflow with the one returned by f, given its current value if any.
+// Unlike set, it does not keep a forgotten workflow from being dropped
+func (r *registry) update(workflow string, f func(v interface{}, ok bool) interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.purge()
+	v, ok := r.values[workflow]
+	r.values[workflow] = f(v, ok)
+}
+
+// Forget drops what is known about a workflow once the ttl passed
+func (r *registry) Forget(workflow string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.values[workflow]; ok {
+		r.forgotten[workflow] = time.Now()
+	}
+}
+
+// remove drops what is known about a workflow at once
+func (r *registry) remove(workflow string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.values, workflow)
+	delete(r.forgotten, workflow)
+}
+
+func (r *registry) purge() {
+	for workflow, at := range r.forgotten {
+		if time.Since(at) > r.ttl {
+			delete(r.values, workflow)
+			delete(r.forgotten, workflow)
+		}
+	}
+}
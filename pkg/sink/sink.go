@@ -0,0 +1,90 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sink holds the destinations workflow reports can be sent to besides Codefresh.
+// Every sink implements reporter.CodefreshAPI, so sinks can be combined and decorated
+// like any other destination
+package sink
+
+import (
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// Kinds of events
+const (
+	KindWorkflow  = "workflow"
+	KindStep      = "step"
+	KindVariables = "variables"
+)
+
+// Event is a single report, as sinks that serialize reports send it
+type Event struct {
+	Time     time.Time `json:"time"`
+	Kind     string    `json:"kind"`
+	Workflow string    `json:"workflow"`
+	Step     string    `json:"step,omitempty"`
+	Status   string    `json:"status,omitempty"`
+	Err      string    `json:"error,omitempty"`
+	// steps only
+	ExitCode    *int32                `json:"exitCode,omitempty"`
+	StartedAt   *time.Time            `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time            `json:"finishedAt,omitempty"`
+	Duration    int64                 `json:"duration,omitempty"`
+	Group       string                `json:"group,omitempty"`
+	Diagnostics *reporter.Diagnostics `json:"diagnostics,omitempty"`
+	// step results, or the variables of the workflow
+	Variables []reporter.Variable `json:"variables,omitempty"`
+}
+
+// NewWorkflowEvent builds the event of a workflow status report
+func NewWorkflowEvent(workflow string, status reporter.WorkflowStatus, err error) *Event {
+	return &Event{
+		Time:     time.Now().UTC(),
+		Kind:     KindWorkflow,
+		Workflow: workflow,
+		Status:   string(status),
+		Err:      reporter.ErrString(err),
+	}
+}
+
+// NewStepEvent builds the event of a step status report
+func NewStepEvent(workflow string, step reporter.WorkflowStep) *Event {
+	return &Event{
+		Time:        time.Now().UTC(),
+		Kind:        KindStep,
+		Workflow:    workflow,
+		Step:        step.Name,
+		Status:      string(step.Status),
+		Err:         reporter.ErrString(step.Err),
+		ExitCode:    step.ExitCode,
+		StartedAt:   reporter.TimePtr(step.StartedAt),
+		FinishedAt:  reporter.TimePtr(step.FinishedAt),
+		Duration:    step.Duration().Milliseconds(),
+		Group:       step.Group,
+		Diagnostics: step.Diagnostics,
+		Variables:   step.Results,
+	}
+}
+
+// NewVariablesEvent builds the event of a workflow variables report
+func NewVariablesEvent(workflow string, variables []reporter.Variable) *Event {
+	return &Event{
+		Time:      time.Now().UTC(),
+		Kind:      KindVariables,
+		Workflow:  workflow,
+		Variables: variables,
+	}
+}
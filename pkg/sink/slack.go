@@ -0,0 +1,189 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultSlackURL is the URL of the Slack Web API
+const DefaultSlackURL = "https://slack.com/api"
+
+type (
+	// Slack implements reporter.CodefreshAPI by posting notifications to Slack.
+	// With a bot token, the first notification of a workflow starts a thread that the next ones
+	// reply to, and the end of the workflow also updates that first message. Incoming webhooks
+	// can neither thread nor update messages, so each notification is a message of its own
+	Slack struct {
+		notifier
+		options SlackOptions
+		threads *SlackThreads
+	}
+
+	// SlackThreads maps workflows to the messages that started their threads
+	SlackThreads struct {
+		registry
+	}
+
+	// SlackOptions to build new Slack, which needs either a WebhookURL or a Token and a Channel
+	SlackOptions struct {
+		NotificationOptions
+		// WebhookURL of an incoming webhook
+		WebhookURL string
+		// Token of a bot allowed to post to Channel, which takes precedence over WebhookURL
+		Token   string
+		Channel string
+		// URL of the Slack Web API, DefaultSlackURL when empty
+		URL string
+	}
+
+	slackMessage struct {
+		Channel  string `json:"channel,omitempty"`
+		Text     string `json:"text"`
+		ThreadTS string `json:"thread_ts,omitempty"`
+		TS       string `json:"ts,omitempty"`
+	}
+
+	slackResponse struct {
+		OK      bool   `json:"ok"`
+		Error   string `json:"error,omitempty"`
+		Channel string `json:"channel,omitempty"`
+		TS      string `json:"ts,omitempty"`
+	}
+
+	slackThread struct {
+		channel string
+		ts      string
+		// ended is set once the end of the workflow was replied to the thread
+		ended bool
+	}
+)
+
+// NewSlackThreads builds SlackThreads that keep forgotten workflows for ttl
+func NewSlackThreads(ttl time.Duration) *SlackThreads {
+	return &SlackThreads{registry: newRegistry(ttl)}
+}
+
+func (t *SlackThreads) get(workflow string) (slackThread, bool) {
+	v, ok := t.registry.get(workflow)
+	if !ok {
+		return slackThread{}, false
+	}
+	return v.(slackThread), true
+}
+
+// set sets the thread of a workflow, without keeping a forgotten workflow from being dropped
+func (t *SlackThreads) set(workflow string, thread slackThread) {
+	t.update(workflow, func(interface{}, bool) interface{} {
+		return thread
+	})
+}
+
+// NewSlack builds a Slack sink that finds the run of each workflow in runs, and keeps its threads in threads
+func NewSlack(runs *Runs, threads *SlackThreads, options SlackOptions) (*Slack, error) {
+	if options.Token == "" && options.WebhookURL == "" {
+		return nil, fmt.Errorf("slack notifications require a webhook URL, or a token and a channel")
+	}
+	if options.Token != "" && options.Channel == "" {
+		return nil, fmt.Errorf("slack notifications with a token require a channel")
+	}
+	if options.URL == "" {
+		options.URL = DefaultSlackURL
+	}
+	options.URL = strings.TrimRight(options.URL, "/")
+	n, err := newNotifier(runs, options.NotificationOptions)
+	if err != nil {
+		return nil, err
+	}
+	s := &Slack{
+		notifier: n,
+		options:  options,
+		threads:  threads,
+	}
+	s.post = s.postWebhook
+	if options.Token != "" {
+		s.post = s.postThreaded
+	}
+	return s, nil
+}
+
+func (s *Slack) postWebhook(ctx context.Context, _ *Notification, text string) error {
+	data, err := json.Marshal(slackMessage{Text: text})
+	if err != nil {
+		return err
+	}
+	_, err = send(ctx, s.options.HTTPClient, http.MethodPost, s.options.WebhookURL, data, nil)
+	return err
+}
+
+// postThreaded starts the thread of a workflow, or replies to it. The end of the workflow
+// also updates the message that started the thread, and ends it once that update went through
+func (s *Slack) postThreaded(ctx context.Context, n *Notification, text string) error {
+	thread, ok := s.threads.get(n.Event.Workflow)
+	if !ok {
+		resp, err := s.call(ctx, "chat.postMessage", slackMessage{Channel: s.options.Channel, Text: text})
+		if err != nil {
+			return err
+		}
+		if !n.isFinal() {
+			s.threads.set(n.Event.Workflow, slackThread{channel: resp.Channel, ts: resp.TS})
+		}
+		return nil
+	}
+	// a retry of the end of the workflow whose reply went through only updates the first message
+	if !thread.ended {
+		if _, err := s.call(ctx, "chat.postMessage", slackMessage{Channel: thread.channel, Text: text, ThreadTS: thread.ts}); err != nil {
+			return err
+		}
+	}
+	if !n.isFinal() {
+		return nil
+	}
+	thread.ended = true
+	s.threads.set(n.Event.Workflow, thread)
+	if _, err := s.call(ctx, "chat.update", slackMessage{Channel: thread.channel, Text: text, TS: thread.ts}); err != nil {
+		return err
+	}
+	s.threads.remove(n.Event.Workflow)
+	return nil
+}
+
+// call calls a method of the Slack Web API, which reports failures in the response rather than its status
+func (s *Slack) call(ctx context.Context, method string, msg slackMessage) (*slackResponse, error) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	headers := http.Header{}
+	headers.Set("Content-Type", "application/json; charset=utf-8")
+	headers.Set("Authorization", "Bearer "+s.options.Token)
+	body, err := send(ctx, s.options.HTTPClient, http.MethodPost, fmt.Sprintf("%s/%s", s.options.URL, method), data, headers)
+	if err != nil {
+		return nil, err
+	}
+	resp := &slackResponse{}
+	if err := json.Unmarshal(body, resp); err != nil {
+		return nil, fmt.Errorf("failed to read slack response: %w", err)
+	}
+	if !resp.OK {
+		return nil, fmt.Errorf("slack %s failed: %s", method, resp.Error)
+	}
+	return resp, nil
+}
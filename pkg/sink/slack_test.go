@@ -0,0 +1,161 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// slackRecorder stands in for the Slack Web API, recording the methods it is called with.
+// The methods in fail fail once
+type slackRecorder struct {
+	mu    sync.Mutex
+	calls []string
+	fail  map[string]bool
+}
+
+func (s *slackRecorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	msg := slackMessage{}
+	if err := json.NewDecoder(req.Body).Decode(&msg); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	method := strings.TrimPrefix(req.URL.Path, "/")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[method] {
+		delete(s.fail, method)
+		_ = json.NewEncoder(w).Encode(slackResponse{Error: "ratelimited"})
+		return
+	}
+	call := method + " " + msg.Text
+	if msg.ThreadTS != "" {
+		call += " in " + msg.ThreadTS
+	}
+	if msg.TS != "" {
+		call += " of " + msg.TS
+	}
+	s.calls = append(s.calls, call)
+	_ = json.NewEncoder(w).Encode(slackResponse{OK: true, Channel: "C1", TS: "1.0"})
+}
+
+func newTestSlack(t *testing.T, api *slackRecorder) *Slack {
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	runs := NewRuns(time.Minute)
+	runs.Set("wf", Run{Name: "run", Pipeline: "pipeline"})
+	s, err := NewSlack(runs, NewSlackThreads(time.Minute), SlackOptions{
+		NotificationOptions: NotificationOptions{
+			Template:   "{{ .Event.Step }}{{ .Event.Status }}",
+			HTTPClient: srv.Client(),
+		},
+		Token:   "bot-token",
+		Channel: "builds",
+		URL:     srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestSlackThreadsTheNotificationsOfAWorkflow(t *testing.T) {
+	ctx := context.Background()
+	api := &slackRecorder{}
+	s := newTestSlack(t, api)
+
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	step := reporter.WorkflowStep{Name: "build:", Status: reporter.WorkflowStepFailed}
+	if err := s.ReportWorkflowStepStaus(ctx, "wf", step); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowFailed, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"chat.postMessage running",
+		"chat.postMessage build:error in 1.0",
+		"chat.postMessage error in 1.0",
+		"chat.update error of 1.0",
+	}
+	if !reflect.DeepEqual(api.calls, want) {
+		t.Errorf("expected %v, got %v", want, api.calls)
+	}
+	if thread, ok := s.threads.get("wf"); ok {
+		t.Errorf("expected the thread to end with the workflow, got %+v", thread)
+	}
+}
+
+func TestSlackDropsTheThreadsOfForgottenWorkflows(t *testing.T) {
+	ctx := context.Background()
+	api := &slackRecorder{}
+	s := newTestSlack(t, api)
+	s.threads = NewSlackThreads(time.Nanosecond)
+	s.runs.Set("other", Run{Name: "other", Pipeline: "pipeline"})
+
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	s.threads.Forget("wf")
+	time.Sleep(time.Millisecond)
+	if err := s.ReportWorkflowStaus(ctx, "other", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if thread, ok := s.threads.get("wf"); ok {
+		t.Errorf("expected the thread of the forgotten workflow to be dropped, got %+v", thread)
+	}
+	if _, ok := s.threads.get("other"); !ok {
+		t.Error("expected the thread of the other workflow to be kept")
+	}
+}
+
+func TestSlackRetriesOnlyTheFailedUpdate(t *testing.T) {
+	ctx := context.Background()
+	api := &slackRecorder{fail: map[string]bool{"chat.update": true}}
+	s := newTestSlack(t, api)
+
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowRunning, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err == nil {
+		t.Fatal("expected the failed update to fail the notification")
+	}
+	if err := s.ReportWorkflowStaus(ctx, "wf", reporter.WorkflowSucceded, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"chat.postMessage running",
+		"chat.postMessage success in 1.0",
+		"chat.update success of 1.0",
+	}
+	if !reflect.DeepEqual(api.calls, want) {
+		t.Errorf("expected %v, got %v", want, api.calls)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// Colors of Teams messages
+const (
+	teamsColorRunning = "0076D7"
+	teamsColorSuccess = "2EB886"
+	teamsColorFailure = "D63333"
+)
+
+type (
+	// Teams implements reporter.CodefreshAPI by posting notifications to a Microsoft Teams channel
+	// through an incoming webhook. Incoming webhooks can neither thread nor update messages,
+	// so each notification is a message of its own, colored by the outcome it tells about
+	Teams struct {
+		notifier
+		webhookURL string
+	}
+
+	// TeamsOptions to build new Teams
+	TeamsOptions struct {
+		NotificationOptions
+		// WebhookURL of the incoming webhook of the channel
+		WebhookURL string
+	}
+
+	teamsMessageCard struct {
+		Type       string `json:"@type"`
+		Context    string `json:"@context"`
+		Summary    string `json:"summary"`
+		ThemeColor string `json:"themeColor"`
+		Text       string `json:"text"`
+	}
+)
+
+// NewTeams builds a Teams sink that finds the run of each workflow in runs
+func NewTeams(runs *Runs, options TeamsOptions) (*Teams, error) {
+	if options.WebhookURL == "" {
+		return nil, fmt.Errorf("teams notifications require a webhook URL")
+	}
+	n, err := newNotifier(runs, options.NotificationOptions)
+	if err != nil {
+		return nil, err
+	}
+	t := &Teams{
+		notifier:   n,
+		webhookURL: options.WebhookURL,
+	}
+	t.post = t.postCard
+	return t, nil
+}
+
+func (t *Teams) postCard(ctx context.Context, n *Notification, text string) error {
+	color := teamsColorRunning
+	switch {
+	case n.isFailure():
+		color = teamsColorFailure
+	case n.isFinal():
+		color = teamsColorSuccess
+	}
+	data, err := json.Marshal(teamsMessageCard{
+		Type:       "MessageCard",
+		Context:    "https://schema.org/extensions",
+		Summary:    fmt.Sprintf("%s %s", n.Run.Name, n.Event.Status),
+		ThemeColor: color,
+		Text:       text,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = send(ctx, t.options.HTTPClient, http.MethodPost, t.webhookURL, data, nil)
+	return err
+}
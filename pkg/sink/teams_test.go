@@ -0,0 +1,81 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+func TestTeamsPostsACardPerSelectedNotification(t *testing.T) {
+	ctx := context.Background()
+	api := &apiRecorder{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+	runs := NewRuns(time.Minute)
+	teams, err := NewTeams(runs, TeamsOptions{
+		NotificationOptions: NotificationOptions{
+			OnlyFailures: true,
+			Pipelines:    []string{"deploy-*"},
+			HTTPClient:   srv.Client(),
+		},
+		WebhookURL: srv.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runs.Set("wf", Run{Name: "deploy-prod-1", Pipeline: "deploy-prod"})
+	runs.Set("other", Run{Name: "build-1", Pipeline: "build"})
+	for _, workflow := range []string{"wf", "other"} {
+		for _, status := range []reporter.WorkflowStatus{reporter.WorkflowRunning, reporter.WorkflowFailed} {
+			if err := teams.ReportWorkflowStaus(ctx, workflow, status, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := teams.ReportWorkflowStaus(ctx, "unknown", reporter.WorkflowFailed, nil); !reporter.IsPermanent(err) {
+		t.Fatalf("expected the notification of an unknown workflow to fail for good, got %v", err)
+	}
+
+	requests := api.received()
+	if len(requests) != 1 {
+		t.Fatalf("expected only the failure of the selected pipeline, got %+v", requests)
+	}
+	card := requests[0].body
+	if card["themeColor"] != teamsColorFailure || card["text"] != "Workflow deploy-prod-1 error" {
+		t.Errorf("unexpected card %v", card)
+	}
+}
+
+func TestNotificationTemplateFailuresAreNotRetried(t *testing.T) {
+	runs := NewRuns(time.Minute)
+	runs.Set("wf", Run{Name: "run", Pipeline: "pipeline"})
+	teams, err := NewTeams(runs, TeamsOptions{
+		NotificationOptions: NotificationOptions{Template: "{{ .Missing }}"},
+		WebhookURL:          "http://localhost",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := teams.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); !reporter.IsPermanent(err) {
+		t.Errorf("expected a template that fails to render to fail for good, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// SignatureHeader holds the HMAC-SHA256 of the body of webhook requests, as "sha256=<hex>"
+const SignatureHeader = "X-Signature-256"
+
+type (
+	// Webhook implements reporter.CodefreshAPI by posting every report to a URL
+	Webhook struct {
+		url      string
+		template *template.Template
+		headers  http.Header
+		secret   []byte
+		client   *http.Client
+	}
+
+	// WebhookOptions to build new Webhook
+	WebhookOptions struct {
+		// Template renders the body from the Event of each report, which is sent as JSON when empty.
+		// Besides the builtin functions, json renders a value as JSON
+		Template string
+		// Headers are added to every request
+		Headers http.Header
+		// Secret signs the body of every request in SignatureHeader, unsigned when empty
+		Secret     string
+		HTTPClient *http.Client
+	}
+)
+
+// NewWebhook builds a Webhook that posts to url
+func NewWebhook(url string, options WebhookOptions) (*Webhook, error) {
+	w := &Webhook{
+		url:     url,
+		headers: options.Headers,
+		secret:  []byte(options.Secret),
+		client:  options.HTTPClient,
+	}
+	if options.Template != "" {
+		tmpl, err := template.New("webhook").Funcs(template.FuncMap{"json": toJSON}).Parse(options.Template)
+		if err != nil {
+			return nil, fmt.Errorf("invalid webhook template: %w", err)
+		}
+		w.template = tmpl
+	}
+	return w, nil
+}
+
+func (w *Webhook) ReportWorkflowStaus(ctx context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return w.post(ctx, NewWorkflowEvent(workflow, status, err))
+}
+
+func (w *Webhook) ReportWorkflowStepStaus(ctx context.Context, workflow string, step reporter.WorkflowStep) error {
+	return w.post(ctx, NewStepEvent(workflow, step))
+}
+
+func (w *Webhook) ReportWorkflowVariables(ctx context.Context, workflow string, variables []reporter.Variable) error {
+	return w.post(ctx, NewVariablesEvent(workflow, variables))
+}
+
+func (w *Webhook) post(ctx context.Context, ev *Event) error {
+	body, err := w.render(ev)
+	if err != nil {
+		// rendering the same event again fails the same way
+		return reporter.Permanent(err)
+	}
+	headers := w.headers.Clone()
+	if len(w.secret) > 0 {
+		if headers == nil {
+			headers = http.Header{}
+		}
+		headers.Set(SignatureHeader, Sign(w.secret, body))
+	}
+	_, err = send(ctx, w.client, http.MethodPost, w.url, body, headers)
+	return err
+}
+
+func (w *Webhook) render(ev *Event) ([]byte, error) {
+	if w.template == nil {
+		return json.Marshal(ev)
+	}
+	var buf bytes.Buffer
+	if err := w.template.Execute(&buf, ev); err != nil {
+		return nil, fmt.Errorf("failed to render webhook template: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// Sign returns the signature of body with secret, as sent in SignatureHeader
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
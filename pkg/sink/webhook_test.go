@@ -0,0 +1,100 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// webhookRecorder stands in for a webhook receiver, keeping the last request it got
+type webhookRecorder struct {
+	body    []byte
+	headers http.Header
+}
+
+func (w *webhookRecorder) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	w.body, _ = ioutil.ReadAll(req.Body)
+	w.headers = req.Header.Clone()
+}
+
+func newTestWebhook(t *testing.T, rec *webhookRecorder, options WebhookOptions) *Webhook {
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	options.HTTPClient = srv.Client()
+	w, err := NewWebhook(srv.URL, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebhookSignsTheBody(t *testing.T) {
+	rec := &webhookRecorder{}
+	w := newTestWebhook(t, rec, WebhookOptions{
+		Secret:  "secret",
+		Headers: http.Header{"X-Source": []string{"codefresh"}},
+	})
+
+	if err := w.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowFailed, errors.New("boom")); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := rec.headers.Get(SignatureHeader), Sign([]byte("secret"), rec.body); got != want {
+		t.Errorf("expected signature %q, got %q", want, got)
+	}
+	if got := rec.headers.Get("X-Source"); got != "codefresh" {
+		t.Errorf("expected the configured headers to be sent, got %q", got)
+	}
+	if w.headers.Get(SignatureHeader) != "" {
+		t.Error("expected the configured headers not to keep the signature")
+	}
+}
+
+func TestWebhookRendersTheTemplate(t *testing.T) {
+	rec := &webhookRecorder{}
+	w := newTestWebhook(t, rec, WebhookOptions{
+		Template: `{"text": {{ printf "%s %s: %s" .Workflow .Step .Status | json }}}`,
+	})
+
+	step := reporter.WorkflowStep{Name: "build", Status: reporter.WorkflowStepSucceded}
+	if err := w.ReportWorkflowStepStaus(context.Background(), "wf", step); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := string(rec.body), `{"text": "wf build: success"}`; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if rec.headers.Get(SignatureHeader) != "" {
+		t.Error("expected an unsigned request without a secret")
+	}
+}
+
+func TestWebhookTemplateFailuresAreNotRetried(t *testing.T) {
+	w := newTestWebhook(t, &webhookRecorder{}, WebhookOptions{Template: "{{ .Missing }}"})
+	if err := w.ReportWorkflowStaus(context.Background(), "wf", reporter.WorkflowRunning, nil); !reporter.IsPermanent(err) {
+		t.Errorf("expected a template that fails to render to fail for good, got %v", err)
+	}
+}
+
+func TestWebhookRejectsInvalidTemplates(t *testing.T) {
+	if _, err := NewWebhook("http://localhost", WebhookOptions{Template: "{{ .Workflow"}); err == nil {
+		t.Error("expected an invalid template to be rejected")
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Codefresh Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sink
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+)
+
+// Writer implements reporter.CodefreshAPI by writing every report to an io.Writer,
+// as a line of JSON
+type Writer struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+// NewWriter builds a Writer that writes to w
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// OpenFile builds a Writer that appends to the file at path, creating it if needed
+func OpenFile(path string) (*Writer, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sink file: %w", err)
+	}
+	return &Writer{w: f, closer: f}, nil
+}
+
+// Close closes the file the Writer was opened with, if any
+func (s *Writer) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closer == nil {
+		return nil
+	}
+	return s.closer.Close()
+}
+
+func (s *Writer) ReportWorkflowStaus(_ context.Context, workflow string, status reporter.WorkflowStatus, err error) error {
+	return s.write(NewWorkflowEvent(workflow, status, err))
+}
+
+func (s *Writer) ReportWorkflowStepStaus(_ context.Context, workflow string, step reporter.WorkflowStep) error {
+	return s.write(NewStepEvent(workflow, step))
+}
+
+func (s *Writer) ReportWorkflowVariables(_ context.Context, workflow string, variables []reporter.Variable) error {
+	return s.write(NewVariablesEvent(workflow, variables))
+}
+
+func (s *Writer) write(ev *Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,136 @@
+package tekton
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// ApprovalTasksAnnotation lists the comma separated names of the pipeline tasks of
+	// a PipelineRun that wait for an approval
+	ApprovalTasksAnnotation = "codefresh.io/approval-tasks"
+	// approvalDecisionAnnotationPrefix is followed by the name of an approval task, and holds its decision
+	approvalDecisionAnnotationPrefix = "codefresh.io/approval-"
+	// approvalTaskHashLength is the length of the hash that stands for a task whose name does not fit an annotation key
+	approvalTaskHashLength = 16
+
+	// ApprovalDecisionKey is the key of the decision in the ConfigMap an approval task waits on
+	ApprovalDecisionKey = "decision"
+
+	approvalApproved = "approved"
+	approvalDenied   = "denied"
+)
+
+// ApprovalConfigMapName is the name of the ConfigMap an approval task waits on. Its decision
+// key is set to "approved" or "denied" once the decision was made
+func ApprovalConfigMapName(pipelineRun, task string) string {
+	return fmt.Sprintf("%s-%s-approval", pipelineRun, task)
+}
+
+// IsApprovalTask tells if a pipeline task of the PipelineRun waits for an approval
+func IsApprovalTask(pr *v1beta1.PipelineRun, task string) bool {
+	for _, t := range strings.Split(pr.Annotations[ApprovalTasksAnnotation], ",") {
+		if strings.TrimSpace(t) == task {
+			return true
+		}
+	}
+	return false
+}
+
+// approvalDecisionAnnotation returns the annotation holding the decision about an approval task.
+// A task whose name does not make a valid annotation key is known by a hash of its name
+func approvalDecisionAnnotation(task string) string {
+	if key := approvalDecisionAnnotationPrefix + task; len(validation.IsQualifiedName(key)) == 0 {
+		return key
+	}
+	sum := sha256.Sum256([]byte(task))
+	return approvalDecisionAnnotationPrefix + hex.EncodeToString(sum[:])[:approvalTaskHashLength]
+}
+
+// getApprovalStep translates the state of an approval task, which waits for approval
+// while it runs without a decision, and is denied once it finished after a denial
+func getApprovalStep(pr *v1beta1.PipelineRun, trs *v1alpha1.PipelineRunTaskRunStatus, step *reporter.WorkflowStep) *reporter.WorkflowStep {
+	step.Name = trs.PipelineTaskName
+	decision := pr.Annotations[approvalDecisionAnnotation(trs.PipelineTaskName)]
+	switch {
+	case step.Status == reporter.WorkflowStepRunning && decision == "":
+		step.Status = reporter.WorkflowStepPendingApproval
+	case step.Status.IsFinal() && decision == approvalDenied:
+		step.Status = reporter.WorkflowStepDenied
+		step.Err = fmt.Errorf("approval was denied")
+	}
+	return step
+}
+
+// Resolve records the decision about an approval task in the ConfigMap the task waits on,
+// and on the PipelineRun so the outcome can be reported
+func (e *Engine) Resolve(ctx context.Context, run *engine.Run, step string, approved bool) error {
+	decision := approvalDenied
+	if approved {
+		decision = approvalApproved
+	}
+	if err := e.applyApprovalConfigMap(ctx, run, step, decision); err != nil {
+		return fmt.Errorf("failed to record approval decision: %w", err)
+	}
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				approvalDecisionAnnotation(step): decision,
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.client.TektonV1beta1().PipelineRuns(run.Namespace).Patch(ctx, run.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (e *Engine) applyApprovalConfigMap(ctx context.Context, run *engine.Run, task, decision string) error {
+	name := ApprovalConfigMapName(run.Name, task)
+	configMaps := e.kubeClient.CoreV1().ConfigMaps(run.Namespace)
+	cm, err := configMaps.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		isController := true
+		_, err = configMaps.Create(ctx, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: run.Namespace,
+				// deleted with the PipelineRun
+				OwnerReferences: []metav1.OwnerReference{{
+					APIVersion: v1beta1.SchemeGroupVersion.String(),
+					Kind:       "PipelineRun",
+					Name:       run.Name,
+					UID:        run.UID,
+					Controller: &isController,
+				}},
+			},
+			Data: map[string]string{ApprovalDecisionKey: decision},
+		}, metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if cm.Data == nil {
+		cm.Data = map[string]string{}
+	}
+	cm.Data[ApprovalDecisionKey] = decision
+	_, err = configMaps.Update(ctx, cm, metav1.UpdateOptions{})
+	return err
+}
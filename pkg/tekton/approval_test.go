@@ -0,0 +1,117 @@
+package tekton
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+)
+
+func TestApprovalDecisionAnnotationIsAlwaysValid(t *testing.T) {
+	if got := approvalDecisionAnnotation("deploy"); got != "codefresh.io/approval-deploy" {
+		t.Errorf("annotation of a plain task is %q", got)
+	}
+	long := strings.Repeat("a", 60)
+	for _, task := range []string{long, "deploy to prod", "deploy/prod", "-deploy"} {
+		got := approvalDecisionAnnotation(task)
+		if errs := validation.IsQualifiedName(got); len(errs) != 0 {
+			t.Errorf("annotation of %q is %q: %v", task, got, errs)
+		}
+		if got != approvalDecisionAnnotation(task) {
+			t.Errorf("annotation of %q changes", task)
+		}
+	}
+	if approvalDecisionAnnotation(long) == approvalDecisionAnnotation(long+"b") {
+		t.Error("two tasks share an annotation")
+	}
+}
+
+func approvalPipelineRun(task string) *v1beta1.PipelineRun {
+	pr := testPipelineRun(corev1.ConditionUnknown, startedTask(task, 0, corev1.ConditionUnknown))
+	pr.UID = "uid-run"
+	pr.Annotations = map[string]string{ApprovalTasksAnnotation: task}
+	return pr
+}
+
+func resolveApproval(t *testing.T, pr *v1beta1.PipelineRun, task string, approved bool, objects ...*corev1.ConfigMap) (*v1beta1.PipelineRun, *corev1.ConfigMap) {
+	client := fake.NewSimpleClientset(pr)
+	kubeClient := kubefake.NewSimpleClientset()
+	ctx := context.Background()
+	for _, cm := range objects {
+		if _, err := kubeClient.CoreV1().ConfigMaps(cm.Namespace).Create(ctx, cm, metav1.CreateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	e := &Engine{client: client, kubeClient: kubeClient}
+
+	if err := e.Resolve(ctx, newRun(pr), task, approved); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.TektonV1beta1().PipelineRuns("ns").Get(ctx, "run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cm, err := kubeClient.CoreV1().ConfigMaps("ns").Get(ctx, ApprovalConfigMapName("run", task), metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return got, cm
+}
+
+func TestResolveCreatesTheConfigMapOfTheTask(t *testing.T) {
+	pr, cm := resolveApproval(t, approvalPipelineRun("deploy"), "deploy", true)
+
+	if cm.Data[ApprovalDecisionKey] != "approved" {
+		t.Errorf("config map holds %v", cm.Data)
+	}
+	if owner := metav1.GetControllerOf(cm); owner == nil || owner.Kind != "PipelineRun" || owner.UID != "uid-run" {
+		t.Errorf("config map is owned by %+v", cm.OwnerReferences)
+	}
+	if pr.Annotations["codefresh.io/approval-deploy"] != "approved" {
+		t.Errorf("pipelinerun is annotated with %v", pr.Annotations)
+	}
+}
+
+func TestResolveUpdatesTheConfigMapOfTheTask(t *testing.T) {
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: ApprovalConfigMapName("run", "deploy"), Namespace: "ns"},
+		Data:       map[string]string{"other": "value"},
+	}
+	_, cm := resolveApproval(t, approvalPipelineRun("deploy"), "deploy", false, existing)
+
+	if cm.Data[ApprovalDecisionKey] != "denied" || cm.Data["other"] != "value" {
+		t.Errorf("config map holds %v", cm.Data)
+	}
+}
+
+func TestDeniedApprovalTaskIsReportedAsDenied(t *testing.T) {
+	task := strings.Repeat("deploy", 10)
+	pr, _ := resolveApproval(t, approvalPipelineRun(task), task, false)
+
+	running := startedTask(task, 0, corev1.ConditionUnknown)
+	step := getApprovalStep(pr, running, &reporter.WorkflowStep{Status: reporter.WorkflowStepRunning})
+	if step.Status != reporter.WorkflowStepRunning {
+		t.Errorf("a decided task that still runs is %q", step.Status)
+	}
+	finished := startedTask(task, 0, corev1.ConditionFalse)
+	step = getApprovalStep(pr, finished, &reporter.WorkflowStep{Status: reporter.WorkflowStepFailed})
+	if step.Status != reporter.WorkflowStepDenied || step.Err == nil {
+		t.Errorf("a denied task is %+v", step)
+	}
+}
+
+func TestUndecidedApprovalTaskIsPendingApproval(t *testing.T) {
+	pr := approvalPipelineRun("deploy")
+	step := getApprovalStep(pr, startedTask("deploy", 0, corev1.ConditionUnknown), &reporter.WorkflowStep{Status: reporter.WorkflowStepRunning})
+	if step.Status != reporter.WorkflowStepPendingApproval || step.Name != "deploy" {
+		t.Errorf("an undecided task is %+v", step)
+	}
+}
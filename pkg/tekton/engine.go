@@ -0,0 +1,168 @@
+package tekton
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// EngineName selects the Tekton engine
+const EngineName = "tekton"
+
+// Engine implements engine.Engine for Tekton pipelineruns
+type Engine struct {
+	client     versioned.Interface
+	kubeClient kubernetes.Interface
+	snapshot   SnapshotOptions
+	logger     logger.Logger
+}
+
+func init() {
+	engine.Register(EngineName, NewEngine)
+}
+
+// NewEngine builds the Tekton engine
+func NewEngine(config *rest.Config, options engine.Options, lgr logger.Logger) (engine.Engine, error) {
+	client, err := versioned.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	kubeClient, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{
+		client:     client,
+		kubeClient: kubeClient,
+		snapshot: SnapshotOptions{
+			StepPerContainer: options.StepPerContainer,
+		},
+		logger: lgr,
+	}, nil
+}
+
+func (e *Engine) Name() string {
+	return EngineName
+}
+
+func (e *Engine) Watch(ctx context.Context, options engine.WatchOptions) (<-chan engine.Event, error) {
+	w := &Watcher{
+		Client:        e.client,
+		Namespace:     options.Namespace,
+		LabelSelector: options.LabelSelector,
+		ResyncPeriod:  options.ResyncPeriod,
+		Informer:      options.Informer,
+		Logger:        e.logger,
+	}
+	return engine.Forward(ctx, func(send func(engine.Event) bool) {
+		for ev := range w.Watch(ctx) {
+			if !send(engine.Event{Run: newRun(ev.PipelineRun), Deleted: ev.Deleted}) {
+				return
+			}
+		}
+	}), nil
+}
+
+func (e *Engine) Snapshot(run *engine.Run) (*reporter.Workflow, error) {
+	pr, err := pipelineRun(run)
+	if err != nil {
+		return nil, err
+	}
+	return GetWorkflowSnapshot(pr, e.snapshot)
+}
+
+func (e *Engine) HasFinished(run *engine.Run) bool {
+	pr, err := pipelineRun(run)
+	return err == nil && PipelineHasFinished(pr)
+}
+
+func (e *Engine) WorkflowSelector(workflowID string) string {
+	return fmt.Sprintf("tekton.dev/pipeline=%s", workflowID)
+}
+
+func (e *Engine) LogTargets(run *engine.Run) []logs.Target {
+	pr, err := pipelineRun(run)
+	if err != nil {
+		return nil
+	}
+	return GetLogTargets(pr, e.snapshot)
+}
+
+// Params returns the string params of the PipelineRun
+func (e *Engine) Params(run *engine.Run) map[string]string {
+	pr, err := pipelineRun(run)
+	if err != nil {
+		return nil
+	}
+	params := map[string]string{}
+	for _, p := range pr.Spec.Params {
+		if p.Value.Type == v1beta1.ParamTypeString {
+			params[p.Name] = p.Value.StringVal
+		}
+	}
+	return params
+}
+
+// Cancel sets the PipelineRun's spec.status, which makes Tekton cancel its TaskRuns
+func (e *Engine) Cancel(ctx context.Context, run *engine.Run) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"status": v1beta1.PipelineRunSpecStatusCancelled,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.client.TektonV1beta1().PipelineRuns(run.Namespace).Patch(ctx, run.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+// MarkReported annotates the PipelineRun with the final status it was reported with
+func (e *Engine) MarkReported(ctx context.Context, run *engine.Run, status string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{engine.ReportedAnnotation: status},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = e.client.TektonV1beta1().PipelineRuns(run.Namespace).Patch(ctx, run.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func newRun(pr *v1beta1.PipelineRun) *engine.Run {
+	run := &engine.Run{
+		UID:         pr.UID,
+		Kind:        "pipelinerun",
+		Name:        pr.Name,
+		Namespace:   pr.Namespace,
+		Labels:      pr.Labels,
+		Annotations: pr.Annotations,
+		Object:      pr,
+	}
+	if pr.Status.CompletionTime != nil {
+		run.FinishedAt = pr.Status.CompletionTime.Time
+	}
+	return run
+}
+
+func pipelineRun(run *engine.Run) (*v1beta1.PipelineRun, error) {
+	pr, ok := run.Object.(*v1beta1.PipelineRun)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a pipelinerun", run)
+	}
+	return pr, nil
+}
@@ -0,0 +1,29 @@
+package tekton
+
+import (
+	"context"
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/engine"
+
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestMarkReportedAnnotatesThePipelineRun(t *testing.T) {
+	pr := testPipelineRun(corev1.ConditionTrue)
+	client := fake.NewSimpleClientset(pr)
+	e := &Engine{client: client}
+
+	if err := e.MarkReported(context.Background(), newRun(pr), "success"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := client.TektonV1beta1().PipelineRuns("ns").Get(context.Background(), "run", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Annotations[engine.ReportedAnnotation] != "success" {
+		t.Errorf("expected the pipelinerun to be marked as reported, got %v", got.Annotations)
+	}
+}
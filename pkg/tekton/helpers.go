@@ -11,6 +11,10 @@ import (
 	"knative.dev/pkg/apis"
 )
 
+// pipelineRunReasonCancelled is the reason the Tekton controller sets on cancelled PipelineRuns,
+// which is not the one declared by the API
+const pipelineRunReasonCancelled = "PipelineRunCancelled"
+
 func PipelineHasStarted(pr *v1beta1.PipelineRun) bool {
 	if pr.Status.Conditions == nil {
 		return false
@@ -34,6 +38,25 @@ func PipelineHasFailed(pr *v1beta1.PipelineRun) error {
 	return nil
 }
 
+// PipelineWasCancelled tells if the PipelineRun failed because it was cancelled
+func PipelineWasCancelled(pr *v1beta1.PipelineRun) bool {
+	reason := pipelineFailureReason(pr)
+	return reason == pipelineRunReasonCancelled || reason == v1beta1.PipelineRunReasonCancelled.String()
+}
+
+// PipelineHasTimedOut tells if the PipelineRun failed because it ran longer than its timeout
+func PipelineHasTimedOut(pr *v1beta1.PipelineRun) bool {
+	return pipelineFailureReason(pr) == v1beta1.PipelineRunReasonTimedOut.String()
+}
+
+func pipelineFailureReason(pr *v1beta1.PipelineRun) string {
+	prConditions := pr.Status.Conditions
+	if len(prConditions) == 0 || prConditions[0].Status != corev1.ConditionFalse {
+		return ""
+	}
+	return prConditions[0].Reason
+}
+
 func PipelineIsRunning(pr *v1beta1.PipelineRun) bool {
 	prConditions := pr.Status.Conditions
 	return len(prConditions) != 0 && prConditions[0].Status == corev1.ConditionUnknown
@@ -50,6 +73,12 @@ func GetPipelineState(pr *v1beta1.PipelineRun) (reporter.WorkflowStatus, error)
 
 	if PipelineHasFinished(pr) {
 		if PipelineHasFailed(pr) != nil {
+			switch {
+			case PipelineWasCancelled(pr):
+				return reporter.WorkflowTerminated, nil
+			case PipelineHasTimedOut(pr):
+				return reporter.WorkflowTimeout, nil
+			}
 			return reporter.WorkflowFailed, nil
 		}
 		return reporter.WorkflowSucceded, nil
@@ -58,7 +87,7 @@ func GetPipelineState(pr *v1beta1.PipelineRun) (reporter.WorkflowStatus, error)
 }
 
 func TaskHasStarted(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
-	return trs.Status.StartTime != nil && !trs.Status.StartTime.IsZero()
+	return trs.Status != nil && trs.Status.StartTime != nil && !trs.Status.StartTime.IsZero()
 }
 
 func TaskHasFinished(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
@@ -73,6 +102,24 @@ func TaskHasFailed(trs *v1alpha1.PipelineRunTaskRunStatus) error {
 	return nil
 }
 
+// TaskWasCancelled tells if the TaskRun failed because it was cancelled
+func TaskWasCancelled(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
+	return taskFailureReason(trs) == v1beta1.TaskRunReasonCancelled.String()
+}
+
+// TaskHasTimedOut tells if the TaskRun failed because it ran longer than its timeout
+func TaskHasTimedOut(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
+	return taskFailureReason(trs) == v1beta1.TaskRunReasonTimedOut.String()
+}
+
+func taskFailureReason(trs *v1alpha1.PipelineRunTaskRunStatus) string {
+	trsConditions := trs.Status.Conditions
+	if len(trsConditions) == 0 || trsConditions[0].Status != corev1.ConditionFalse {
+		return ""
+	}
+	return trsConditions[0].Reason
+}
+
 func TaskIsSuccessful(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
 	return trs.Status.GetCondition(apis.ConditionSucceeded).IsTrue()
 }
@@ -91,6 +138,12 @@ func GetTaskStatus(trs *v1alpha1.PipelineRunTaskRunStatus) (reporter.WorkflowSte
 	}
 
 	if TaskHasFailed(trs) != nil {
+		switch {
+		case TaskWasCancelled(trs):
+			return reporter.WorkflowStepTerminated, nil
+		case TaskHasTimedOut(trs):
+			return reporter.WorkflowStepTimeout, nil
+		}
 		return reporter.WorkflowStepFailed, nil
 	}
 
@@ -0,0 +1,89 @@
+package tekton
+
+import (
+	"testing"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestGetPipelineStateOfAFailure(t *testing.T) {
+	tests := []struct {
+		reason    string
+		cancelled bool
+		timedOut  bool
+		want      reporter.WorkflowStatus
+	}{
+		{reason: "Cancelled", cancelled: true, want: reporter.WorkflowTerminated},
+		{reason: "PipelineRunCancelled", cancelled: true, want: reporter.WorkflowTerminated},
+		{reason: "PipelineRunTimeout", timedOut: true, want: reporter.WorkflowTimeout},
+		{reason: "Failed", want: reporter.WorkflowFailed},
+		{reason: "TaskRunCancelled", want: reporter.WorkflowFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			pr := testPipelineRun(corev1.ConditionFalse)
+			pr.Status.Conditions[0].Reason = tt.reason
+			if got := PipelineWasCancelled(pr); got != tt.cancelled {
+				t.Errorf("PipelineWasCancelled() = %v, want %v", got, tt.cancelled)
+			}
+			if got := PipelineHasTimedOut(pr); got != tt.timedOut {
+				t.Errorf("PipelineHasTimedOut() = %v, want %v", got, tt.timedOut)
+			}
+			if got, err := GetPipelineState(pr); got != tt.want || err != nil {
+				t.Errorf("GetPipelineState() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPipelineReasonOnlyCountsOnceFailed(t *testing.T) {
+	for _, status := range []corev1.ConditionStatus{corev1.ConditionUnknown, corev1.ConditionTrue} {
+		pr := testPipelineRun(status)
+		pr.Status.Conditions[0].Reason = "PipelineRunCancelled"
+		if PipelineWasCancelled(pr) || PipelineHasTimedOut(pr) {
+			t.Errorf("a pipeline that is %s was stopped", status)
+		}
+	}
+}
+
+func TestGetTaskStatusOfAFailure(t *testing.T) {
+	tests := []struct {
+		reason    string
+		cancelled bool
+		timedOut  bool
+		want      reporter.WorkflowStepStatus
+	}{
+		{reason: "TaskRunCancelled", cancelled: true, want: reporter.WorkflowStepTerminated},
+		{reason: "TaskRunTimeout", timedOut: true, want: reporter.WorkflowStepTimeout},
+		{reason: "Failed", want: reporter.WorkflowStepFailed},
+		{reason: "PipelineRunTimeout", want: reporter.WorkflowStepFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.reason, func(t *testing.T) {
+			trs := startedTask("build", 0, corev1.ConditionFalse)
+			trs.Status.Conditions[0].Reason = tt.reason
+			if got := TaskWasCancelled(trs); got != tt.cancelled {
+				t.Errorf("TaskWasCancelled() = %v, want %v", got, tt.cancelled)
+			}
+			if got := TaskHasTimedOut(trs); got != tt.timedOut {
+				t.Errorf("TaskHasTimedOut() = %v, want %v", got, tt.timedOut)
+			}
+			if got, err := GetTaskStatus(trs); got != tt.want || err != nil {
+				t.Errorf("GetTaskStatus() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestTaskReasonOnlyCountsOnceFailed(t *testing.T) {
+	trs := startedTask("build", 0, corev1.ConditionUnknown)
+	trs.Status.Conditions[0].Reason = "TaskRunTimeout"
+	if TaskWasCancelled(trs) || TaskHasTimedOut(trs) {
+		t.Error("a running task was stopped")
+	}
+	if got, _ := GetTaskStatus(trs); got != reporter.WorkflowStepRunning {
+		t.Errorf("GetTaskStatus() = %q", got)
+	}
+}
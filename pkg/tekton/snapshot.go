@@ -0,0 +1,273 @@
+package tekton
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/codefresh-io/status-reporter/pkg/logs"
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1alpha1"
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+)
+
+// FinallyGroup is the group of the steps of finally tasks
+const FinallyGroup = "finally"
+
+// SnapshotOptions control how PipelineRuns are translated into workflows
+type SnapshotOptions struct {
+	// StepPerContainer reports each step of a task as a step of its own, named "<task>/<step>",
+	// instead of a single step for the whole task
+	StepPerContainer bool
+}
+
+// GetWorkflowSnapshot translates the current state of a PipelineRun into a workflow,
+// with a step for each of its tasks that has running steps and for each task that was skipped.
+// Finally tasks come after the other tasks, in the finally group.
+// The results of the tasks and of the pipeline are reported along with them
+func GetWorkflowSnapshot(pr *v1beta1.PipelineRun, options SnapshotOptions) (*reporter.Workflow, error) {
+	status, err := GetPipelineState(pr)
+	if err != nil {
+		return nil, err
+	}
+	workflow := reporter.NewWorkflow()
+	workflow.Status = status
+	if status.IsFailure() {
+		workflow.Err = PipelineHasFailed(pr)
+	}
+	for _, r := range pr.Status.PipelineResults {
+		workflow.Results = append(workflow.Results, reporter.Variable{Name: r.Name, Value: r.Value})
+	}
+
+	finally := finallyTasks(pr)
+	skipped := skippedTasks(pr, status.IsFinal())
+	for _, group := range []string{"", FinallyGroup} {
+		for _, trs := range sortedTaskRuns(pr) {
+			if taskGroup(finally, trs.PipelineTaskName) != group {
+				continue
+			}
+			if TaskConditionCheckFailed(trs) {
+				workflow.AddStep(trs.PipelineTaskName, skippedStep(trs.PipelineTaskName, group))
+				continue
+			}
+			if err := addTaskSteps(workflow, pr, trs, group, options); err != nil {
+				return nil, err
+			}
+		}
+		for _, name := range skipped {
+			if taskGroup(finally, name) == group {
+				workflow.AddStep(name, skippedStep(name, group))
+			}
+		}
+	}
+	return workflow, nil
+}
+
+// addTaskSteps adds the steps of a task that has running steps. An approval task is always a single step
+func addTaskSteps(workflow *reporter.Workflow, pr *v1beta1.PipelineRun, trs *v1alpha1.PipelineRunTaskRunStatus, group string, options SnapshotOptions) error {
+	if trs.Status == nil || len(trs.Status.Steps) == 0 {
+		return nil
+	}
+	stepStatus, err := GetTaskStatus(trs)
+	if err != nil {
+		return err
+	}
+	step := &reporter.WorkflowStep{
+		Name:   trs.Status.Steps[0].Name,
+		Status: stepStatus,
+		Group:  group,
+	}
+	if stepStatus.IsFailure() {
+		step.Err = TaskHasFailed(trs)
+	}
+	if trs.Status.StartTime != nil {
+		step.StartedAt = trs.Status.StartTime.Time
+	}
+	if trs.Status.CompletionTime != nil && stepStatus.IsFinal() {
+		step.FinishedAt = trs.Status.CompletionTime.Time
+	}
+	for _, r := range trs.Status.TaskRunResults {
+		step.Results = append(step.Results, reporter.Variable{Name: r.Name, Value: r.Value})
+	}
+	if IsApprovalTask(pr, trs.PipelineTaskName) {
+		workflow.AddStep(trs.PipelineTaskName, getApprovalStep(pr, trs, step))
+		return nil
+	}
+	if !options.StepPerContainer {
+		workflow.AddStep(trs.PipelineTaskName, step)
+		return nil
+	}
+	for i, ss := range trs.Status.Steps {
+		name := fmt.Sprintf("%s/%s", trs.PipelineTaskName, ss.Name)
+		containerStep := getStepState(name, ss, step)
+		// the results belong to the task, they are reported with its last step
+		if i == len(trs.Status.Steps)-1 {
+			containerStep.Results = step.Results
+		}
+		workflow.AddStep(name, containerStep)
+	}
+	return nil
+}
+
+func skippedStep(task, group string) *reporter.WorkflowStep {
+	return &reporter.WorkflowStep{
+		Name:   task,
+		Status: reporter.WorkflowStepSkipped,
+		Group:  group,
+	}
+}
+
+// TaskConditionCheckFailed tells if a task was skipped because one of its conditions failed
+func TaskConditionCheckFailed(trs *v1alpha1.PipelineRunTaskRunStatus) bool {
+	for _, cc := range trs.ConditionChecks {
+		if cc != nil && cc.Status != nil && cc.Status.GetCondition(apis.ConditionSucceeded).IsFalse() {
+			return true
+		}
+	}
+	return false
+}
+
+// skippedTasks returns the names of the tasks that were skipped by their when expressions.
+// Once the PipelineRun has finished, the tasks that never ran (e.g. after another task failed)
+// are skipped as well
+func skippedTasks(pr *v1beta1.PipelineRun, finished bool) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, t := range pr.Status.SkippedTasks {
+		names = append(names, t.Name)
+		seen[t.Name] = true
+	}
+	if !finished || pr.Status.PipelineSpec == nil {
+		return names
+	}
+	for _, trs := range pr.Status.TaskRuns {
+		if trs != nil {
+			seen[trs.PipelineTaskName] = true
+		}
+	}
+	for _, tasks := range [][]v1beta1.PipelineTask{pr.Status.PipelineSpec.Tasks, pr.Status.PipelineSpec.Finally} {
+		for _, t := range tasks {
+			if !seen[t.Name] {
+				names = append(names, t.Name)
+			}
+		}
+	}
+	return names
+}
+
+// finallyTasks returns the names of the finally tasks of the PipelineRun's pipeline
+func finallyTasks(pr *v1beta1.PipelineRun) map[string]bool {
+	finally := map[string]bool{}
+	if pr.Status.PipelineSpec != nil {
+		for _, t := range pr.Status.PipelineSpec.Finally {
+			finally[t.Name] = true
+		}
+	}
+	return finally
+}
+
+func taskGroup(finally map[string]bool, task string) string {
+	if finally[task] {
+		return FinallyGroup
+	}
+	return ""
+}
+
+// GetLogTargets returns where the logs of the steps of a PipelineRun are, for the tasks whose pod
+// was created. The targets are named like the steps of the snapshot taken with the same options
+func GetLogTargets(pr *v1beta1.PipelineRun, options SnapshotOptions) []logs.Target {
+	var targets []logs.Target
+	for _, trs := range sortedTaskRuns(pr) {
+		if trs.Status == nil || trs.Status.PodName == "" || len(trs.Status.Steps) == 0 {
+			continue
+		}
+		if !options.StepPerContainer {
+			target := logs.Target{
+				Step:      trs.Status.Steps[0].Name,
+				Key:       trs.PipelineTaskName,
+				Namespace: pr.Namespace,
+				Pod:       trs.Status.PodName,
+			}
+			for _, ss := range trs.Status.Steps {
+				target.Containers = append(target.Containers, ss.ContainerName)
+			}
+			targets = append(targets, target)
+			continue
+		}
+		for _, ss := range trs.Status.Steps {
+			name := fmt.Sprintf("%s/%s", trs.PipelineTaskName, ss.Name)
+			targets = append(targets, logs.Target{
+				Step:       name,
+				Key:        name,
+				Namespace:  pr.Namespace,
+				Pod:        trs.Status.PodName,
+				Containers: []string{ss.ContainerName},
+			})
+		}
+	}
+	return targets
+}
+
+// getStepState translates the state of a single step of a task, given the state of the task.
+// Steps that did not terminate when their task failed, was cancelled or timed out share its fate
+func getStepState(name string, ss v1beta1.StepState, task *reporter.WorkflowStep) *reporter.WorkflowStep {
+	step := &reporter.WorkflowStep{
+		Name:   name,
+		Status: reporter.WorkflowStepPending,
+		Group:  task.Group,
+	}
+	switch {
+	case ss.Terminated != nil:
+		exitCode := ss.Terminated.ExitCode
+		step.ExitCode = &exitCode
+		step.StartedAt = ss.Terminated.StartedAt.Time
+		step.FinishedAt = ss.Terminated.FinishedAt.Time
+		if exitCode == 0 {
+			step.Status = reporter.WorkflowStepSucceded
+		} else {
+			step.Status = reporter.WorkflowStepFailed
+			step.Err = fmt.Errorf("step %s exited with code %d: %s", ss.Name, exitCode, ss.Terminated.Reason)
+		}
+	case ss.Running != nil:
+		step.Status = reporter.WorkflowStepRunning
+		step.StartedAt = ss.Running.StartedAt.Time
+	}
+	if task.Status.IsFailure() && !step.Status.IsFinal() {
+		step.Status = task.Status
+		step.Err = task.Err
+		step.FinishedAt = task.FinishedAt
+	}
+	return step
+}
+
+// sortedTaskRuns returns the taskruns of a PipelineRun by the time they started.
+// Taskruns without a status (e.g. when a condition check failed) come last
+func sortedTaskRuns(pr *v1beta1.PipelineRun) []*v1alpha1.PipelineRunTaskRunStatus {
+	trs := make([]*v1alpha1.PipelineRunTaskRunStatus, 0, len(pr.Status.TaskRuns))
+	for _, t := range pr.Status.TaskRuns {
+		if t != nil {
+			trs = append(trs, t)
+		}
+	}
+	sort.Slice(trs, func(i, j int) bool {
+		si, sj := taskStartTime(trs[i]), taskStartTime(trs[j])
+		if si != nil && sj != nil && !si.Equal(sj) {
+			return si.Before(sj)
+		}
+		if (si == nil) != (sj == nil) {
+			return si != nil
+		}
+		return trs[i].PipelineTaskName < trs[j].PipelineTaskName
+	})
+	return trs
+}
+
+// taskStartTime returns when a taskrun started, nil until it did
+func taskStartTime(trs *v1alpha1.PipelineRunTaskRunStatus) *metav1.Time {
+	if trs.Status == nil {
+		return nil
+	}
+	return trs.Status.StartTime
+}
@@ -0,0 +1,175 @@
+package tekton
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/reporter"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"knative.dev/pkg/apis"
+	duckv1beta1 "knative.dev/pkg/apis/duck/v1beta1"
+)
+
+var testStart = time.Date(2020, 12, 1, 10, 0, 0, 0, time.UTC)
+
+func succeeded(status corev1.ConditionStatus) duckv1beta1.Status {
+	return duckv1beta1.Status{Conditions: duckv1beta1.Conditions{{Type: apis.ConditionSucceeded, Status: status}}}
+}
+
+// startedTask is a taskrun that started after offset, with a single step
+func startedTask(task string, offset time.Duration, status corev1.ConditionStatus) *v1beta1.PipelineRunTaskRunStatus {
+	start := metav1.NewTime(testStart.Add(offset))
+	return &v1beta1.PipelineRunTaskRunStatus{
+		PipelineTaskName: task,
+		Status: &v1beta1.TaskRunStatus{
+			Status: succeeded(status),
+			TaskRunStatusFields: v1beta1.TaskRunStatusFields{
+				PodName:   task + "-pod",
+				StartTime: &start,
+				Steps: []v1beta1.StepState{{
+					Name:           task,
+					ContainerName:  "step-" + task,
+					ContainerState: corev1.ContainerState{Running: &corev1.ContainerStateRunning{StartedAt: start}},
+				}},
+			},
+		},
+	}
+}
+
+// conditionFailedTask is a taskrun that never ran because its condition check failed
+func conditionFailedTask(task string) *v1beta1.PipelineRunTaskRunStatus {
+	return &v1beta1.PipelineRunTaskRunStatus{
+		PipelineTaskName: task,
+		ConditionChecks: map[string]*v1beta1.PipelineRunConditionCheckStatus{
+			task + "-check": {
+				ConditionName: "check",
+				Status:        &v1beta1.ConditionCheckStatus{Status: succeeded(corev1.ConditionFalse)},
+			},
+		},
+	}
+}
+
+func testPipelineRun(status corev1.ConditionStatus, taskRuns ...*v1beta1.PipelineRunTaskRunStatus) *v1beta1.PipelineRun {
+	pr := &v1beta1.PipelineRun{
+		ObjectMeta: metav1.ObjectMeta{Name: "run", Namespace: "ns"},
+		Status: v1beta1.PipelineRunStatus{
+			Status: succeeded(status),
+			PipelineRunStatusFields: v1beta1.PipelineRunStatusFields{
+				TaskRuns: map[string]*v1beta1.PipelineRunTaskRunStatus{},
+			},
+		},
+	}
+	for _, trs := range taskRuns {
+		pr.Status.TaskRuns["run-"+trs.PipelineTaskName] = trs
+	}
+	return pr
+}
+
+func stepStatuses(w *reporter.Workflow) map[string]reporter.WorkflowStepStatus {
+	statuses := map[string]reporter.WorkflowStepStatus{}
+	for key, step := range w.Steps {
+		statuses[key] = step.Status
+	}
+	return statuses
+}
+
+func TestGetWorkflowSnapshot(t *testing.T) {
+	tests := []struct {
+		name      string
+		pr        *v1beta1.PipelineRun
+		wantOrder []string
+		want      map[string]reporter.WorkflowStepStatus
+	}{
+		{
+			name:      "taskrun without status",
+			pr:        testPipelineRun(corev1.ConditionUnknown, startedTask("build", 0, corev1.ConditionUnknown), &v1beta1.PipelineRunTaskRunStatus{PipelineTaskName: "deploy"}),
+			wantOrder: []string{"build"},
+			want:      map[string]reporter.WorkflowStepStatus{"build": reporter.WorkflowStepRunning},
+		},
+		{
+			name:      "condition check failed",
+			pr:        testPipelineRun(corev1.ConditionUnknown, startedTask("build", 0, corev1.ConditionTrue), conditionFailedTask("deploy")),
+			wantOrder: []string{"build", "deploy"},
+			want: map[string]reporter.WorkflowStepStatus{
+				"build":  reporter.WorkflowStepSucceded,
+				"deploy": reporter.WorkflowStepSkipped,
+			},
+		},
+		{
+			name: "taskruns by start time",
+			pr: testPipelineRun(corev1.ConditionUnknown,
+				startedTask("test", time.Minute, corev1.ConditionUnknown),
+				startedTask("build", 0, corev1.ConditionTrue),
+				&v1beta1.PipelineRunTaskRunStatus{PipelineTaskName: "a-not-started"},
+			),
+			wantOrder: []string{"build", "test"},
+			want: map[string]reporter.WorkflowStepStatus{
+				"build": reporter.WorkflowStepSucceded,
+				"test":  reporter.WorkflowStepRunning,
+			},
+		},
+		{
+			name:      "failed pipelinerun",
+			pr:        testPipelineRun(corev1.ConditionFalse, startedTask("build", 0, corev1.ConditionFalse)),
+			wantOrder: []string{"build"},
+			want:      map[string]reporter.WorkflowStepStatus{"build": reporter.WorkflowStepFailed},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := GetWorkflowSnapshot(tt.pr, SnapshotOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := w.StepKeys(); !reflect.DeepEqual(got, tt.wantOrder) {
+				t.Errorf("steps %v, want %v", got, tt.wantOrder)
+			}
+			if got := stepStatuses(w); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("statuses %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetLogTargetsSkipsTaskRunsWithoutStatus(t *testing.T) {
+	pr := testPipelineRun(corev1.ConditionUnknown,
+		startedTask("build", 0, corev1.ConditionUnknown),
+		&v1beta1.PipelineRunTaskRunStatus{PipelineTaskName: "deploy"},
+		conditionFailedTask("notify"),
+	)
+	targets := GetLogTargets(pr, SnapshotOptions{})
+	if len(targets) != 1 || targets[0].Step != "build" || targets[0].Pod != "build-pod" {
+		t.Fatalf("unexpected targets %+v", targets)
+	}
+}
+
+func TestLogTargetsAreKeyedLikeTheSnapshot(t *testing.T) {
+	build := startedTask("build", 0, corev1.ConditionUnknown)
+	// the first step of a task is not named after it
+	build.Status.Steps[0].Name = "compile"
+	pr := testPipelineRun(corev1.ConditionUnknown, build, startedTask("test", time.Minute, corev1.ConditionUnknown))
+	for _, options := range []SnapshotOptions{{}, {StepPerContainer: true}} {
+		workflow, err := GetWorkflowSnapshot(pr, options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		targets := GetLogTargets(pr, options)
+		if len(targets) != 2 {
+			t.Fatalf("expected a target per task, got %+v", targets)
+		}
+		for _, target := range targets {
+			step, ok := workflow.Steps[target.Key]
+			if !ok {
+				t.Errorf("expected step %q in the snapshot taken with %+v", target.Key, options)
+				continue
+			}
+			if step.Name != target.Step {
+				t.Errorf("expected the target of %q to be named %q, got %q", target.Key, step.Name, target.Step)
+			}
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package tekton
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/informer"
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	"github.com/tektoncd/pipeline/pkg/apis/pipeline/v1beta1"
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned"
+	"github.com/tektoncd/pipeline/pkg/client/informers/externalversions"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+const (
+	minWatchBackoff = time.Second
+	maxWatchBackoff = 30 * time.Second
+	// minHealthyWatch is how long a watch without events must last to be watched again at once
+	minHealthyWatch = 10 * time.Second
+)
+
+type (
+	// Watcher streams the state of PipelineRuns, surviving watch expirations and API server restarts
+	Watcher struct {
+		Client        versioned.Interface
+		Namespace     string
+		LabelSelector string
+		// ResyncPeriod is how often every PipelineRun is sent again, even if it did not change. 0 disables resyncs
+		ResyncPeriod time.Duration
+		// Informer uses a shared informer instead of the list and watch loop
+		Informer bool
+		Logger   logger.Logger
+	}
+
+	// Event is the latest known state of a PipelineRun
+	Event struct {
+		PipelineRun *v1beta1.PipelineRun
+		Deleted     bool
+	}
+)
+
+// Watch starts watching in the background. The returned channel is closed once ctx is done
+func (w *Watcher) Watch(ctx context.Context) <-chan Event {
+	events := make(chan Event)
+	if w.Informer {
+		go w.runInformer(ctx, events)
+	} else {
+		go w.run(ctx, events)
+	}
+	return events
+}
+
+// run lists the PipelineRuns and then watches them from the listed resourceVersion,
+// re-watching from the last seen resourceVersion whenever the watch ends and
+// re-listing when that resourceVersion is too old (410 Gone) or a resync is due
+func (w *Watcher) run(ctx context.Context, events chan<- Event) {
+	defer close(events)
+	backoff := minWatchBackoff
+	for ctx.Err() == nil {
+		rv, err := w.list(ctx, events)
+		if err != nil {
+			w.Logger.Err(err, "failed to list pipelineruns", "retry-in", backoff.String())
+			backoff = w.sleep(ctx, backoff)
+			continue
+		}
+		backoff = minWatchBackoff
+		w.watchUntilRelist(ctx, rv, events)
+	}
+}
+
+// watchUntilRelist keeps watching from the last seen resourceVersion until a re-list is needed
+func (w *Watcher) watchUntilRelist(ctx context.Context, rv string, events chan<- Event) {
+	var resync <-chan time.Time
+	if w.ResyncPeriod > 0 {
+		timer := time.NewTimer(w.ResyncPeriod)
+		defer timer.Stop()
+		resync = timer.C
+	}
+	backoff := minWatchBackoff
+	for ctx.Err() == nil {
+		started, from := time.Now(), rv
+		var relist bool
+		var err error
+		rv, relist, err = w.watch(ctx, rv, resync, events)
+		if relist || ctx.Err() != nil {
+			return
+		}
+		// a watch that ends right away without any event is not watched again at once,
+		// the backoff only starts over once a watch got events or lasted
+		if rv != from || time.Since(started) >= minHealthyWatch {
+			backoff = minWatchBackoff
+			if err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			w.Logger.Err(err, "pipelineruns watch failed", "resource-version", rv, "retry-in", backoff.String())
+		} else {
+			w.Logger.Info("Pipelineruns watch ended early", "resource-version", rv, "retry-in", backoff.String())
+		}
+		backoff = w.sleep(ctx, backoff)
+	}
+}
+
+func (w *Watcher) list(ctx context.Context, events chan<- Event) (string, error) {
+	list, err := w.Client.TektonV1beta1().PipelineRuns(w.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: w.LabelSelector,
+	})
+	if err != nil {
+		return "", err
+	}
+	for i := range list.Items {
+		if !w.send(ctx, events, Event{PipelineRun: &list.Items[i]}) {
+			break
+		}
+	}
+	return list.ResourceVersion, nil
+}
+
+// watch watches from resourceVersion rv until the watch ends, returning the last seen resourceVersion
+// and whether a re-list is needed
+func (w *Watcher) watch(ctx context.Context, rv string, resync <-chan time.Time, events chan<- Event) (string, bool, error) {
+	wi, err := w.Client.TektonV1beta1().PipelineRuns(w.Namespace).Watch(ctx, metav1.ListOptions{
+		LabelSelector:       w.LabelSelector,
+		ResourceVersion:     rv,
+		AllowWatchBookmarks: true,
+	})
+	if err != nil {
+		return rv, apierrors.IsGone(err) || apierrors.IsResourceExpired(err), err
+	}
+	defer wi.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return rv, false, nil
+		case <-resync:
+			w.Logger.Info("Resyncing pipelineruns")
+			return rv, true, nil
+		case ev, ok := <-wi.ResultChan():
+			if !ok {
+				w.Logger.Info("Pipelineruns watch closed, resuming", "resource-version", rv)
+				return rv, false, nil
+			}
+			switch ev.Type {
+			case watch.Error:
+				err := apierrors.FromObject(ev.Object)
+				if apierrors.IsGone(err) || apierrors.IsResourceExpired(err) {
+					w.Logger.Info("Resource version is too old, re-listing", "resource-version", rv)
+					return rv, true, nil
+				}
+				return rv, false, err
+			case watch.Bookmark, watch.Added, watch.Modified, watch.Deleted:
+				pr, ok := ev.Object.(*v1beta1.PipelineRun)
+				if !ok {
+					w.Logger.Err(fmt.Errorf("Invalid object type"), "unexpected object type from event")
+					continue
+				}
+				rv = pr.ResourceVersion
+				if ev.Type == watch.Bookmark {
+					continue
+				}
+				if !w.send(ctx, events, Event{PipelineRun: pr, Deleted: ev.Type == watch.Deleted}) {
+					return rv, false, nil
+				}
+			}
+		}
+	}
+}
+
+func (w *Watcher) runInformer(ctx context.Context, events chan<- Event) {
+	var gate informer.Gate
+	defer gate.Close(func() { close(events) })
+
+	factory := externalversions.NewSharedInformerFactoryWithOptions(w.Client, w.ResyncPeriod,
+		externalversions.WithNamespace(w.Namespace),
+		externalversions.WithTweakListOptions(func(opts *metav1.ListOptions) {
+			opts.LabelSelector = w.LabelSelector
+		}),
+	)
+	factory.Tekton().V1beta1().PipelineRuns().Informer().AddEventHandler(informer.Handler(func(obj interface{}, deleted bool) {
+		pr, ok := obj.(*v1beta1.PipelineRun)
+		if !ok {
+			w.Logger.Err(fmt.Errorf("Invalid object type"), "unexpected object type from informer")
+			return
+		}
+		gate.Send(func() {
+			w.send(ctx, events, Event{PipelineRun: pr.DeepCopy(), Deleted: deleted})
+		})
+	}))
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+}
+
+func (w *Watcher) send(ctx context.Context, events chan<- Event, ev Event) bool {
+	select {
+	case events <- ev:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (w *Watcher) sleep(ctx context.Context, backoff time.Duration) time.Duration {
+	select {
+	case <-time.After(backoff):
+	case <-ctx.Done():
+	}
+	if backoff *= 2; backoff > maxWatchBackoff {
+		backoff = maxWatchBackoff
+	}
+	return backoff
+}
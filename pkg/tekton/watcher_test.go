@@ -0,0 +1,207 @@
+package tekton
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/codefresh-io/status-reporter/pkg/logger"
+
+	"github.com/tektoncd/pipeline/pkg/client/clientset/versioned/fake"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("expected an event, the watcher stopped")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return Event{}
+}
+
+func testWatcher(t *testing.T, informer bool) {
+	pr := testPipelineRun(corev1.ConditionUnknown)
+	client := fake.NewSimpleClientset(pr)
+	// the fake clientset only sends the changes made after the watch started
+	watching := make(chan struct{}, 1)
+	client.PrependWatchReactor("pipelineruns", func(k8stesting.Action) (bool, watch.Interface, error) {
+		select {
+		case watching <- struct{}{}:
+		default:
+		}
+		return false, nil, nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &Watcher{Client: client, Namespace: "ns", Informer: informer, Logger: logger.New(logger.Options{})}
+	events := w.Watch(ctx)
+	if ev := nextEvent(t, events); ev.PipelineRun.Name != "run" || ev.Deleted {
+		t.Fatalf("expected the existing pipelinerun to be listed, got %+v", ev)
+	}
+
+	select {
+	case <-watching:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the watch")
+	}
+	prs := client.TektonV1beta1().PipelineRuns("ns")
+	if _, err := prs.Update(ctx, testPipelineRun(corev1.ConditionTrue), metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); !ev.PipelineRun.IsDone() || ev.Deleted {
+		t.Fatalf("expected the finished pipelinerun, got %+v", ev)
+	}
+
+	if err := prs.Delete(ctx, "run", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, events); ev.PipelineRun.Name != "run" || !ev.Deleted {
+		t.Errorf("expected the deleted pipelinerun, got %+v", ev)
+	}
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWatcherSendsListedUpdatedAndDeletedRuns(t *testing.T) {
+	testWatcher(t, false)
+}
+
+func TestInformerSendsListedUpdatedAndDeletedRuns(t *testing.T) {
+	testWatcher(t, true)
+}
+
+// watchScript answers the n-th watch of pipelineruns with the n-th of its watches,
+// and records the resourceVersion every watch started from
+type watchScript struct {
+	mu      sync.Mutex
+	watches []func() (watch.Interface, error)
+	from    []string
+	lists   int
+}
+
+func (s *watchScript) install(client *fake.Clientset) {
+	client.PrependReactor("list", "pipelineruns", func(k8stesting.Action) (bool, runtime.Object, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.lists++
+		return false, nil, nil
+	})
+	client.PrependWatchReactor("pipelineruns", func(action k8stesting.Action) (bool, watch.Interface, error) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		n := len(s.from)
+		s.from = append(s.from, action.(k8stesting.WatchAction).GetWatchRestrictions().ResourceVersion)
+		if n >= len(s.watches) {
+			// watches that never end once the script is over
+			return true, watch.NewFake(), nil
+		}
+		wi, err := s.watches[n]()
+		return true, wi, err
+	})
+}
+
+func (s *watchScript) state() (int, []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lists, append([]string(nil), s.from...)
+}
+
+// closedWatch sends events and ends
+func closedWatch(events ...watch.Event) func() (watch.Interface, error) {
+	return func() (watch.Interface, error) {
+		wi := watch.NewFakeWithChanSize(len(events), false)
+		for _, ev := range events {
+			wi.Action(ev.Type, ev.Object)
+		}
+		wi.Stop()
+		return wi, nil
+	}
+}
+
+func runScript(t *testing.T, script *watchScript, until func(lists int, from []string) bool) (int, []string) {
+	client := fake.NewSimpleClientset(testPipelineRun(corev1.ConditionUnknown))
+	script.install(client)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	w := &Watcher{Client: client, Namespace: "ns", Logger: logger.New(logger.Options{})}
+	events := w.Watch(ctx)
+	go func() {
+		for range events {
+		}
+	}()
+
+	deadline := time.After(5 * time.Second)
+	for {
+		lists, from := script.state()
+		if until(lists, from) {
+			return lists, from
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("listed %d times, watched from %q", lists, from)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func bookmark(rv string) watch.Event {
+	pr := testPipelineRun(corev1.ConditionUnknown)
+	pr.ResourceVersion = rv
+	return watch.Event{Type: watch.Bookmark, Object: pr}
+}
+
+func TestWatcherRelistsWhenTheWatchIsGone(t *testing.T) {
+	script := &watchScript{watches: []func() (watch.Interface, error){
+		func() (watch.Interface, error) { return nil, apierrors.NewGone("too old resource version") },
+	}}
+	lists, from := runScript(t, script, func(lists int, _ []string) bool { return lists >= 2 })
+	if lists != 2 || len(from) < 1 {
+		t.Errorf("listed %d times, watched from %q", lists, from)
+	}
+}
+
+func TestWatcherRelistsWhenTheResourceVersionExpired(t *testing.T) {
+	expired := &metav1.Status{Status: metav1.StatusFailure, Code: 410, Reason: metav1.StatusReasonExpired}
+	script := &watchScript{watches: []func() (watch.Interface, error){
+		closedWatch(bookmark("5"), watch.Event{Type: watch.Error, Object: expired}),
+	}}
+	lists, _ := runScript(t, script, func(lists int, _ []string) bool { return lists >= 2 })
+	if lists != 2 {
+		t.Errorf("listed %d times", lists)
+	}
+}
+
+func TestWatcherResumesFromTheLastBookmark(t *testing.T) {
+	script := &watchScript{watches: []func() (watch.Interface, error){
+		closedWatch(bookmark("5"), bookmark("7")),
+	}}
+	lists, from := runScript(t, script, func(_ int, from []string) bool { return len(from) >= 2 })
+	if lists != 1 || from[1] != "7" {
+		t.Errorf("listed %d times, watched from %q", lists, from)
+	}
+}
+
+func TestWatcherBacksOffWatchesThatEndWithoutEvents(t *testing.T) {
+	script := &watchScript{watches: []func() (watch.Interface, error){closedWatch(), closedWatch()}}
+	runScript(t, script, func(_ int, from []string) bool { return len(from) >= 1 })
+
+	time.Sleep(minWatchBackoff / 2)
+	if _, from := script.state(); len(from) != 1 {
+		t.Errorf("watched again at once, from %q", from)
+	}
+}